@@ -0,0 +1,119 @@
+package tracing
+
+import (
+	"errors"
+	"fmt"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+const (
+	tagAnteDecorator = "ante_decorator"
+	// AnteDecoratorPostOperationName is the span of an error that a decorator returns after the next decorator
+	AnteDecoratorPostOperationName = "ante_decorator_post"
+)
+
+// ChainTraceAnteDecorators chains the ante decorators like sdk.ChainAnteDecorators with every decorator traced
+// in its own span. Use it within NewTraceAnteHandler so that the decorator spans are children of the ante handler span.
+func ChainTraceAnteDecorators(chain ...sdk.AnteDecorator) sdk.AnteHandler {
+	if !tracerEnabled {
+		return sdk.ChainAnteDecorators(chain...)
+	}
+	traced := make([]sdk.AnteDecorator, len(chain))
+	for i, d := range chain {
+		traced[i] = NewTraceAnteDecorator(d)
+	}
+	return sdk.ChainAnteDecorators(traced...)
+}
+
+var _ sdk.AnteDecorator = TraceAnteDecorator{}
+
+// TraceAnteDecorator is a decorator to an ante decorator that records its gas, store writes and error in an
+// `ante_decorator` span. The span is finished when the next decorator is called so that the spans of a chain are
+// siblings. The work of the decorator after the next decorator returns is not covered. An error that the decorator
+// returns then is recorded in an `ante_decorator_post` span.
+type TraceAnteDecorator struct {
+	other sdk.AnteDecorator
+	name  string
+}
+
+// NewTraceAnteDecorator constructor
+func NewTraceAnteDecorator(other sdk.AnteDecorator) TraceAnteDecorator {
+	return TraceAnteDecorator{other: other, name: fmt.Sprintf("%T", other)}
+}
+
+func (t TraceAnteDecorator) AnteHandle(rootCtx sdk.Context, tx sdk.Tx, simulate bool, next sdk.AnteHandler) (newCtx sdk.Context, err error) {
+	if !tracerEnabled || !isTraceable(rootCtx, simulate) {
+		return t.other.AnteHandle(rootCtx, tx, simulate, next)
+	}
+	p := msgSamplingParams("ante_decorator", tx.GetMsgs()...)
+	ctx, sampled := sampleCtx(WithSimulation(rootCtx, simulate), p)
+	if !sampled {
+		// attribute the gas of the decorator without a span
+		workCtx, _ := withUnsampledOrigin(ctx, p)
+		return t.other.AnteHandle(workCtx, tx, simulate, func(nextCtx sdk.Context, tx sdk.Tx, simulate bool) (sdk.Context, error) {
+			return next(restoreAnteCtx(nextCtx, workCtx, ctx), tx, simulate)
+		})
+	}
+	opts := defaultSpanOptions()
+	opts.storeLog = StoreLogWritesOnly
+	workCtx, c := startSpanCapture(ctx, p, opts)
+	c.span.SetTag(tagAnteDecorator, t.name)
+	gasBefore := workCtx.GasMeter().GasConsumed()
+	var finished bool
+	finish := func(err error) {
+		if finished {
+			return
+		}
+		finished = true
+		c.span.SetTag(tagGasUsed, workCtx.GasMeter().GasConsumed()-gasBefore)
+		c.done(err)()
+	}
+	defer func() {
+		// capture and finish the span on panics, like out of gas, before the panic is passed on unchanged.
+		// The events of the decorator are not emitted then
+		if r := recover(); r != nil {
+			if !finished {
+				c.recordPanic(r, workCtx.GasMeter())
+				finish(nil)
+			}
+			panic(r)
+		}
+	}()
+	var nextErr error
+	newCtx, err = t.other.AnteHandle(workCtx, tx, simulate, func(nextCtx sdk.Context, tx sdk.Tx, simulate bool) (sdk.Context, error) {
+		finish(nil)
+		nextCtx, nextErr = next(restoreAnteCtx(nextCtx, workCtx, ctx), tx, simulate)
+		return nextCtx, nextErr
+	})
+	if finished && err != nil && (nextErr == nil || !errors.Is(err, nextErr)) {
+		t.tracePostError(ctx, tx, err)
+	}
+	finish(err)
+	return newCtx, err
+}
+
+// tracePostError records the error that the decorator returned after the next decorator
+func (t TraceAnteDecorator) tracePostError(ctx sdk.Context, tx sdk.Tx, err error) {
+	p := msgSamplingParams(AnteDecoratorPostOperationName, tx.GetMsgs()...)
+	_, c := startSpanCapture(ctx, p, spanOptions{storeLog: StoreLogNothing})
+	c.span.SetTag(tagAnteDecorator, t.name)
+	c.done(err)()
+}
+
+// restoreAnteCtx returns the context of the decorator with the capturing components of its span replaced by the ones
+// of the parent context. Components that the decorator replaced, like the gas meter, are kept.
+func restoreAnteCtx(nextCtx, workCtx, parentCtx sdk.Context) sdk.Context {
+	nextCtx = nextCtx.WithContext(parentCtx.Context()).WithLogger(parentCtx.Logger()).
+		WithValue(originKey, parentCtx.Value(originKey))
+	if nextCtx.MultiStore() == workCtx.MultiStore() {
+		nextCtx = nextCtx.WithMultiStore(parentCtx.MultiStore())
+	}
+	if nextCtx.EventManager() == workCtx.EventManager() {
+		nextCtx = nextCtx.WithEventManager(parentCtx.EventManager())
+	}
+	if nextCtx.GasMeter() == workCtx.GasMeter() {
+		nextCtx = nextCtx.WithGasMeter(parentCtx.GasMeter())
+	}
+	return nextCtx
+}
@@ -0,0 +1,194 @@
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/cometbft/cometbft/libs/rand"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/address"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainTraceAnteDecorators(t *testing.T) {
+	tracerEnabled = true
+	t.Cleanup(func() { tracerEnabled = false })
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+
+	ctx, enc, storeKey := createMinTestInput(t)
+	sender := sdk.AccAddress(rand.Bytes(address.Len))
+	tx := mockTx{msgs: []sdk.Msg{&banktypes.MsgSend{FromAddress: sender.String(), ToAddress: sender.String()}}}
+	// write consumes the gas and writes the key before the next decorator is called
+	write := func(gas uint64, key string) mockAnteDecorator {
+		return func(ctx sdk.Context, tx sdk.Tx, simulate bool, next sdk.AnteHandler) (sdk.Context, error) {
+			ctx.GasMeter().ConsumeGas(gas, "testing")
+			ctx.KVStore(storeKey).Set([]byte(key), []byte("value"))
+			ctx.EventManager().EmitEvent(sdk.NewEvent("ante", sdk.NewAttribute("key", key)))
+			return next(ctx, tx, simulate)
+		}
+	}
+	fail := mockAnteDecorator(func(ctx sdk.Context, tx sdk.Tx, simulate bool, next sdk.AnteHandler) (sdk.Context, error) {
+		return ctx, errors.New("insufficient fees")
+	})
+	failAfterNext := mockAnteDecorator(func(ctx sdk.Context, tx sdk.Tx, simulate bool, next sdk.AnteHandler) (sdk.Context, error) {
+		newCtx, err := next(ctx, tx, simulate)
+		if err != nil {
+			return newCtx, err
+		}
+		return newCtx, errors.New("post check failed")
+	})
+	outOfGas := mockAnteDecorator(func(ctx sdk.Context, tx sdk.Tx, simulate bool, next sdk.AnteHandler) (sdk.Context, error) {
+		ctx.EventManager().EmitEvent(sdk.NewEvent("ante", sdk.NewAttribute("key", "oog")))
+		ctx.GasMeter().ConsumeGas(100_000, "testing")
+		return next(ctx, tx, simulate)
+	})
+	// writeGas is the store gas of a write with a 1 byte key and 5 bytes value
+	const writeGas = 2_000 + 6*30
+	specs := map[string]struct {
+		chain     []sdk.AnteDecorator
+		expErr    bool
+		expPanic  bool
+		expGas    []uint64
+		expWrites []string
+		expEvents int
+		// expFailed is the index of the errored decorator span or -1
+		expFailed int
+		// expPostErr is set when an ante_decorator_post span with the error is expected
+		expPostErr bool
+	}{
+		"all pass": {
+			chain:     []sdk.AnteDecorator{write(10, "a"), write(5, "b")},
+			expGas:    []uint64{10 + writeGas, 5 + writeGas},
+			expWrites: []string{"a", "b"},
+			expEvents: 2,
+			expFailed: -1,
+		},
+		"error": {
+			chain:     []sdk.AnteDecorator{write(10, "a"), fail, write(5, "b")},
+			expErr:    true,
+			expGas:    []uint64{10 + writeGas, 0},
+			expWrites: []string{"a", ""},
+			expEvents: 1,
+			expFailed: 1,
+		},
+		"error after next": {
+			chain:      []sdk.AnteDecorator{write(10, "a"), failAfterNext, write(5, "b")},
+			expErr:     true,
+			expGas:     []uint64{10 + writeGas, 0, 5 + writeGas},
+			expWrites:  []string{"a", "", "b"},
+			expEvents:  2,
+			expFailed:  -1,
+			expPostErr: true,
+		},
+		"error after next in next": {
+			chain:     []sdk.AnteDecorator{failAfterNext, fail},
+			expErr:    true,
+			expGas:    []uint64{0, 0},
+			expWrites: []string{"", ""},
+			expFailed: 1,
+		},
+		"out of gas": {
+			chain:     []sdk.AnteDecorator{write(10, "a"), outOfGas, write(5, "b")},
+			expPanic:  true,
+			expGas:    []uint64{10 + writeGas, 100_000},
+			expWrites: []string{"a", ""},
+			expEvents: 1,
+			expFailed: 1,
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			tracer.Reset()
+			ante := NewTraceAnteHandler(ChainTraceAnteDecorators(spec.chain...), enc)
+			execCtx, _ := ctx.WithGasMeter(sdk.NewGasMeter(10_000)).CacheContext()
+
+			// when
+			var err error
+			exec := func() {
+				_, err = ante(execCtx.WithTxBytes([]byte("my-tx")), tx, false)
+			}
+			if spec.expPanic {
+				require.Panics(t, exec)
+			} else {
+				exec()
+			}
+
+			// then
+			if spec.expErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			spans := tracer.FinishedSpans()
+			parent := spans[len(spans)-1]
+			assert.Equal(t, "ante_handler", parent.OperationName)
+			if spec.expPostErr {
+				require.Len(t, spans, len(spec.expGas)+2)
+				post := spans[len(spans)-2]
+				assert.Equal(t, AnteDecoratorPostOperationName, post.OperationName)
+				assert.Equal(t, parent.SpanContext.SpanID, post.ParentID)
+				assert.Equal(t, "tracing.mockAnteDecorator", post.Tag(tagAnteDecorator))
+				assert.Equal(t, "true", post.Tag(tagErrored))
+			} else {
+				require.Len(t, spans, len(spec.expGas)+1)
+			}
+			for i, s := range spans[:len(spec.expGas)] {
+				assert.Equal(t, "ante_decorator", s.OperationName)
+				assert.Equal(t, parent.SpanContext.SpanID, s.ParentID)
+				assert.Equal(t, "tracing.mockAnteDecorator", s.Tag(tagAnteDecorator))
+				assert.Equal(t, spec.expGas[i], s.Tag(tagGasUsed))
+				if i == spec.expFailed {
+					assert.Equal(t, "true", s.Tag(tagErrored))
+				} else {
+					assert.Nil(t, s.Tag(tagErrored))
+				}
+				idx := make(map[string]string)
+				for _, v := range s.Logs() {
+					idx[v.Fields[0].Key] = v.Fields[0].ValueString
+				}
+				if spec.expWrites[i] == "" {
+					assert.Empty(t, idx[logRawStoreIO])
+				} else {
+					assert.Contains(t, idx[logRawStoreIO], `"operation":"write"`)
+					assert.Equal(t, 1, countLines(idx[logRawStoreIO]))
+				}
+			}
+			// events of failed or panicked decorators are not passed on
+			var parentEvents []any
+			for _, v := range parent.Logs() {
+				if v.Fields[0].Key == logRawEvents {
+					require.NoError(t, json.Unmarshal([]byte(v.Fields[0].ValueString), &parentEvents))
+				}
+			}
+			assert.Len(t, parentEvents, spec.expEvents)
+			if !spec.expPanic {
+				assert.Len(t, execCtx.EventManager().Events(), spec.expEvents)
+			}
+		})
+	}
+}
+
+type mockAnteDecorator func(ctx sdk.Context, tx sdk.Tx, simulate bool, next sdk.AnteHandler) (sdk.Context, error)
+
+func (m mockAnteDecorator) AnteHandle(ctx sdk.Context, tx sdk.Tx, simulate bool, next sdk.AnteHandler) (sdk.Context, error) {
+	return m(ctx, tx, simulate, next)
+}
+
+func countLines(s string) int {
+	if s == "" {
+		return 0
+	}
+	var n int
+	for _, l := range []byte(s) {
+		if l == '\n' {
+			n++
+		}
+	}
+	return n + 1
+}
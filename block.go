@@ -0,0 +1,254 @@
+package tracing
+
+import (
+	"sync"
+	"time"
+
+	abci "github.com/cometbft/cometbft/abci/types"
+	"github.com/cometbft/cometbft/crypto/tmhash"
+	cmttypes "github.com/cometbft/cometbft/libs/bytes"
+	"github.com/cometbft/cometbft/libs/log"
+	tmproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	"github.com/cosmos/cosmos-sdk/store/rootmulti"
+	storetypes "github.com/cosmos/cosmos-sdk/store/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/opentracing/opentracing-go"
+)
+
+// BlockOperationName is the operation name of the block root span
+const BlockOperationName = "block"
+
+const (
+	tagProposer      = "proposer"
+	tagTxCount       = "tx_count"
+	tagFailedTxCount = "failed_tx_count"
+	tagTotalGas      = "total_gas"
+)
+
+// ABCIBlockApp are the ABCI methods of the block lifecycle. Implemented by the baseapp
+type ABCIBlockApp interface {
+	BeginBlock(req abci.RequestBeginBlock) abci.ResponseBeginBlock
+	DeliverTx(req abci.RequestDeliverTx) abci.ResponseDeliverTx
+	EndBlock(req abci.RequestEndBlock) abci.ResponseEndBlock
+	Commit() abci.ResponseCommit
+}
+
+// blockSpan is the root span of the block that is processed. The span is started at begin block when the block is
+// sampled or by the first sampled descendant otherwise, so that sampled txs always have the block as parent.
+type blockSpan struct {
+	mx            sync.Mutex
+	span          opentracing.Span
+	header        tmproto.Header
+	clock         *BlockTimeClock
+	txCount       int
+	failedTxCount int
+	totalGas      int64
+}
+
+// start returns the span and starts it with the block time on the first call
+func (b *blockSpan) start() opentracing.Span {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	if b.span == nil {
+		blockTime := b.header.Time.UTC()
+		span := opentracing.StartSpan(BlockOperationName, opentracing.StartTime(blockTime))
+		span.SetTag(tagBlockHeight, b.header.Height).
+			SetTag(tagProposer, sdk.ConsAddress(b.header.ProposerAddress).String())
+		b.span = newBlockClockSpan(span, b.clock)
+	}
+	return b.span
+}
+
+// started returns the span or nil when it was not started
+func (b *blockSpan) started() opentracing.Span {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.span
+}
+
+var (
+	activeBlockMx sync.Mutex
+	activeBlock   *blockSpan
+)
+
+func setActiveBlock(b *blockSpan) {
+	activeBlockMx.Lock()
+	defer activeBlockMx.Unlock()
+	activeBlock = b
+}
+
+func getActiveBlock() *blockSpan {
+	activeBlockMx.Lock()
+	defer activeBlockMx.Unlock()
+	return activeBlock
+}
+
+// withBlockSpan returns the context with the block and block clock set, so that new spans are children of the block
+// span. A block span that is not started yet is started by the first sampled span of the context.
+// The context is returned unchanged when no block is active.
+func withBlockSpan(ctx sdk.Context) sdk.Context {
+	b := getActiveBlock()
+	if b == nil {
+		return ctx
+	}
+	ctx = ctx.WithValue(clockKey, b.clock).WithValue(blockKey, b)
+	if span := b.started(); span != nil {
+		ctx = ctx.WithContext(opentracing.ContextWithSpan(ctx.Context(), span))
+	}
+	return ctx
+}
+
+// startBlockSpan returns the context with the block span as parent when the context has a block but no parent span.
+// The block span is started when not started yet. The context is returned unchanged otherwise.
+func startBlockSpan(ctx sdk.Context) sdk.Context {
+	b, ok := ctx.Value(blockKey).(*blockSpan)
+	if !ok || opentracing.SpanFromContext(ctx.Context()) != nil {
+		return ctx
+	}
+	return ctx.WithContext(opentracing.ContextWithSpan(ctx.Context(), b.start()))
+}
+
+var _ ABCIBlockApp = &TraceBlockApp{}
+
+// TraceBlockApp is a decorator to the ABCI block lifecycle methods that adds a block root span from
+// BeginBlock until Commit. Begin/ end block and tx spans are children of it.
+type TraceBlockApp struct {
+	other     ABCIBlockApp
+	deliverTx DeliverTxFn
+	// commit is nil when the commit phase is not traced per store
+	commit *commitTracer
+	// writeSet is nil when the block write sets are not recorded
+	writeSet *writeSetRecorder
+	// gasProfile is nil when the block gas profiles are not recorded
+	gasProfile *gasProfileRecorder
+	logger     log.Logger
+}
+
+// commitMultiStoreApp is implemented by the baseapp
+type commitMultiStoreApp interface {
+	CommitMultiStore() storetypes.CommitMultiStore
+}
+
+// loggerApp is implemented by the baseapp
+type loggerApp interface {
+	Logger() log.Logger
+}
+
+// NewTraceBlockApp constructor. When other is a baseapp with a root multistore, write listeners are added to the
+// persistent stores of the keys to trace the commit per store and the block write sets are recorded when a write set
+// dir is configured. The block gas profiles are recorded when a gas profile dir or a gas report window is configured.
+// This must be called before the chain is initialized or the first block begins.
+func NewTraceBlockApp(other ABCIBlockApp, keys map[string]*storetypes.KVStoreKey) ABCIBlockApp {
+	if !tracerEnabled {
+		return other
+	}
+	t := &TraceBlockApp{other: other, deliverTx: TraceDeliverTx(other.DeliverTx), logger: log.NewNopLogger()}
+	if app, ok := other.(loggerApp); ok {
+		t.logger = app.Logger().With("module", "cosmos-tracing")
+	}
+	if app, ok := other.(commitMultiStoreApp); ok && len(keys) != 0 {
+		if rs, ok := app.CommitMultiStore().(*rootmulti.Store); ok {
+			var listeners []storetypes.WriteListener
+			if tracerConfig.WriteSetDir != "" {
+				t.writeSet = newWriteSetRecorder(tracerConfig.WriteSetDir)
+				activeWriteSet = t.writeSet
+				listeners = append(listeners, t.writeSet)
+			}
+			t.commit = newCommitTracer(rs, keys, listeners...)
+		}
+	}
+	if tracerConfig.GasProfileDir != "" || tracerConfig.GasReportBlocks != 0 {
+		var report *gasReport
+		if tracerConfig.GasReportBlocks != 0 {
+			report = newGasReport(tracerConfig.GasReportBlocks)
+			activeGasReport = report
+		}
+		t.gasProfile = newGasProfileRecorder(tracerConfig.GasProfileDir, report)
+		activeGasProfile = t.gasProfile
+	}
+	return t
+}
+
+// BeginBlock starts the block span
+func (t *TraceBlockApp) BeginBlock(req abci.RequestBeginBlock) abci.ResponseBeginBlock {
+	setActiveBlock(nil)
+	if t.writeSet != nil {
+		t.writeSet.startBlock(req.Header.Height)
+	}
+	if t.gasProfile != nil {
+		t.gasProfile.startBlock(req.Header.Height)
+	}
+	b := &blockSpan{header: req.Header, clock: NewBlockTimeClock(time.Now(), req.Header.Time.UTC())}
+	if shouldSampleBlock(SamplingParams{Operation: BlockOperationName, Height: req.Header.Height}) {
+		b.start()
+	}
+	setActiveBlock(b)
+	return t.other.BeginBlock(req)
+}
+
+// DeliverTx delivers the tx within a tx root span and counts the result for the block span
+func (t *TraceBlockApp) DeliverTx(req abci.RequestDeliverTx) abci.ResponseDeliverTx {
+	if t.writeSet != nil || t.gasProfile != nil {
+		txHash := cmttypes.HexBytes(tmhash.Sum(req.Tx)).String()
+		if t.writeSet != nil {
+			t.writeSet.startTx(txHash)
+			defer t.writeSet.endTx()
+		}
+		if t.gasProfile != nil {
+			t.gasProfile.startTx(txHash)
+			defer t.gasProfile.endTx()
+		}
+	}
+	rsp := t.deliverTx(req)
+	if b := getActiveBlock(); b != nil {
+		b.txCount++
+		if rsp.Code != 0 {
+			b.failedTxCount++
+		}
+		b.totalGas += rsp.GasUsed
+	}
+	return rsp
+}
+
+// EndBlock passes through. The module spans are parented by the TraceModuleManager
+func (t *TraceBlockApp) EndBlock(req abci.RequestEndBlock) abci.ResponseEndBlock {
+	return t.other.EndBlock(req)
+}
+
+// Commit traces the commit phase and finishes the block span
+func (t *TraceBlockApp) Commit() abci.ResponseCommit {
+	start := time.Now()
+	rsp := t.other.Commit()
+	end := time.Now()
+	var commits []storeCommit
+	if t.commit != nil {
+		commits = t.commit.commits()
+	}
+	if t.writeSet != nil {
+		if err := t.writeSet.flush(); err != nil {
+			t.logger.Error("failed to write the block write set", "err", err)
+		}
+	}
+	if t.gasProfile != nil {
+		if err := t.gasProfile.flush(); err != nil {
+			t.logger.Error("failed to write the block gas profile", "err", err)
+		}
+	}
+	b := getActiveBlock()
+	if b == nil {
+		return rsp
+	}
+	setActiveBlock(nil)
+	span := b.started()
+	if span == nil {
+		// neither the block nor any descendant was sampled
+		return rsp
+	}
+	traceCommit(b, start, end, rsp.Data, commits)
+	span.SetTag(tagAppHash, cmttypes.HexBytes(rsp.Data).String()).
+		SetTag(tagTxCount, b.txCount).
+		SetTag(tagFailedTxCount, b.failedTxCount).
+		SetTag(tagTotalGas, b.totalGas)
+	span.FinishWithOptions(opentracing.FinishOptions{FinishTime: b.clock.Now(time.Now())})
+	return rsp
+}
@@ -0,0 +1,175 @@
+package tracing
+
+import (
+	"testing"
+
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	abci "github.com/cometbft/cometbft/abci/types"
+	"github.com/cometbft/cometbft/libs/rand"
+	tmproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/address"
+	"github.com/cosmos/cosmos-sdk/types/module"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceBlockApp(t *testing.T) {
+	tracerEnabled = true
+	t.Cleanup(func() { tracerEnabled = false })
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+
+	ctx, enc, _ := createMinTestInput(t)
+	sender := sdk.AccAddress(rand.Bytes(address.Len))
+	tx := mockTx{msgs: []sdk.Msg{&banktypes.MsgSend{FromAddress: sender.String(), ToAddress: sender.String()}}}
+	ante := NewTraceAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (sdk.Context, error) {
+		return ctx, nil
+	}, enc)
+	mm := NewTraceModuleManager(module.NewManager(), enc)
+	app := NewTraceBlockApp(&mockBlockApp{
+		beginBlockFn: func(req abci.RequestBeginBlock) abci.ResponseBeginBlock {
+			return mm.BeginBlock(ctx, req)
+		},
+		deliverTxFn: func(req abci.RequestDeliverTx) abci.ResponseDeliverTx {
+			_, err := ante(ctx.WithTxBytes(req.Tx), tx, false)
+			require.NoError(t, err)
+			if string(req.Tx) == "failing-tx" {
+				return abci.ResponseDeliverTx{Code: 1, GasUsed: 1}
+			}
+			return abci.ResponseDeliverTx{GasUsed: 100}
+		},
+		endBlockFn: func(req abci.RequestEndBlock) abci.ResponseEndBlock {
+			return mm.EndBlock(ctx, req)
+		},
+	}, nil)
+	proposer := sdk.ConsAddress(rand.Bytes(address.Len))
+
+	// when
+	app.BeginBlock(abci.RequestBeginBlock{Header: tmproto.Header{Height: ctx.BlockHeight(), Time: ctx.BlockTime(), ProposerAddress: proposer}})
+	app.DeliverTx(abci.RequestDeliverTx{Tx: []byte("my-tx")})
+	app.DeliverTx(abci.RequestDeliverTx{Tx: []byte("failing-tx")})
+	app.EndBlock(abci.RequestEndBlock{Height: ctx.BlockHeight()})
+	app.Commit()
+
+	// then
+	spans := tracer.FinishedSpans()
+	var gotOps []string
+	for _, s := range spans {
+		gotOps = append(gotOps, s.OperationName)
+	}
+	assert.Equal(t, []string{ABCIBeginBlockOperationName, "ante_handler", "tx", "ante_handler", "tx", ABCIEndBlockOperationName, CommitOperationName, BlockOperationName}, gotOps)
+	block := spans[len(spans)-1]
+	for _, i := range []int{0, 2, 4, 5, 6} {
+		assert.Equal(t, block.SpanContext.SpanID, spans[i].ParentID, spans[i].OperationName)
+	}
+	assert.Equal(t, spans[2].SpanContext.SpanID, spans[1].ParentID)
+	assert.Equal(t, ctx.BlockTime(), block.StartTime)
+	assert.Equal(t, ctx.BlockHeight(), block.Tag(tagBlockHeight))
+	assert.Equal(t, proposer.String(), block.Tag(tagProposer))
+	assert.Equal(t, 2, block.Tag(tagTxCount))
+	assert.Equal(t, 1, block.Tag(tagFailedTxCount))
+	assert.Equal(t, int64(101), block.Tag(tagTotalGas))
+	assert.Nil(t, getActiveBlock())
+}
+
+func TestTraceBlockAppSampling(t *testing.T) {
+	tracerEnabled = true
+	t.Cleanup(func() {
+		tracerEnabled = false
+		SetSampler(nil)
+	})
+	const myContract = "wasm1abc"
+	ctx, enc, _ := createMinTestInput(t)
+	sender := sdk.AccAddress(rand.Bytes(address.Len))
+	ante := NewTraceAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (sdk.Context, error) {
+		return ctx, nil
+	}, enc)
+	specs := map[string]struct {
+		defaultAction SamplingAction
+		contract      string
+		expOps        []string
+	}{
+		"drop default, contract rule matches": {
+			defaultAction: SamplingAction{Type: SamplingActionDrop},
+			contract:      myContract,
+			expOps:        []string{"ante_handler", "tx", CommitOperationName, BlockOperationName},
+		},
+		"drop default, other contract": {
+			defaultAction: SamplingAction{Type: SamplingActionDrop},
+			contract:      "wasm1def",
+		},
+		"rate limited default, contract rule matches": {
+			defaultAction: SamplingAction{Type: SamplingActionRateLimiting, Param: 1},
+			contract:      myContract,
+			expOps:        []string{"ante_handler", "tx", CommitOperationName, BlockOperationName},
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			tracer := mocktracer.New()
+			opentracing.SetGlobalTracer(tracer)
+			SetSampler(NewSampler(spec.defaultAction, SamplingRule{
+				Contracts: []string{myContract},
+				Action:    SamplingAction{Type: SamplingActionRateLimiting, Param: 1},
+			}))
+			tx := mockTx{msgs: []sdk.Msg{&wasmtypes.MsgExecuteContract{Sender: sender.String(), Contract: spec.contract}}}
+			app := NewTraceBlockApp(&mockBlockApp{
+				beginBlockFn: func(req abci.RequestBeginBlock) abci.ResponseBeginBlock { return abci.ResponseBeginBlock{} },
+				deliverTxFn: func(req abci.RequestDeliverTx) abci.ResponseDeliverTx {
+					_, err := ante(ctx.WithTxBytes(req.Tx), tx, false)
+					require.NoError(t, err)
+					return abci.ResponseDeliverTx{GasUsed: 100}
+				},
+				endBlockFn: func(req abci.RequestEndBlock) abci.ResponseEndBlock { return abci.ResponseEndBlock{} },
+			}, nil)
+
+			// when
+			app.BeginBlock(abci.RequestBeginBlock{Header: tmproto.Header{Height: ctx.BlockHeight(), Time: ctx.BlockTime()}})
+			app.DeliverTx(abci.RequestDeliverTx{Tx: []byte("my-tx")})
+			app.EndBlock(abci.RequestEndBlock{Height: ctx.BlockHeight()})
+			app.Commit()
+
+			// then
+			spans := tracer.FinishedSpans()
+			var gotOps []string
+			for _, s := range spans {
+				gotOps = append(gotOps, s.OperationName)
+			}
+			assert.Equal(t, spec.expOps, gotOps)
+			if len(spans) == 0 {
+				return
+			}
+			block := spans[len(spans)-1]
+			assert.Equal(t, block.SpanContext.SpanID, spans[1].ParentID)
+			assert.Equal(t, ctx.BlockTime(), block.StartTime)
+			assert.Equal(t, ctx.BlockHeight(), block.Tag(tagBlockHeight))
+			assert.Equal(t, 1, block.Tag(tagTxCount))
+		})
+	}
+}
+
+type mockBlockApp struct {
+	beginBlockFn func(req abci.RequestBeginBlock) abci.ResponseBeginBlock
+	deliverTxFn  func(req abci.RequestDeliverTx) abci.ResponseDeliverTx
+	endBlockFn   func(req abci.RequestEndBlock) abci.ResponseEndBlock
+}
+
+func (m mockBlockApp) BeginBlock(req abci.RequestBeginBlock) abci.ResponseBeginBlock {
+	return m.beginBlockFn(req)
+}
+
+func (m mockBlockApp) DeliverTx(req abci.RequestDeliverTx) abci.ResponseDeliverTx {
+	return m.deliverTxFn(req)
+}
+
+func (m mockBlockApp) EndBlock(req abci.RequestEndBlock) abci.ResponseEndBlock {
+	return m.endBlockFn(req)
+}
+
+func (m mockBlockApp) Commit() abci.ResponseCommit {
+	return abci.ResponseCommit{}
+}
@@ -1,11 +1,23 @@
 package tracing
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 
+	"github.com/cometbft/cometbft/libs/log"
+	"github.com/cosmos/cosmos-sdk/server"
 	"github.com/opentracing/opentracing-go"
 	"github.com/spf13/cobra"
-	"github.com/uber/jaeger-client-go"
 	"github.com/uber/jaeger-client-go/config"
 	"github.com/uber/jaeger-lib/metrics"
 )
@@ -14,8 +26,24 @@ func RunWithTracer(startCmd *cobra.Command, appName string) {
 	otherRunE := startCmd.RunE
 	var tracer io.Closer
 	startCmd.RunE = func(cmd *cobra.Command, args []string) error {
-		if hasTracerFlagSet(cmd) {
-			tracer = StartTracer(appName)
+		serverCtx := server.GetServerContextFromCmd(cmd)
+		cfg, err := ParseTracerConfig(serverCtx.Viper)
+		if err != nil {
+			return err
+		}
+		if cfg.Enabled {
+			if cfg.ServiceName == "" {
+				cfg.ServiceName = appName
+			}
+			if cfg.FileDir == "" {
+				cfg.FileDir = filepath.Join(serverCtx.Config.RootDir, "traces")
+			}
+			if cfg.StoreDir == "" {
+				cfg.StoreDir = filepath.Join(serverCtx.Config.RootDir, "data")
+			}
+			if tracer, err = StartTracerWithConfig(cfg, serverCtx.Logger); err != nil {
+				return err
+			}
 		}
 		return otherRunE(cmd, args)
 	}
@@ -31,36 +59,278 @@ func RunWithTracer(startCmd *cobra.Command, appName string) {
 	AddModuleInitFlags(startCmd)
 }
 
-// todo: make this configurable
+// StartTracer starts the jaeger tracer with default settings. Reported spans are logged to stdout
 func StartTracer(appName string) io.Closer {
-	// Sample configuration for testing. Use constant sampling to sample every trace
-	// and enable LogSpan to log every span via configured Logger.
-	cfg := config.Configuration{
-		ServiceName: appName,
+	cfg := DefaultTracerConfig()
+	cfg.ServiceName = appName
+	closer, err := StartTracerWithConfig(cfg, log.NewTMLogger(log.NewSyncWriter(os.Stdout)))
+	if err != nil {
+		panic(err.Error())
+	}
+	return closer
+}
+
+// StartTracerWithConfig starts the tracer backend as configured and registers it as global opentracing tracer.
+// Reported spans are logged to the logger when LogSpans is set.
+func StartTracerWithConfig(cfg TracerConfig, logger log.Logger) (io.Closer, error) {
+	if err := cfg.ValidateBasic(); err != nil {
+		return nil, err
+	}
+	var closer io.Closer
+	var err error
+	if cfg.Exporter == ExporterJaeger {
+		closer, err = startJaegerTracer(cfg, logger)
+	} else {
+		closer, err = StartOTelTracer(cfg, logger)
+	}
+	if err != nil || !cfg.TailSampling {
+		return closer, err
+	}
+	tracer := NewTailSamplingTracer(opentracing.GlobalTracer(), cfg.TailMinDuration, cfg.TailMaxBufferBytes)
+	opentracing.SetGlobalTracer(tracer)
+	return closerFunc(func() error {
+		tracer.Flush()
+		return closer.Close()
+	}), nil
+}
+
+func startJaegerTracer(cfg TracerConfig, logger log.Logger) (io.Closer, error) {
+	jCfg := config.Configuration{
+		ServiceName: cfg.ServiceName,
 		Sampler: &config.SamplerConfig{
-			Type:  jaeger.SamplerTypeConst,
-			Param: 1,
+			Type:  cfg.SamplerType,
+			Param: cfg.SamplerParam,
 		},
 		Reporter: &config.ReporterConfig{
-			LogSpans:  true,
-			QueueSize: 100,
+			LogSpans:            cfg.LogSpans,
+			QueueSize:           cfg.QueueSize,
+			BufferFlushInterval: cfg.FlushInterval,
+			LocalAgentHostPort:  cfg.AgentEndpoint,
+			CollectorEndpoint:   cfg.CollectorEndpoint,
 		},
 	}
 
-	// Example logger and metrics factory. Use github.com/uber/jaeger-client-go/log
-	// and github.com/uber/jaeger-lib/metrics respectively to bind to real logging and metrics
-	// frameworks.
-	// jLogger := jaegerlog.StdLogger
+	// Example metrics factory. Use github.com/uber/jaeger-lib/metrics to bind to a real metrics framework.
 	jMetricsFactory := metrics.NullFactory
 	// Initialize tracer with a logger and a metrics factory
-	tracer, closer, err := cfg.NewTracer(
-		// jaegercfg.Logger(jLogger),
+	tracer, closer, err := jCfg.NewTracer(
+		config.Logger(jaegerLogger{logger: logger}),
 		config.Metrics(jMetricsFactory),
 	)
 	if err != nil {
-		panic(err.Error())
+		return nil, err
 	}
 	// Set the singleton opentracing.Tracer with the Jaeger tracer.
 	opentracing.SetGlobalTracer(tracer)
-	return closer
+	return closer, nil
+}
+
+// TracingCommands returns the cosmos-tracing tool commands
+func TracingCommands() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tracing",
+		Short: "Cosmos-tracing tools",
+	}
+	cmd.AddCommand(ReplayCmd(), DiffWriteSetsCmd(), GasReportCmd())
+	return cmd
+}
+
+// ReplayCmd replays the files of the file exporter into the configured tracer backend
+func ReplayCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay [file or dir]...",
+		Short: "Replay span files of the file exporter into the configured tracer backend",
+		Long: `Replay span files of the file exporter into the configured tracer backend.
+For a dir, all span files within are replayed in name order. The backend settings are read from the
+[cosmos-tracing] section of the app.toml and the flags.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := server.GetServerContextFromCmd(cmd).Viper
+			if err := v.BindPFlags(cmd.Flags()); err != nil {
+				return err
+			}
+			cfg, err := ParseTracerConfig(v)
+			if err != nil {
+				return err
+			}
+			if cfg.Exporter == ExporterFile {
+				return errors.New("can not replay into the file exporter")
+			}
+			if cfg.Exporter == ExporterStore && cfg.StoreDir == "" {
+				cfg.StoreDir = filepath.Join(server.GetServerContextFromCmd(cmd).Config.RootDir, "data")
+			}
+			if cfg.ServiceName == "" {
+				cfg.ServiceName = "cosmos-tracing-replay"
+			}
+			cfg.TailSampling = false
+			paths, err := spanFilePaths(args)
+			if err != nil {
+				return err
+			}
+			closer, err := StartTracerWithConfig(cfg, server.GetServerContextFromCmd(cmd).Logger)
+			if err != nil {
+				return err
+			}
+			count, err := ReplaySpanFiles(opentracing.GlobalTracer(), paths...)
+			if closeErr := closer.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+			cmd.Printf("replayed %d spans from %d files\n", count, len(paths))
+			return nil
+		},
+	}
+	AddModuleInitFlags(cmd)
+	return cmd
+}
+
+// DiffWriteSetsCmd reports the first differing write of two write set recordings
+func DiffWriteSetsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "diff-writesets [file or dir] [file or dir]",
+		Short: "Report the first differing write of two write set recordings",
+		Long: `Report the first differing write of two write set recordings with the tx, message and contract
+that wrote it. For dirs, the write sets of the heights recorded in both are compared in height order.
+Use it with the write-set-dir of two nodes to debug an app hash divergence.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pairs, err := writeSetFilePairs(args[0], args[1])
+			if err != nil {
+				return err
+			}
+			for _, p := range pairs {
+				a, err := ReadWriteSetFile(p[0])
+				if err != nil {
+					return err
+				}
+				b, err := ReadWriteSetFile(p[1])
+				if err != nil {
+					return err
+				}
+				d := DiffWriteSets(a, b)
+				if d == nil {
+					continue
+				}
+				cmd.Printf("first difference at height %d in store %q key %s\n", d.Height, d.Store, d.Key)
+				cmd.Printf("  %s: %s\n", p[0], d.A)
+				cmd.Printf("  %s: %s\n", p[1], d.B)
+				cmd.SilenceUsage = true
+				return errors.New("write sets differ")
+			}
+			cmd.Printf("no difference in %d write sets\n", len(pairs))
+			return nil
+		},
+	}
+}
+
+// flags of the gas report command
+const (
+	flagGasReportNode    = "node-api"
+	flagGasReportGroupBy = "group-by"
+	flagGasReportLimit   = "limit"
+	flagGasReportOutput  = "output"
+)
+
+// GasReportCmd prints the gas report of a running Tracing-Node
+func GasReportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gas-report",
+		Short: "Print the gas attribution of the recent blocks of a running node",
+		Long: `Print the gas consumed in the recent blocks of a running node attributed to module, message type,
+contract, code id and gas descriptor. The node must have the gas-report-blocks set and the gas report routes
+registered at the API server.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			node, _ := cmd.Flags().GetString(flagGasReportNode)
+			groupBy, _ := cmd.Flags().GetString(flagGasReportGroupBy)
+			limit, _ := cmd.Flags().GetInt(flagGasReportLimit)
+			output, _ := cmd.Flags().GetString(flagGasReportOutput)
+			fields, err := ParseGasReportGroupBy(groupBy)
+			if err != nil {
+				return err
+			}
+			q := url.Values{}
+			q.Set("group_by", strings.Join(fields, ","))
+			if limit > 0 {
+				q.Set("limit", strconv.Itoa(limit))
+			}
+			rsp, err := http.Get(strings.TrimSuffix(node, "/") + "/cosmos-tracing/v1/gas-report?" + q.Encode()) //nolint:gosec // user provided node address
+			if err != nil {
+				return err
+			}
+			defer rsp.Body.Close()
+			bz, err := io.ReadAll(rsp.Body)
+			if err != nil {
+				return err
+			}
+			if rsp.StatusCode != http.StatusOK {
+				return fmt.Errorf("gas report: %s: %s", rsp.Status, strings.TrimSpace(string(bz)))
+			}
+			if output == "json" {
+				cmd.Println(string(bz))
+				return nil
+			}
+			var report GasReport
+			if err := json.Unmarshal(bz, &report); err != nil {
+				return err
+			}
+			return printGasReport(cmd.OutOrStdout(), report)
+		},
+	}
+	cmd.Flags().String(flagGasReportNode, "http://localhost:1317", "API server address of the node")
+	cmd.Flags().String(flagGasReportGroupBy, "", "Comma separated fields to group by: module, msg_type, contract, code_id, descriptor. All when empty")
+	cmd.Flags().Int(flagGasReportLimit, 0, "Max number of rows. All when 0")
+	cmd.Flags().String(flagGasReportOutput, "text", "Output format: text or json")
+	return cmd
+}
+
+// printGasReport prints the report as table
+func printGasReport(out io.Writer, report GasReport) error {
+	fmt.Fprintf(out, "blocks %d to %d (%d blocks)\n", report.FromHeight, report.ToHeight, report.Blocks)
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	header := make([]string, 0, len(report.GroupBy)+3)
+	for _, f := range report.GroupBy {
+		header = append(header, strings.ToUpper(f))
+	}
+	fmt.Fprintln(w, strings.Join(append(header, "GAS", "REFUNDED", "COUNT"), "\t"))
+	for _, r := range report.Rows {
+		cols := make([]string, 0, len(header))
+		for _, f := range report.GroupBy {
+			v := r.Field(f)
+			if v == "" {
+				v = "-"
+			}
+			cols = append(cols, v)
+		}
+		cols = append(cols, strconv.FormatUint(r.Gas, 10), strconv.FormatUint(r.Refunded, 10), strconv.FormatUint(r.Count, 10))
+		fmt.Fprintln(w, strings.Join(cols, "\t"))
+	}
+	return w.Flush()
+}
+
+// spanFilePaths expands dirs to the span files within
+func spanFilePaths(args []string) ([]string, error) {
+	var paths []string
+	for _, a := range args {
+		info, err := os.Stat(a)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, a)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(a, spanFilePrefix+"*"+spanFileExt+"*"))
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no span files in %s", a)
+		}
+		sort.Strings(matches)
+		paths = append(paths, matches...)
+	}
+	return paths, nil
 }
@@ -0,0 +1,145 @@
+package tracing
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	cmttypes "github.com/cometbft/cometbft/libs/bytes"
+	"github.com/cosmos/cosmos-sdk/store/rootmulti"
+	storetypes "github.com/cosmos/cosmos-sdk/store/types"
+	"github.com/opentracing/opentracing-go"
+)
+
+const (
+	CommitOperationName      = "commit"
+	CommitStoreOperationName = "commit_store"
+)
+
+const (
+	tagAppHash           = "app_hash"
+	tagStoreName         = "store"
+	tagStoreSets         = "sets"
+	tagStoreDeletes      = "deletes"
+	tagStoreBytesWritten = "bytes_written"
+	tagStoreHash         = "store_hash"
+)
+
+// commitTracer captures the commit phase per persistent store of the root multistore. Writes are observed by store
+// listeners, the resulting store hashes are read after the commit. The root multistore of the app is not replaced.
+type commitTracer struct {
+	rs       *rootmulti.Store
+	listener *commitWriteListener
+}
+
+// newCommitTracer registers the write listener and the other listeners, like the write set recorder, on the stores
+func newCommitTracer(rs *rootmulti.Store, keys map[string]*storetypes.KVStoreKey, others ...storetypes.WriteListener) *commitTracer {
+	t := &commitTracer{rs: rs, listener: &commitWriteListener{stats: make(map[string]storeWriteStats)}}
+	listeners := append([]storetypes.WriteListener{t.listener}, others...)
+	for _, key := range keys {
+		rs.AddListeners(key, listeners)
+	}
+	return t
+}
+
+// commits returns the writes since the last call and the resulting hash per persistent store of the last commit
+func (t *commitTracer) commits() []storeCommit {
+	return storeCommits(t.rs, t.listener.reset())
+}
+
+// storeCommits returns the write stats and the last commit hash of the persistent stores in name order
+func storeCommits(rs *rootmulti.Store, writes map[string]storeWriteStats) []storeCommit {
+	keysByName := rs.StoreKeysByName()
+	names := make([]string, 0, len(keysByName))
+	for name := range keysByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	commits := make([]storeCommit, 0, len(names))
+	for _, name := range names {
+		store := rs.GetCommitKVStore(keysByName[name])
+		switch {
+		case store == nil,
+			store.GetStoreType() == storetypes.StoreTypeTransient,
+			store.GetStoreType() == storetypes.StoreTypeMemory:
+			continue
+		}
+		w := writes[name]
+		commits = append(commits, storeCommit{
+			Store:        name,
+			Sets:         w.sets,
+			Deletes:      w.deletes,
+			BytesWritten: w.bytesWritten,
+			Hash:         store.LastCommitID().Hash,
+		})
+	}
+	return commits
+}
+
+// storeCommit is the captured commit of a single store
+type storeCommit struct {
+	Store        string
+	Sets         int
+	Deletes      int
+	BytesWritten int
+	Hash         cmttypes.HexBytes
+}
+
+type storeWriteStats struct {
+	sets, deletes, bytesWritten int
+}
+
+var _ storetypes.WriteListener = &commitWriteListener{}
+
+// commitWriteListener counts the writes to the persistent stores per store name
+type commitWriteListener struct {
+	mx    sync.Mutex
+	stats map[string]storeWriteStats
+}
+
+// OnWrite implements storetypes.WriteListener
+func (l *commitWriteListener) OnWrite(storeKey storetypes.StoreKey, key, value []byte, delete bool) error {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	s := l.stats[storeKey.Name()]
+	if delete {
+		s.deletes++
+	} else {
+		s.sets++
+	}
+	s.bytesWritten += len(key) + len(value)
+	l.stats[storeKey.Name()] = s
+	return nil
+}
+
+func (l *commitWriteListener) reset() map[string]storeWriteStats {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	r := l.stats
+	l.stats = make(map[string]storeWriteStats, len(r))
+	return r
+}
+
+// traceCommit adds the commit span with a child span per committed store to the block span.
+// The span covers the whole commit including the flush of the block state and the pruning. The stores are saved
+// together by the root multistore, so the store spans cover the whole commit as well and carry no save time per store.
+func traceCommit(b *blockSpan, start, end time.Time, appHash []byte, commits []storeCommit) {
+	startTime, finishTime := b.clock.Now(start), b.clock.Now(end)
+	span := opentracing.StartSpan(CommitOperationName,
+		opentracing.ChildOf(b.started().Context()),
+		opentracing.StartTime(startTime),
+	)
+	span.SetTag(tagAppHash, cmttypes.HexBytes(appHash).String())
+	for _, c := range commits {
+		opentracing.StartSpan(CommitStoreOperationName,
+			opentracing.ChildOf(span.Context()),
+			opentracing.StartTime(startTime),
+		).SetTag(tagStoreName, c.Store).
+			SetTag(tagStoreSets, c.Sets).
+			SetTag(tagStoreDeletes, c.Deletes).
+			SetTag(tagStoreBytesWritten, c.BytesWritten).
+			SetTag(tagStoreHash, c.Hash.String()).
+			FinishWithOptions(opentracing.FinishOptions{FinishTime: finishTime})
+	}
+	span.FinishWithOptions(opentracing.FinishOptions{FinishTime: finishTime})
+}
@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"testing"
+	"time"
+
+	dbm "github.com/cometbft/cometbft-db"
+	abci "github.com/cometbft/cometbft/abci/types"
+	cmttypes "github.com/cometbft/cometbft/libs/bytes"
+	"github.com/cometbft/cometbft/libs/log"
+	tmproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	"github.com/cosmos/cosmos-sdk/baseapp"
+	"github.com/cosmos/cosmos-sdk/store/rootmulti"
+	storetypes "github.com/cosmos/cosmos-sdk/store/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceCommit(t *testing.T) {
+	blockTime := time.Date(2020, time.April, 22, 12, 0, 0, 0, time.UTC)
+	runBlock := func(t *testing.T) []byte {
+		bankKey, wasmKey := sdk.NewKVStoreKey("bank"), sdk.NewKVStoreKey("wasm")
+		bApp := baseapp.NewBaseApp("test", log.NewNopLogger(), dbm.NewMemDB(), nil)
+		app := NewTraceBlockApp(bApp, map[string]*storetypes.KVStoreKey{"bank": bankKey, "wasm": wasmKey})
+		bApp.MountStores(bankKey, wasmKey, sdk.NewTransientStoreKey("transient"))
+		bApp.SetBeginBlocker(func(ctx sdk.Context, _ abci.RequestBeginBlock) abci.ResponseBeginBlock {
+			ctx.KVStore(bankKey).Set([]byte("foo"), []byte("bar"))
+			ctx.KVStore(bankKey).Set([]byte("other"), []byte("value"))
+			ctx.KVStore(wasmKey).Delete([]byte("foo"))
+			return abci.ResponseBeginBlock{}
+		})
+		require.NoError(t, bApp.LoadLatestVersion())
+		// the root multistore is not replaced
+		require.IsType(t, &rootmulti.Store{}, bApp.CommitMultiStore())
+
+		app.BeginBlock(abci.RequestBeginBlock{Header: tmproto.Header{Height: 1, Time: blockTime}})
+		app.EndBlock(abci.RequestEndBlock{Height: 1})
+		return app.Commit().Data
+	}
+	// expected app hash without tracing
+	expAppHash := runBlock(t)
+
+	tracerEnabled = true
+	t.Cleanup(func() { tracerEnabled = false })
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+
+	// when
+	gotAppHash := runBlock(t)
+
+	// then
+	assert.Equal(t, expAppHash, gotAppHash)
+	spans := tracer.FinishedSpans()
+	var gotOps []string
+	for _, s := range spans {
+		gotOps = append(gotOps, s.OperationName)
+	}
+	require.Equal(t, []string{CommitStoreOperationName, CommitStoreOperationName, CommitOperationName, BlockOperationName}, gotOps)
+	bank, wasm, commit, block := spans[0], spans[1], spans[2], spans[3]
+	assert.Equal(t, block.SpanContext.SpanID, commit.ParentID)
+	assert.Equal(t, cmttypes.HexBytes(expAppHash).String(), commit.Tag(tagAppHash))
+	assert.Equal(t, cmttypes.HexBytes(expAppHash).String(), block.Tag(tagAppHash))
+
+	for _, s := range []*mocktracer.MockSpan{bank, wasm} {
+		assert.Equal(t, commit.SpanContext.SpanID, s.ParentID)
+		assert.Equal(t, commit.StartTime, s.StartTime)
+		assert.Equal(t, commit.FinishTime, s.FinishTime)
+		assert.Len(t, s.Tag(tagStoreHash), 64)
+	}
+	assert.Equal(t, "bank", bank.Tag(tagStoreName))
+	assert.Equal(t, 2, bank.Tag(tagStoreSets))
+	assert.Equal(t, 0, bank.Tag(tagStoreDeletes))
+	assert.Equal(t, 16, bank.Tag(tagStoreBytesWritten))
+	assert.Equal(t, "wasm", wasm.Tag(tagStoreName))
+	assert.Equal(t, 0, wasm.Tag(tagStoreSets))
+	assert.Equal(t, 1, wasm.Tag(tagStoreDeletes))
+	assert.Equal(t, 3, wasm.Tag(tagStoreBytesWritten))
+}
@@ -1,49 +1,496 @@
 package tracing
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
 	servertypes "github.com/cosmos/cosmos-sdk/server/types"
-	"github.com/spf13/cast"
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/cobra"
 )
 
-// Module init related flags
+// configSection is the app.toml section and the flag prefix of the tracer config
+const configSection = "cosmos-tracing"
+
+// Module init related flags. The same keys are used in the `[cosmos-tracing]` section of the app.toml
 const (
 	flagOpenTracingEnabled        = "cosmos-tracing.open-tracing"
 	flagSimulationTracingDisabled = "cosmos-tracing.disable-simulation-trace"
+	flagExporter                  = "cosmos-tracing.exporter"
+	flagServiceName               = "cosmos-tracing.service-name"
+	flagAgentEndpoint             = "cosmos-tracing.agent-endpoint"
+	flagCollectorEndpoint         = "cosmos-tracing.collector-endpoint"
+	flagCollectorInsecure         = "cosmos-tracing.collector-insecure"
+	flagSamplerType               = "cosmos-tracing.sampler-type"
+	flagSamplerParam              = "cosmos-tracing.sampler-param"
+	flagQueueSize                 = "cosmos-tracing.queue-size"
+	flagFlushInterval             = "cosmos-tracing.flush-interval"
+	flagLogSpans                  = "cosmos-tracing.log-spans"
+	flagMaxStoreTraced            = "cosmos-tracing.max-store-traced"
+	flagMaxSDKMsgTraced           = "cosmos-tracing.max-sdk-msg-traced"
+	flagMaxSDKLogTraced           = "cosmos-tracing.max-sdk-log-traced"
+	flagMaxIBCPacketDescr         = "cosmos-tracing.max-ibc-packet-descr"
+	flagDefaultMaxLength          = "cosmos-tracing.default-max-length"
+	flagSamplingDefault           = "cosmos-tracing.sampling-default"
+	flagSamplingRules             = "cosmos-tracing.sampling-rules"
+	flagTailSampling              = "cosmos-tracing.tail-sampling"
+	flagFileDir                   = "cosmos-tracing.file-dir"
+	flagFileMaxSize               = "cosmos-tracing.file-max-size"
+	flagFileCompress              = "cosmos-tracing.file-compress"
+	flagStoreDir                  = "cosmos-tracing.store-dir"
+	flagStoreRetainBlocks         = "cosmos-tracing.store-retain-blocks"
+	flagTailMinDuration           = "cosmos-tracing.tail-min-duration"
+	flagTailMaxBufferBytes        = "cosmos-tracing.tail-max-buffer-bytes"
+	flagWriteSetDir               = "cosmos-tracing.write-set-dir"
+	flagStoreCaptureInclude       = "cosmos-tracing.store-capture-include"
+	flagStoreCaptureExclude       = "cosmos-tracing.store-capture-exclude"
+	flagStoreCaptureRules         = "cosmos-tracing.store-capture-rules"
+	flagStoreCaptureUpdates       = "cosmos-tracing.store-capture-updates"
+	flagStoreOpsLog               = "cosmos-tracing.store-ops-log"
+	flagGasProfileDir             = "cosmos-tracing.gas-profile-dir"
+	flagGasReportBlocks           = "cosmos-tracing.gas-report-blocks"
+	flagSimCompareTxs             = "cosmos-tracing.sim-compare-txs"
+	flagGasTraceMode              = "cosmos-tracing.gas-trace-mode"
+	flagGasTraceLast              = "cosmos-tracing.gas-trace-last"
+)
+
+// Supported sampler types
+const (
+	SamplerTypeConst         = "const"
+	SamplerTypeProbabilistic = "probabilistic"
+	SamplerTypeRateLimiting  = "ratelimiting"
 )
 
 var (
 	tracerEnabled      bool
 	disableSimulations bool
+	tracerConfig       = DefaultTracerConfig()
 )
 
+// TracerConfig is the tracer backend configuration
+type TracerConfig struct {
+	// Enabled captures traces and starts the tracer backend
+	Enabled bool `mapstructure:"open-tracing"`
+	// DisableSimulationTrace does not trace simulations
+	DisableSimulationTrace bool `mapstructure:"disable-simulation-trace"`
+	// Exporter is the tracer backend: jaeger, otlp-grpc, otlp-http, file or store
+	Exporter string `mapstructure:"exporter"`
+	// ServiceName used in the traces. Defaults to the app name when empty
+	ServiceName string `mapstructure:"service-name"`
+	// AgentEndpoint is the jaeger agent host:port (UDP). Jaeger default is used when empty
+	AgentEndpoint string `mapstructure:"agent-endpoint"`
+	// CollectorEndpoint is the jaeger collector URL or the OTLP collector host:port.
+	// For jaeger, it takes precedence over the agent endpoint when set
+	CollectorEndpoint string `mapstructure:"collector-endpoint"`
+	// CollectorInsecure disables client transport security for the OTLP exporter
+	CollectorInsecure bool `mapstructure:"collector-insecure"`
+	// FileDir is the output directory of the file exporter. Defaults to `<home>/traces` when empty
+	FileDir string `mapstructure:"file-dir"`
+	// FileMaxSize in bytes (uncompressed) before the file exporter starts a new file
+	FileMaxSize int64 `mapstructure:"file-max-size"`
+	// FileCompress gzips the files of the file exporter
+	FileCompress bool `mapstructure:"file-compress"`
+	// StoreDir is the db directory of the embedded trace store. Defaults to `<home>/data` when empty
+	StoreDir string `mapstructure:"store-dir"`
+	// StoreRetainBlocks is the number of recent heights kept in the embedded trace store. Older traces are pruned.
+	// Nothing is pruned when 0
+	StoreRetainBlocks int `mapstructure:"store-retain-blocks"`
+	// SamplerType is one of const, probabilistic or ratelimiting (jaeger only)
+	SamplerType string `mapstructure:"sampler-type"`
+	// SamplerParam is the sampler type specific value
+	SamplerParam float64 `mapstructure:"sampler-param"`
+	// QueueSize max number of spans in the reporter queue
+	QueueSize int `mapstructure:"queue-size"`
+	// FlushInterval to force flush the reporter queue
+	FlushInterval time.Duration `mapstructure:"flush-interval"`
+	// LogSpans logs every reported span
+	LogSpans bool `mapstructure:"log-spans"`
+	// payload limits. Spans are lost when the log size is too big
+	MaxStoreTraced    int `mapstructure:"max-store-traced"`
+	MaxSDKMsgTraced   int `mapstructure:"max-sdk-msg-traced"`
+	MaxSDKLogTraced   int `mapstructure:"max-sdk-log-traced"`
+	MaxIBCPacketDescr int `mapstructure:"max-ibc-packet-descr"`
+	DefaultMaxLength  int `mapstructure:"default-max-length"`
+	// SamplingDefault is the chain-aware sampling action when no rule matches
+	SamplingDefault string `mapstructure:"sampling-default"`
+	// SamplingRules are chain-aware sampling rules. See ParseSamplingRule for the format
+	SamplingRules []string `mapstructure:"sampling-rules"`
+	// TailSampling buffers the spans of a trace and reports them only when a span was errored or slow
+	TailSampling bool `mapstructure:"tail-sampling"`
+	// TailMinDuration reports traces with a span of this duration or longer in tail sampling mode. Zero disables it
+	TailMinDuration time.Duration `mapstructure:"tail-min-duration"`
+	// TailMaxBufferBytes memory bound for the buffered spans in tail sampling mode
+	TailMaxBufferBytes int `mapstructure:"tail-max-buffer-bytes"`
+	// WriteSetDir is the output directory of the per block write sets. Disabled when empty
+	WriteSetDir string `mapstructure:"write-set-dir"`
+	// StoreCaptureInclude are the store names captured by the spans. All stores are captured when empty.
+	// An entry `<operation>:<store>` applies to the spans of the operation only
+	StoreCaptureInclude []string `mapstructure:"store-capture-include"`
+	// StoreCaptureExclude are the store names that are not captured by the spans.
+	// An entry `<operation>:<store>` applies to the spans of the operation only
+	StoreCaptureExclude []string `mapstructure:"store-capture-exclude"`
+	// StoreCaptureRules override the store capture setting of the spans. See ParseStoreCaptureRule for the format
+	StoreCaptureRules []string `mapstructure:"store-capture-rules"`
+	// StoreCaptureUpdates allows to replace the store capture rules at runtime via the API endpoint. Disabled by default
+	StoreCaptureUpdates bool `mapstructure:"store-capture-updates"`
+	// StoreOpsLog logs the store operations with store name, gas and decoded keys in addition to the raw store io.
+	// Opt-in, disabled by default
+	StoreOpsLog bool `mapstructure:"store-ops-log"`
+	// GasProfileDir is the output directory of the per block gas profiles in pprof format. Disabled when empty
+	GasProfileDir string `mapstructure:"gas-profile-dir"`
+	// GasReportBlocks is the number of recent blocks in the gas report. Disabled when 0
+	GasReportBlocks int `mapstructure:"gas-report-blocks"`
+	// SimCompareTxs is the number of recent simulation results that are kept for the comparison with the
+	// delivered txs. Disabled when 0
+	SimCompareTxs int `mapstructure:"sim-compare-txs"`
+	// GasTraceMode is how the gas usage of the spans is recorded: all or aggregate
+	GasTraceMode string `mapstructure:"gas-trace-mode"`
+	// GasTraceLast is the number of last gas usage entries that are kept in aggregate mode
+	GasTraceLast int `mapstructure:"gas-trace-last"`
+}
+
+// DefaultTracerConfig returns the default settings
+func DefaultTracerConfig() TracerConfig {
+	return TracerConfig{
+		Exporter:           ExporterJaeger,
+		SamplerType:        SamplerTypeConst,
+		SamplerParam:       1,
+		FileMaxSize:        100 << 20,
+		StoreRetainBlocks:  10_000,
+		QueueSize:          100,
+		FlushInterval:      time.Second,
+		LogSpans:           true,
+		MaxStoreTraced:     5_000,
+		MaxSDKMsgTraced:    5_000,
+		MaxSDKLogTraced:    5_000,
+		MaxIBCPacketDescr:  5_000,
+		DefaultMaxLength:   10_000,
+		SamplingDefault:    SamplingActionSample,
+		TailMaxBufferBytes: 64 << 20,
+		GasTraceMode:       GasTraceModeAll,
+		GasTraceLast:       100,
+	}
+}
+
+// ValidateBasic does basic validation of the config values
+func (c TracerConfig) ValidateBasic() error {
+	switch c.Exporter {
+	case ExporterJaeger, ExporterOTLPGRPC, ExporterOTLPHTTP, ExporterFile, ExporterStore:
+	default:
+		return fmt.Errorf("unsupported exporter: %q", c.Exporter)
+	}
+	switch c.SamplerType {
+	case SamplerTypeConst, SamplerTypeProbabilistic:
+	case SamplerTypeRateLimiting:
+		if c.Exporter != ExporterJaeger {
+			return errors.New("ratelimiting sampler is supported with jaeger exporter only")
+		}
+	default:
+		return fmt.Errorf("unsupported sampler type: %q", c.SamplerType)
+	}
+	if c.SamplerParam < 0 {
+		return errors.New("sampler param must not be negative")
+	}
+	if c.FileMaxSize <= 0 {
+		return errors.New("file max size must be positive")
+	}
+	if c.StoreRetainBlocks < 0 {
+		return errors.New("store retain blocks must not be negative")
+	}
+	if c.QueueSize <= 0 {
+		return errors.New("queue size must be positive")
+	}
+	if c.FlushInterval <= 0 {
+		return errors.New("flush interval must be positive")
+	}
+	if c.MaxStoreTraced <= 0 || c.MaxSDKMsgTraced <= 0 || c.MaxSDKLogTraced <= 0 || c.MaxIBCPacketDescr <= 0 || c.DefaultMaxLength <= 0 {
+		return errors.New("payload limits must be positive")
+	}
+	if c.TailMinDuration < 0 {
+		return errors.New("tail min duration must not be negative")
+	}
+	if c.TailSampling && c.TailMaxBufferBytes <= 0 {
+		return errors.New("tail max buffer bytes must be positive")
+	}
+	if _, err := newSamplerFromConfig(c); err != nil {
+		return fmt.Errorf("sampling: %w", err)
+	}
+	if _, err := newStoreCaptureFilter(c.StoreCaptureInclude, c.StoreCaptureExclude); err != nil {
+		return fmt.Errorf("store capture: %w", err)
+	}
+	if _, err := newStoreCapturePolicyFromConfig(c); err != nil {
+		return fmt.Errorf("store capture: %w", err)
+	}
+	if c.GasReportBlocks < 0 {
+		return errors.New("gas report blocks must not be negative")
+	}
+	if c.SimCompareTxs < 0 {
+		return errors.New("sim compare txs must not be negative")
+	}
+	switch c.GasTraceMode {
+	case GasTraceModeAll, GasTraceModeAggregate:
+	default:
+		return fmt.Errorf("unsupported gas trace mode: %q", c.GasTraceMode)
+	}
+	if c.GasTraceLast < 0 {
+		return errors.New("gas trace last must not be negative")
+	}
+	return nil
+}
+
+// DefaultConfigTemplate toml snippet with default values for app.toml
+func DefaultConfigTemplate() string {
+	return ConfigTemplate(DefaultTracerConfig())
+}
+
+// ConfigTemplate toml snippet for app.toml
+func ConfigTemplate(c TracerConfig) string {
+	return fmt.Sprintf(`
+[cosmos-tracing]
+# Capture traces and start the tracer backend
+open-tracing = %t
+
+# Do not trace simulations
+disable-simulation-trace = %t
+
+# Tracer backend: jaeger, otlp-grpc, otlp-http, file or store (embedded trace store with REST endpoints)
+exporter = %q
+
+# Service name in the traces. The app name is used when empty
+service-name = %q
+
+# Jaeger agent host:port (UDP). The jaeger default is used when empty
+agent-endpoint = %q
+
+# Jaeger collector URL or OTLP collector host:port.
+# For jaeger, it takes precedence over the agent endpoint when set
+collector-endpoint = %q
+
+# Disable client transport security for the OTLP exporter
+collector-insecure = %t
+
+# Output directory of the file exporter. Defaults to <home>/traces when empty
+file-dir = %q
+
+# Max size in bytes (uncompressed) before the file exporter starts a new file
+file-max-size = %d
+
+# Gzip the files of the file exporter
+file-compress = %t
+
+# DB directory of the embedded trace store. Defaults to <home>/data when empty
+store-dir = %q
+
+# Number of recent heights kept in the embedded trace store. Older traces are pruned. Nothing is pruned when 0
+store-retain-blocks = %d
+
+# Sampler type: const, probabilistic or ratelimiting (jaeger only)
+sampler-type = %q
+
+# Sampler type specific value: const 0|1, probabilistic rate, ratelimiting traces per second
+sampler-param = %v
+
+# Max number of spans in the reporter queue
+queue-size = %d
+
+# Interval to force flush the reporter queue
+flush-interval = %q
+
+# Log every reported span
+log-spans = %t
+
+# Payload limits in bytes. Spans are lost when the log size is too big
+max-store-traced = %d
+max-sdk-msg-traced = %d
+max-sdk-log-traced = %d
+max-ibc-packet-descr = %d
+default-max-length = %d
+
+# Chain-aware sampling action when no rule matches: sample, drop, probabilistic:<rate> or ratelimiting:<traces per second>
+sampling-default = %q
+
+# Chain-aware sampling rules, the first match decides for the whole trace. A rule has space separated
+# key=value conditions with "|" separated alternatives and an action. Condition keys: operation, height (from-to),
+# msg_type, contract, sender, module, ibc_channel, grpc_method and simulation. For example:
+# ["contract=wasm1abc|wasm1def action=sample", "height=100-200 msg_type=/cosmos.bank.v1beta1.MsgSend action=probabilistic:0.1"]
+sampling-rules = %s
+
+# Buffer the spans of a trace in memory and report them only when a span was errored or slow
+tail-sampling = %t
+
+# Report traces with a span of this duration or longer in tail sampling mode. Zero disables it
+tail-min-duration = %q
+
+# Memory bound in bytes for the buffered spans in tail sampling mode
+tail-max-buffer-bytes = %d
+
+# Output directory of the per block write sets to debug app hash divergences. Disabled when empty
+write-set-dir = %q
+
+# Store key names captured by the spans. All stores are captured when empty.
+# An entry "<operation>:<store>" applies to the spans of the operation only, for example ["ante_handler:acc"]
+store-capture-include = %s
+
+# Store key names not captured by the spans, for example ["capability", "params", "module_begin_block:distribution"]
+store-capture-exclude = %s
+
+# Store capture rules to override the capture of the spans with "all", "writes-only", "nothing" or "diff".
+# The first matching rule applies. Conditions: operation, module, contract and msg_type.
+# For example ["operation=wasmvm_execute contract=wasm1abc capture=all"]
+store-capture-rules = %s
+
+# Allow to replace the store capture rules at runtime via PUT on the "/cosmos-tracing/v1/store-capture-rules" endpoint.
+# The endpoint is unauthenticated so enable it only when the API is not exposed publicly. Disabled by default
+store-capture-updates = %t
+
+# Log the store operations as JSON with store name, gas and decoded keys in addition to the raw store io.
+# Opt-in, disabled by default. The operations are kept in memory until the span finishes
+store-ops-log = %t
+
+# Output directory of the per block gas profiles in pprof format, for "go tool pprof". Disabled when empty
+gas-profile-dir = %q
+
+# Number of recent blocks that the gas report aggregates. Disabled when 0
+gas-report-blocks = %d
+
+# Number of recent simulation results kept for the comparison with the delivered txs. Disabled when 0
+sim-compare-txs = %d
+
+# How the gas usage of the spans is recorded: "all" entries or "aggregate" by descriptor with count, sum, min/max
+# and first/last offset. Use aggregate for loop heavy contracts or big end blockers to keep the memory flat
+gas-trace-mode = %q
+
+# Number of last gas usage entries that are kept in aggregate mode
+gas-trace-last = %d
+`, c.Enabled, c.DisableSimulationTrace, c.Exporter, c.ServiceName, c.AgentEndpoint, c.CollectorEndpoint,
+		c.CollectorInsecure, c.FileDir, c.FileMaxSize, c.FileCompress, c.StoreDir, c.StoreRetainBlocks, c.SamplerType, c.SamplerParam, c.QueueSize, c.FlushInterval.String(), c.LogSpans,
+		c.MaxStoreTraced, c.MaxSDKMsgTraced, c.MaxSDKLogTraced, c.MaxIBCPacketDescr, c.DefaultMaxLength,
+		c.SamplingDefault, tomlStringArray(c.SamplingRules), c.TailSampling, c.TailMinDuration.String(), c.TailMaxBufferBytes,
+		c.WriteSetDir, tomlStringArray(c.StoreCaptureInclude), tomlStringArray(c.StoreCaptureExclude),
+		tomlStringArray(c.StoreCaptureRules), c.StoreCaptureUpdates, c.StoreOpsLog, c.GasProfileDir, c.GasReportBlocks, c.SimCompareTxs, c.GasTraceMode, c.GasTraceLast)
+}
+
+func tomlStringArray(s []string) string {
+	quoted := make([]string, len(s))
+	for i, v := range s {
+		quoted[i] = strconv.Quote(v)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
 // AddModuleInitFlags implements servertypes.ModuleInitFlags interface.
 func AddModuleInitFlags(startCmd *cobra.Command) {
+	defaults := DefaultTracerConfig()
 	startCmd.Flags().Bool(flagOpenTracingEnabled, false, "Capture traces and enable opentracing agent")
 	startCmd.Flags().Bool(flagSimulationTracingDisabled, false, "Do not trace simulations")
+	startCmd.Flags().String(flagExporter, defaults.Exporter, "Tracer backend: jaeger, otlp-grpc, otlp-http, file or store")
+	startCmd.Flags().String(flagServiceName, defaults.ServiceName, "Service name in the traces. The app name is used when empty")
+	startCmd.Flags().String(flagAgentEndpoint, defaults.AgentEndpoint, "Jaeger agent host:port (UDP)")
+	startCmd.Flags().String(flagCollectorEndpoint, defaults.CollectorEndpoint, "Jaeger collector URL or OTLP collector host:port")
+	startCmd.Flags().Bool(flagCollectorInsecure, defaults.CollectorInsecure, "Disable client transport security for the OTLP exporter")
+	startCmd.Flags().String(flagFileDir, defaults.FileDir, "Output directory of the file exporter. Defaults to <home>/traces")
+	startCmd.Flags().Int64(flagFileMaxSize, defaults.FileMaxSize, "Max size in bytes before the file exporter starts a new file")
+	startCmd.Flags().Bool(flagFileCompress, defaults.FileCompress, "Gzip the files of the file exporter")
+	startCmd.Flags().String(flagStoreDir, defaults.StoreDir, "DB directory of the embedded trace store. Defaults to <home>/data")
+	startCmd.Flags().Int(flagStoreRetainBlocks, defaults.StoreRetainBlocks, "Number of recent heights kept in the embedded trace store. Nothing is pruned when 0")
+	startCmd.Flags().String(flagSamplerType, defaults.SamplerType, "Sampler type: const, probabilistic or ratelimiting")
+	startCmd.Flags().Float64(flagSamplerParam, defaults.SamplerParam, "Sampler type specific value")
+	startCmd.Flags().Int(flagQueueSize, defaults.QueueSize, "Max number of spans in the reporter queue")
+	startCmd.Flags().Duration(flagFlushInterval, defaults.FlushInterval, "Interval to force flush the reporter queue")
+	startCmd.Flags().Bool(flagLogSpans, defaults.LogSpans, "Log every reported span")
+	startCmd.Flags().Int(flagMaxStoreTraced, defaults.MaxStoreTraced, "Max size of the store IO log")
+	startCmd.Flags().Int(flagMaxSDKMsgTraced, defaults.MaxSDKMsgTraced, "Max size of the sdk message log")
+	startCmd.Flags().Int(flagMaxSDKLogTraced, defaults.MaxSDKLogTraced, "Max size of the logger output")
+	startCmd.Flags().Int(flagMaxIBCPacketDescr, defaults.MaxIBCPacketDescr, "Max size of the IBC packet description")
+	startCmd.Flags().Int(flagDefaultMaxLength, defaults.DefaultMaxLength, "Max size of any other log field")
+	startCmd.Flags().String(flagSamplingDefault, defaults.SamplingDefault, "Sampling action when no rule matches: sample, drop, probabilistic:<rate> or ratelimiting:<traces per second>")
+	startCmd.Flags().Bool(flagTailSampling, defaults.TailSampling, "Report only traces with an errored or slow span")
+	startCmd.Flags().Duration(flagTailMinDuration, defaults.TailMinDuration, "Report traces with a span of this duration or longer in tail sampling mode")
+	startCmd.Flags().Int(flagTailMaxBufferBytes, defaults.TailMaxBufferBytes, "Memory bound in bytes for the buffered spans in tail sampling mode")
+	startCmd.Flags().String(flagWriteSetDir, defaults.WriteSetDir, "Output directory of the per block write sets. Disabled when empty")
+	startCmd.Flags().StringSlice(flagSamplingRules, defaults.SamplingRules, "Chain-aware sampling rules, for example \"contract=wasm1abc|wasm1def action=sample\"")
+	startCmd.Flags().StringSlice(flagStoreCaptureInclude, defaults.StoreCaptureInclude, "Store names captured by the spans, optionally as <operation>:<store>. All when empty")
+	startCmd.Flags().StringSlice(flagStoreCaptureExclude, defaults.StoreCaptureExclude, "Store names not captured by the spans, optionally as <operation>:<store>")
+	startCmd.Flags().String(flagGasProfileDir, defaults.GasProfileDir, "Output directory of the per block gas profiles in pprof format. Disabled when empty")
+	startCmd.Flags().Int(flagGasReportBlocks, defaults.GasReportBlocks, "Number of recent blocks that the gas report aggregates. Disabled when 0")
+	startCmd.Flags().String(flagGasTraceMode, defaults.GasTraceMode, "How the gas usage of the spans is recorded: all or aggregate")
+	startCmd.Flags().Int(flagGasTraceLast, defaults.GasTraceLast, "Number of last gas usage entries that are kept in aggregate mode")
+	startCmd.Flags().Int(flagSimCompareTxs, defaults.SimCompareTxs, "Number of recent simulation results kept for the comparison with the delivered txs. Disabled when 0")
+	startCmd.Flags().StringSlice(flagStoreCaptureRules, defaults.StoreCaptureRules, "Store capture rules, for example \"operation=wasmvm_execute contract=wasm1abc capture=all\"")
+	startCmd.Flags().Bool(flagStoreCaptureUpdates, defaults.StoreCaptureUpdates, "Allow to replace the store capture rules at runtime via the API endpoint")
+	startCmd.Flags().Bool(flagStoreOpsLog, defaults.StoreOpsLog, "Log the store operations as JSON with store name, gas and decoded keys")
 }
 
-// ReadTracerConfig reads the tracer flag
+// ReadTracerConfig reads the tracer flags and app.toml settings and applies them
 func ReadTracerConfig(opts servertypes.AppOptions) error {
-	if v := opts.Get(flagOpenTracingEnabled); v != nil {
-		var err error
-		if tracerEnabled, err = cast.ToBoolE(v); err != nil {
-			return err
-		}
+	cfg, err := ParseTracerConfig(opts)
+	if err != nil {
+		return err
 	}
-	if v := opts.Get(flagSimulationTracingDisabled); v != nil {
-		var err error
-		if disableSimulations, err = cast.ToBoolE(v); err != nil {
-			return err
+	return applyTracerConfig(cfg)
+}
+
+// ParseTracerConfig reads the tracer config from the app options. Default values are used for unset keys.
+// The option keys are the mapstructure tags of the config fields in the cosmos-tracing section.
+func ParseTracerConfig(opts servertypes.AppOptions) (TracerConfig, error) {
+	cfg := DefaultTracerConfig()
+	input := make(map[string]any)
+	t := reflect.TypeOf(cfg)
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("mapstructure")
+		if v := opts.Get(configSection + "." + key); v != nil {
+			input[key] = v
 		}
 	}
-	fmt.Printf("----> Running with tracer: %v (ignore simulations: %v)\n", tracerEnabled, disableSimulations)
-	return nil
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		WeaklyTypedInput: true,
+		ZeroFields:       true,
+		Result:           &cfg,
+	})
+	if err != nil {
+		return cfg, err
+	}
+	if err := dec.Decode(input); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.ValidateBasic()
 }
 
-func hasTracerFlagSet(cmd *cobra.Command) bool {
-	ok, err := cmd.Flags().GetBool(flagOpenTracingEnabled)
-	return err == nil && ok
+// applyTracerConfig sets the package wide settings
+func applyTracerConfig(cfg TracerConfig) error {
+	sampler, err := newSamplerFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	storeFilter, err := newStoreCaptureFilter(cfg.StoreCaptureInclude, cfg.StoreCaptureExclude)
+	if err != nil {
+		return err
+	}
+	storeCapture, err := newStoreCapturePolicyFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	SetSampler(sampler)
+	activeStoreFilter = storeFilter
+	SetStoreCapturePolicy(storeCapture)
+	activeSimulations = nil
+	if cfg.SimCompareTxs != 0 {
+		activeSimulations = newSimulationCache(cfg.SimCompareTxs)
+	}
+	tracerConfig = cfg
+	tracerEnabled = cfg.Enabled
+	disableSimulations = cfg.DisableSimulationTrace
+	gasTraceMode, gasTraceLast = cfg.GasTraceMode, cfg.GasTraceLast
+	storeOpsLog = cfg.StoreOpsLog
+	MaxStoreTraced = cfg.MaxStoreTraced
+	MaxSDKMsgTraced = cfg.MaxSDKMsgTraced
+	MaxSDKLogTraced = cfg.MaxSDKLogTraced
+	MaxIBCPacketDescr = cfg.MaxIBCPacketDescr
+	DefaultMaxLength = cfg.DefaultMaxLength
+	return nil
 }
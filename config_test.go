@@ -0,0 +1,213 @@
+package tracing
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTracerConfig(t *testing.T) {
+	specs := map[string]struct {
+		src    map[string]any
+		exp    func(c *TracerConfig)
+		expErr bool
+	}{
+		"defaults": {
+			src: map[string]any{},
+			exp: func(c *TracerConfig) {},
+		},
+		"all set": {
+			src: map[string]any{
+				flagOpenTracingEnabled:        true,
+				flagSimulationTracingDisabled: "true",
+				flagExporter:                  ExporterOTLPGRPC,
+				flagServiceName:               "myapp",
+				flagAgentEndpoint:             "agent:6831",
+				flagCollectorEndpoint:         "collector:4317",
+				flagCollectorInsecure:         true,
+				flagFileDir:                   "/tmp/traces",
+				flagFileMaxSize:               "2048",
+				flagFileCompress:              true,
+				flagStoreDir:                  "/tmp/data",
+				flagStoreRetainBlocks:         "500",
+				flagSamplerType:               SamplerTypeProbabilistic,
+				flagSamplerParam:              "0.5",
+				flagQueueSize:                 1000,
+				flagFlushInterval:             "3s",
+				flagLogSpans:                  false,
+				flagMaxStoreTraced:            1,
+				flagMaxSDKMsgTraced:           2,
+				flagMaxSDKLogTraced:           3,
+				flagMaxIBCPacketDescr:         4,
+				flagDefaultMaxLength:          5,
+				flagSamplingDefault:           "drop",
+				flagSamplingRules:             []any{"contract=wasm1abc action=sample"},
+				flagTailSampling:              true,
+				flagTailMinDuration:           "2s",
+				flagTailMaxBufferBytes:        1024,
+				flagWriteSetDir:               "/tmp/writesets",
+				flagStoreCaptureInclude:       []any{"ante_handler:acc"},
+				flagStoreCaptureExclude:       []any{"params", "capability"},
+				flagStoreCaptureRules:         []any{"operation=wasmvm_execute capture=all"},
+				flagStoreCaptureUpdates:       "true",
+				flagStoreOpsLog:               "true",
+				flagGasProfileDir:             "/tmp/gasprofiles",
+				flagGasReportBlocks:           "100",
+				flagSimCompareTxs:             "50",
+				flagGasTraceMode:              GasTraceModeAggregate,
+				flagGasTraceLast:              "10",
+			},
+			exp: func(c *TracerConfig) {
+				*c = TracerConfig{
+					Enabled:                true,
+					DisableSimulationTrace: true,
+					Exporter:               ExporterOTLPGRPC,
+					ServiceName:            "myapp",
+					AgentEndpoint:          "agent:6831",
+					CollectorEndpoint:      "collector:4317",
+					CollectorInsecure:      true,
+					FileDir:                "/tmp/traces",
+					FileMaxSize:            2048,
+					FileCompress:           true,
+					StoreDir:               "/tmp/data",
+					StoreRetainBlocks:      500,
+					SamplerType:            SamplerTypeProbabilistic,
+					SamplerParam:           0.5,
+					QueueSize:              1000,
+					FlushInterval:          3 * time.Second,
+					MaxStoreTraced:         1,
+					MaxSDKMsgTraced:        2,
+					MaxSDKLogTraced:        3,
+					MaxIBCPacketDescr:      4,
+					DefaultMaxLength:       5,
+					SamplingDefault:        SamplingActionDrop,
+					SamplingRules:          []string{"contract=wasm1abc action=sample"},
+					TailSampling:           true,
+					TailMinDuration:        2 * time.Second,
+					TailMaxBufferBytes:     1024,
+					WriteSetDir:            "/tmp/writesets",
+					StoreCaptureInclude:    []string{"ante_handler:acc"},
+					StoreCaptureExclude:    []string{"params", "capability"},
+					StoreCaptureRules:      []string{"operation=wasmvm_execute capture=all"},
+					StoreCaptureUpdates:    true,
+					StoreOpsLog:            true,
+					GasProfileDir:          "/tmp/gasprofiles",
+					GasReportBlocks:        100,
+					SimCompareTxs:          50,
+					GasTraceMode:           GasTraceModeAggregate,
+					GasTraceLast:           10,
+				}
+			},
+		},
+		"invalid type": {
+			src:    map[string]any{flagQueueSize: "foo"},
+			expErr: true,
+		},
+		"negative store retain blocks": {
+			src:    map[string]any{flagStoreRetainBlocks: -1},
+			expErr: true,
+		},
+		"unknown exporter": {
+			src:    map[string]any{flagExporter: "foo"},
+			expErr: true,
+		},
+		"ratelimiting sampler with otlp": {
+			src:    map[string]any{flagExporter: ExporterOTLPHTTP, flagSamplerType: SamplerTypeRateLimiting},
+			expErr: true,
+		},
+		"invalid sampling rule": {
+			src:    map[string]any{flagSamplingRules: []any{"contract=wasm1abc"}},
+			expErr: true,
+		},
+		"tail sampling without buffer": {
+			src:    map[string]any{flagTailSampling: true, flagTailMaxBufferBytes: 0},
+			expErr: true,
+		},
+		"invalid store capture entry": {
+			src:    map[string]any{flagStoreCaptureExclude: []any{":params"}},
+			expErr: true,
+		},
+		"invalid store capture rule": {
+			src:    map[string]any{flagStoreCaptureRules: []any{"operation=wasmvm_execute"}},
+			expErr: true,
+		},
+		"negative gas report blocks": {
+			src:    map[string]any{flagGasReportBlocks: -1},
+			expErr: true,
+		},
+		"negative sim compare txs": {
+			src:    map[string]any{flagSimCompareTxs: -1},
+			expErr: true,
+		},
+		"unknown gas trace mode": {
+			src:    map[string]any{flagGasTraceMode: "foo"},
+			expErr: true,
+		},
+		"negative gas trace last": {
+			src:    map[string]any{flagGasTraceLast: -1},
+			expErr: true,
+		},
+		"zero limit": {
+			src:    map[string]any{flagMaxStoreTraced: 0},
+			expErr: true,
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			v := viper.New()
+			for k, val := range spec.src {
+				v.Set(k, val)
+			}
+			// when
+			got, gotErr := ParseTracerConfig(v)
+			// then
+			if spec.expErr {
+				require.Error(t, gotErr)
+				return
+			}
+			require.NoError(t, gotErr)
+			exp := DefaultTracerConfig()
+			spec.exp(&exp)
+			assert.Equal(t, exp, got)
+		})
+	}
+}
+
+func TestConfigTemplateRoundTrip(t *testing.T) {
+	myCfg := DefaultTracerConfig()
+	myCfg.Enabled = true
+	myCfg.Exporter = ExporterOTLPHTTP
+	myCfg.CollectorEndpoint = "localhost:4318"
+	myCfg.FileDir = "/tmp/traces"
+	myCfg.FileCompress = true
+	myCfg.StoreDir = "/tmp/data"
+	myCfg.StoreRetainBlocks = 500
+	myCfg.SamplerParam = 0.25
+	myCfg.FlushInterval = 2 * time.Second
+	myCfg.SamplingDefault = "ratelimiting:2"
+	myCfg.TailSampling = true
+	myCfg.TailMinDuration = time.Minute
+	myCfg.WriteSetDir = "/tmp/writesets"
+	myCfg.StoreCaptureInclude = []string{"ante_handler:acc"}
+	myCfg.StoreCaptureExclude = []string{"params", "module_begin_block:distribution"}
+	myCfg.GasProfileDir = "/tmp/gasprofiles"
+	myCfg.StoreOpsLog = true
+	myCfg.GasReportBlocks = 100
+	myCfg.SimCompareTxs = 50
+	myCfg.GasTraceMode = GasTraceModeAggregate
+	myCfg.GasTraceLast = 10
+	myCfg.StoreCaptureRules = []string{"operation=wasmvm_execute contract=wasm1abc capture=all"}
+	myCfg.StoreCaptureUpdates = true
+	myCfg.SamplingRules = []string{"contract=wasm1abc|wasm1def action=sample", "height=100- action=probabilistic:0.1"}
+
+	v := viper.New()
+	v.SetConfigType("toml")
+	require.NoError(t, v.ReadConfig(strings.NewReader(ConfigTemplate(myCfg))))
+	got, err := ParseTracerConfig(v)
+	require.NoError(t, err)
+	assert.Equal(t, myCfg, got)
+}
@@ -1,9 +1,12 @@
 package tracing
 
 import (
+	"sync"
 	"time"
 
 	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
 )
 
 // IsTraceable returns true when context is applicable for tracing
@@ -19,8 +22,12 @@ func isTraceable(ctx sdk.Context, simulate bool) bool {
 type key int
 
 var (
-	simulationKey key = 1
-	clockKey      key = 2
+	simulationKey  key = 1
+	clockKey       key = 2
+	samplingKey    key = 3
+	originKey      key = 4
+	txExecutionKey key = 5
+	blockKey       key = 6
 )
 
 // WithSimulation set simulation flag
@@ -59,3 +66,74 @@ func WithBlockTimeClock(rootCtx sdk.Context) (sdk.Context, time.Time) {
 	clock := NewBlockTimeClock(time.Now(), blockTime)
 	return rootCtx.WithValue(clockKey, clock), blockTime
 }
+
+// blockClock returns the block time clock of the context or nil
+func blockClock(ctx sdk.Context) *BlockTimeClock {
+	c, _ := ctx.Value(clockKey).(*BlockTimeClock)
+	return c
+}
+
+var _ opentracing.Span = &blockClockSpan{}
+
+// blockClockSpan is a decorator to the span that timestamps the logs with the block time clock, like the start and
+// finish time of the span. The logs are passed on when the span is finished.
+type blockClockSpan struct {
+	opentracing.Span
+	clock *BlockTimeClock
+	mx    sync.Mutex
+	logs  []opentracing.LogRecord
+}
+
+// newBlockClockSpan constructor. The span is returned unchanged without clock
+func newBlockClockSpan(span opentracing.Span, clock *BlockTimeClock) opentracing.Span {
+	if clock == nil {
+		return span
+	}
+	return &blockClockSpan{Span: span, clock: clock}
+}
+
+func (s *blockClockSpan) LogFields(fields ...otlog.Field) {
+	r := opentracing.LogRecord{Timestamp: s.clock.Now(time.Now()), Fields: fields}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.logs = append(s.logs, r)
+}
+
+func (s *blockClockSpan) LogKV(alternatingKeyValues ...interface{}) {
+	fields, err := otlog.InterleavedKVToFields(alternatingKeyValues...)
+	if err != nil {
+		s.LogFields(otlog.Error(err), otlog.String("function", "LogKV"))
+		return
+	}
+	s.LogFields(fields...)
+}
+
+func (s *blockClockSpan) Finish() {
+	s.FinishWithOptions(opentracing.FinishOptions{})
+}
+
+func (s *blockClockSpan) FinishWithOptions(opts opentracing.FinishOptions) {
+	if opts.FinishTime.IsZero() {
+		opts.FinishTime = s.clock.Now(time.Now())
+	}
+	s.mx.Lock()
+	opts.LogRecords = append(s.logs, opts.LogRecords...)
+	s.logs = nil
+	s.mx.Unlock()
+	s.Span.FinishWithOptions(opts)
+}
+
+func (s *blockClockSpan) SetOperationName(operationName string) opentracing.Span {
+	s.Span.SetOperationName(operationName)
+	return s
+}
+
+func (s *blockClockSpan) SetTag(key string, value interface{}) opentracing.Span {
+	s.Span.SetTag(key, value)
+	return s
+}
+
+func (s *blockClockSpan) SetBaggageItem(restrictedKey, value string) opentracing.Span {
+	s.Span.SetBaggageItem(restrictedKey, value)
+	return s
+}
@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// cwStorageKey decodes a contract state key with the cw-storage-plus layout into a readable form.
+// Map keys are `len(namespace) | namespace | len(part) | part ... | last part` with 2 byte big endian lengths and
+// are rendered as `namespace[part, ...]`. Item keys are the namespace only.
+func cwStorageKey(key []byte) string {
+	if len(key) >= 2 {
+		n := int(binary.BigEndian.Uint16(key))
+		if n != 0 && 2+n < len(key) && isPrintable(key[2:2+n]) {
+			parts := cwStorageKeyParts(key[2+n:])
+			rendered := make([]string, len(parts))
+			for i, p := range parts {
+				rendered[i] = cwStorageKeyPart(p)
+			}
+			return string(key[2:2+n]) + "[" + strings.Join(rendered, ", ") + "]"
+		}
+	}
+	return printableOrHex(key)
+}
+
+// cwStorageKeyParts splits the length prefixed parts of a composite key. The last part is not length prefixed.
+func cwStorageKeyParts(bz []byte) [][]byte {
+	var parts [][]byte
+	for len(bz) > 2 {
+		n := int(binary.BigEndian.Uint16(bz))
+		if n == 0 || 2+n >= len(bz) {
+			break
+		}
+		parts = append(parts, bz[2:2+n])
+		bz = bz[2+n:]
+	}
+	return append(parts, bz)
+}
+
+// cwStorageKeyPart renders a key part as string when printable. Other 8 byte parts are rendered as
+// big endian integer, like the u64 keys.
+func cwStorageKeyPart(bz []byte) string {
+	switch {
+	case isPrintable(bz):
+		return string(bz)
+	case len(bz) == 8:
+		return strconv.FormatUint(binary.BigEndian.Uint64(bz), 10)
+	default:
+		return printableOrHex(bz)
+	}
+}
+
+// cwStorageValue renders the JSON values of the contract state. JSON strings, like Uint128 amounts, are unquoted.
+func cwStorageValue(bz []byte) string {
+	if !json.Valid(bz) {
+		return printableOrHex(bz)
+	}
+	var s string
+	if err := json.Unmarshal(bz, &s); err == nil {
+		return s
+	}
+	return string(bz)
+}
@@ -276,6 +276,9 @@ type WasmApp struct {
 
 	// module configurator
 	configurator module.Configurator
+
+	// block lifecycle with tracing
+	blockTracer tracing.ABCIBlockApp
 }
 
 // NewWasmApp returns a reference to an initialized WasmApp.
@@ -336,6 +339,8 @@ func NewWasmApp(
 		tkeys:             tkeys,
 		memKeys:           memKeys,
 	}
+	app.blockTracer = tracing.NewTraceBlockApp(bApp, keys)
+	tracing.RegisterDefaultKeyDecoders(appCodec)
 
 	app.ParamsKeeper = initParamsKeeper(
 		appCodec,
@@ -829,7 +834,7 @@ func NewWasmApp(
 }
 
 func (app *WasmApp) setAnteHandler(txConfig client.TxConfig, wasmConfig wasmtypes.WasmConfig, txCounterStoreKey storetypes.StoreKey) {
-	anteHandler, err := wasmapp.NewAnteHandler(
+	anteHandler, err := NewAnteHandler(
 		wasmapp.HandlerOptions{
 			HandlerOptions: ante.HandlerOptions{
 				AccountKeeper:   app.AccountKeeper,
@@ -858,12 +863,32 @@ func (app *WasmApp) setPostHandler() {
 		panic(err)
 	}
 
-	app.SetPostHandler(postHandler)
+	app.SetPostHandler(tracing.NewTracePostHandler(postHandler))
 }
 
 // Name returns the name of the App
 func (app *WasmApp) Name() string { return app.BaseApp.Name() }
 
+// BeginBlock starts the block root span
+func (app *WasmApp) BeginBlock(req abci.RequestBeginBlock) abci.ResponseBeginBlock {
+	return app.blockTracer.BeginBlock(req)
+}
+
+// DeliverTx delivers the tx within a tx root span
+func (app *WasmApp) DeliverTx(req abci.RequestDeliverTx) abci.ResponseDeliverTx {
+	return app.blockTracer.DeliverTx(req)
+}
+
+// EndBlock ends the block
+func (app *WasmApp) EndBlock(req abci.RequestEndBlock) abci.ResponseEndBlock {
+	return app.blockTracer.EndBlock(req)
+}
+
+// Commit finishes the block root span
+func (app *WasmApp) Commit() abci.ResponseCommit {
+	return app.blockTracer.Commit()
+}
+
 // BeginBlocker application updates every begin block
 func (app *WasmApp) BeginBlocker(ctx sdk.Context, req abci.RequestBeginBlock) abci.ResponseBeginBlock {
 	return app.ModuleManager.BeginBlock(ctx, req)
@@ -974,6 +999,13 @@ func (app *WasmApp) RegisterAPIRoutes(apiSvr *api.Server, apiConfig config.APICo
 	// Register grpc-gateway routes for all modules.
 	ModuleBasics.RegisterGRPCGatewayRoutes(clientCtx, apiSvr.GRPCGatewayRouter)
 
+	// Register the embedded trace store endpoints
+	tracing.RegisterTraceStoreRoutes(apiSvr.Router)
+	// Register the gas report endpoint
+	tracing.RegisterGasReportRoutes(apiSvr.Router)
+	// Register the store capture rules endpoint. Updates require the store-capture-updates config
+	tracing.RegisterStoreCaptureRoutes(apiSvr.Router)
+
 	// register swagger API from root so that other applications can override easily
 	if err := server.RegisterSwaggerAPI(apiSvr.ClientCtx, apiSvr.Router, apiConfig.Swagger); err != nil {
 		panic(err)
@@ -982,7 +1014,7 @@ func (app *WasmApp) RegisterAPIRoutes(apiSvr *api.Server, apiConfig config.APICo
 
 // RegisterTxService implements the Application.RegisterTxService method.
 func (app *WasmApp) RegisterTxService(clientCtx client.Context) {
-	authtx.RegisterTxService(app.BaseApp.GRPCQueryRouter(), clientCtx, app.BaseApp.Simulate, app.interfaceRegistry)
+	authtx.RegisterTxService(app.BaseApp.GRPCQueryRouter(), clientCtx, tracing.TraceSimulate(app.BaseApp.Simulate), app.interfaceRegistry)
 }
 
 // RegisterTendermintService implements the Application.RegisterTendermintService method.
@@ -120,7 +120,8 @@ func initAppConfig() (string, interface{}) {
 	type CustomAppConfig struct {
 		serverconfig.Config
 
-		Wasm wasmtypes.WasmConfig `mapstructure:"wasm"`
+		Wasm    wasmtypes.WasmConfig `mapstructure:"wasm"`
+		Tracing tracing.TracerConfig `mapstructure:"cosmos-tracing"`
 	}
 
 	// Optionally allow the chain developer to overwrite the SDK's default
@@ -142,12 +143,14 @@ func initAppConfig() (string, interface{}) {
 	// srvCfg.BaseConfig.IAVLDisableFastNode = true // disable fastnode by default
 
 	customAppConfig := CustomAppConfig{
-		Config: *srvCfg,
-		Wasm:   wasmtypes.DefaultWasmConfig(),
+		Config:  *srvCfg,
+		Wasm:    wasmtypes.DefaultWasmConfig(),
+		Tracing: tracing.DefaultTracerConfig(),
 	}
 
 	customAppTemplate := serverconfig.DefaultConfigTemplate +
-		wasmtypes.DefaultConfigTemplate()
+		wasmtypes.DefaultConfigTemplate() +
+		tracing.DefaultConfigTemplate()
 
 	return customAppTemplate, customAppConfig
 }
@@ -171,6 +174,7 @@ func initRootCmd(rootCmd *cobra.Command, encodingConfig params.EncodingConfig) {
 		queryCommand(),
 		txCommand(),
 		keys.Commands(app.DefaultNodeHome),
+		tracing.TracingCommands(),
 	)
 	// add rosetta
 	rootCmd.AddCommand(rosettaCmd.RosettaCommand(encodingConfig.InterfaceRegistry, encodingConfig.Codec))
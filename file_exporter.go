@@ -0,0 +1,352 @@
+package tracing
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	spanFilePrefix = "spans-"
+	spanFileExt    = ".jsonl"
+	gzipFileExt    = ".gz"
+)
+
+// SpanRecord is a finished span in the JSON-lines trace files
+type SpanRecord struct {
+	TraceID   string          `json:"trace_id"`
+	SpanID    string          `json:"span_id"`
+	ParentID  string          `json:"parent_id,omitempty"`
+	Operation string          `json:"operation"`
+	Start     time.Time       `json:"start"`
+	Finish    time.Time       `json:"finish"`
+	Tags      map[string]any  `json:"tags,omitempty"`
+	Logs      []SpanLogRecord `json:"logs,omitempty"`
+}
+
+// SpanLogRecord is a log entry of a SpanRecord
+type SpanLogRecord struct {
+	Timestamp time.Time      `json:"timestamp"`
+	Fields    map[string]any `json:"fields"`
+}
+
+var _ sdktrace.SpanExporter = &FileSpanExporter{}
+
+// FileSpanExporter writes the finished spans as JSON lines to rotating files
+type FileSpanExporter struct {
+	mx sync.Mutex
+	w  *rotatingFileWriter
+}
+
+// NewFileSpanExporter constructor. A new file is started when maxSize bytes (uncompressed) are exceeded.
+func NewFileSpanExporter(dir string, maxSize int64, compress bool) (*FileSpanExporter, error) {
+	if dir == "" {
+		return nil, errors.New("file exporter dir must not be empty")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &FileSpanExporter{w: &rotatingFileWriter{dir: dir, maxSize: maxSize, compress: compress}}, nil
+}
+
+// ExportSpans writes the spans to the current file
+func (f *FileSpanExporter) ExportSpans(_ context.Context, spans []sdktrace.ReadOnlySpan) error {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	for _, s := range spans {
+		bz, err := json.Marshal(toSpanRecord(s))
+		if err != nil {
+			return err
+		}
+		if err := f.w.writeLine(bz); err != nil {
+			return err
+		}
+	}
+	return f.w.flush()
+}
+
+// Shutdown closes the current file
+func (f *FileSpanExporter) Shutdown(context.Context) error {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	return f.w.close()
+}
+
+func toSpanRecord(s sdktrace.ReadOnlySpan) SpanRecord {
+	r := SpanRecord{
+		TraceID:   s.SpanContext().TraceID().String(),
+		SpanID:    s.SpanContext().SpanID().String(),
+		Operation: s.Name(),
+		Start:     s.StartTime().UTC(),
+		Finish:    s.EndTime().UTC(),
+		Tags:      attributesToMap(s.Attributes()),
+	}
+	if s.Parent().IsValid() {
+		r.ParentID = s.Parent().SpanID().String()
+	}
+	for _, e := range s.Events() {
+		r.Logs = append(r.Logs, SpanLogRecord{Timestamp: e.Time.UTC(), Fields: attributesToMap(e.Attributes)})
+	}
+	return r
+}
+
+func attributesToMap(attrs []attribute.KeyValue) map[string]any {
+	if len(attrs) == 0 {
+		return nil
+	}
+	r := make(map[string]any, len(attrs))
+	for _, a := range attrs {
+		r[string(a.Key)] = a.Value.AsInterface()
+	}
+	return r
+}
+
+// rotatingFileWriter writes to size bounded files in the dir
+type rotatingFileWriter struct {
+	dir      string
+	maxSize  int64
+	compress bool
+
+	seq     int
+	written int64
+	f       *os.File
+	gz      *gzip.Writer
+	buf     *bufio.Writer
+}
+
+func (r *rotatingFileWriter) writeLine(bz []byte) error {
+	if r.f != nil && r.maxSize > 0 && r.written+int64(len(bz))+1 > r.maxSize {
+		if err := r.close(); err != nil {
+			return err
+		}
+	}
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+	n, err := r.buf.Write(append(bz, '\n'))
+	r.written += int64(n)
+	return err
+}
+
+func (r *rotatingFileWriter) open() error {
+	r.seq++
+	name := fmt.Sprintf("%s%s-%06d%s", spanFilePrefix, time.Now().UTC().Format("20060102T150405"), r.seq, spanFileExt)
+	if r.compress {
+		name += gzipFileExt
+	}
+	f, err := os.OpenFile(filepath.Join(r.dir, name), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o640)
+	if err != nil {
+		return err
+	}
+	r.f, r.written = f, 0
+	var w io.Writer = f
+	if r.compress {
+		r.gz = gzip.NewWriter(f)
+		w = r.gz
+	}
+	r.buf = bufio.NewWriter(w)
+	return nil
+}
+
+func (r *rotatingFileWriter) flush() error {
+	if r.buf == nil {
+		return nil
+	}
+	if err := r.buf.Flush(); err != nil {
+		return err
+	}
+	if r.gz != nil {
+		return r.gz.Flush()
+	}
+	return nil
+}
+
+func (r *rotatingFileWriter) close() error {
+	if r.f == nil {
+		return nil
+	}
+	err := r.flush()
+	if r.gz != nil {
+		err = errors.Join(err, r.gz.Close())
+	}
+	err = errors.Join(err, r.f.Close())
+	r.f, r.gz, r.buf = nil, nil, nil
+	return err
+}
+
+// ReadSpanFiles reads the span records from the JSON-lines files. Files with `.gz` suffix are decompressed.
+func ReadSpanFiles(paths ...string) ([]SpanRecord, error) {
+	var records []SpanRecord
+	for _, p := range paths {
+		err := scanSpanFile(p, func(r SpanRecord) {
+			records = append(records, r)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+	}
+	return records, nil
+}
+
+// scanSpanFile passes the span records of the file to the callback one by one
+func scanSpanFile(path string, cb func(SpanRecord)) error {
+	f, err := os.Open(path) //nolint:gosec // path is user input
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var src io.Reader = f
+	if strings.HasSuffix(path, gzipFileExt) {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		src = gz
+	}
+	rd := bufio.NewReader(src)
+	for lineNo := 1; ; lineNo++ {
+		line, err := rd.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) != 0 {
+			var r SpanRecord
+			dec := json.NewDecoder(bytes.NewReader(line))
+			dec.UseNumber()
+			if err := dec.Decode(&r); err != nil {
+				return fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			cb(r)
+		}
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return err
+		}
+	}
+}
+
+// ReplaySpanFiles reads the JSON-lines files one by one and reports the span records to the tracer like ReplaySpans.
+// The records of a trace are held until its root span record is read, which is the last one of the trace as spans
+// are written when finished. Records of traces without root are reported at the end. Returns the number of spans.
+func ReplaySpanFiles(tracer opentracing.Tracer, paths ...string) (int, error) {
+	var count int
+	pending := make(map[string][]SpanRecord)
+	var order []string
+	for _, p := range paths {
+		err := scanSpanFile(p, func(r SpanRecord) {
+			count++
+			if _, ok := pending[r.TraceID]; !ok {
+				order = append(order, r.TraceID)
+			}
+			pending[r.TraceID] = append(pending[r.TraceID], r)
+			if r.ParentID == "" {
+				ReplaySpans(tracer, pending[r.TraceID])
+				delete(pending, r.TraceID)
+			}
+		})
+		if err != nil {
+			return count, fmt.Errorf("%s: %w", p, err)
+		}
+	}
+	for _, id := range order {
+		if records, ok := pending[id]; ok {
+			ReplaySpans(tracer, records)
+			delete(pending, id)
+		}
+	}
+	return count, nil
+}
+
+// ReplaySpans reports the span records to the tracer with the original timestamps, tags, logs and parent relations.
+// New trace and span ids are assigned by the tracer.
+func ReplaySpans(tracer opentracing.Tracer, records []SpanRecord) {
+	byID := make(map[string]*SpanRecord, len(records))
+	for i := range records {
+		byID[records[i].TraceID+records[i].SpanID] = &records[i]
+	}
+	started := make(map[*SpanRecord]opentracing.Span, len(records))
+	var start func(r *SpanRecord) opentracing.Span
+	start = func(r *SpanRecord) opentracing.Span {
+		if s, ok := started[r]; ok {
+			return s
+		}
+		opts := []opentracing.StartSpanOption{opentracing.StartTime(r.Start)}
+		if parent, ok := byID[r.TraceID+r.ParentID]; ok && r.ParentID != "" && parent != r {
+			opts = append(opts, opentracing.ChildOf(start(parent).Context()))
+		}
+		for k, v := range r.Tags {
+			opts = append(opts, opentracing.Tag{Key: k, Value: fromJSONValue(v)})
+		}
+		s := tracer.StartSpan(r.Operation, opts...)
+		started[r] = s
+		return s
+	}
+	for i := range records {
+		start(&records[i])
+	}
+	// finish in file order which is the original finish order
+	for i := range records {
+		r := &records[i]
+		logs := make([]opentracing.LogRecord, len(r.Logs))
+		for j, l := range r.Logs {
+			fields := make([]otlog.Field, 0, len(l.Fields))
+			for k, v := range l.Fields {
+				fields = append(fields, toLogField(k, fromJSONValue(v)))
+			}
+			logs[j] = opentracing.LogRecord{Timestamp: l.Timestamp, Fields: fields}
+		}
+		started[r].FinishWithOptions(opentracing.FinishOptions{FinishTime: r.Finish, LogRecords: logs})
+	}
+}
+
+func toLogField(key string, v any) otlog.Field {
+	switch x := v.(type) {
+	case string:
+		return otlog.String(key, x)
+	case bool:
+		return otlog.Bool(key, x)
+	case int64:
+		return otlog.Int64(key, x)
+	case float64:
+		return otlog.Float64(key, x)
+	default:
+		return otlog.Object(key, x)
+	}
+}
+
+// fromJSONValue converts decoded JSON values into typed values
+func fromJSONValue(v any) any {
+	switch x := v.(type) {
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return i
+		}
+		f, _ := x.Float64()
+		return f
+	case []any:
+		r := make([]string, len(x))
+		for i, e := range x {
+			r[i] = fmt.Sprint(fromJSONValue(e))
+		}
+		return r
+	default:
+		return v
+	}
+}
@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cometbft/cometbft/libs/log"
+	"github.com/cosmos/cosmos-sdk/types"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSpanExporterRoundTrip(t *testing.T) {
+	blockTime := time.Date(2020, time.April, 22, 12, 0, 0, 0, time.UTC)
+	specs := map[string]struct {
+		compress bool
+	}{
+		"plain":      {},
+		"compressed": {compress: true},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			t.Cleanup(func() { opentracing.SetGlobalTracer(opentracing.NoopTracer{}) })
+			dir := t.TempDir()
+			cfg := DefaultTracerConfig()
+			cfg.ServiceName, cfg.Exporter, cfg.FileDir, cfg.FileCompress = "testapp", ExporterFile, dir, spec.compress
+			closer, err := StartOTelTracer(cfg, log.NewNopLogger())
+			require.NoError(t, err)
+
+			ctx, _, _ := createMinTestInput(t)
+			DoWithTracing(ctx, "my-op", StoreLogNothing, func(parentCtx types.Context, span opentracing.Span) error {
+				DoWithTracing(parentCtx, "inner", StoreLogNothing, func(workCtx types.Context, span opentracing.Span) error {
+					return errors.New("my-error")
+				})
+				return nil
+			})
+			require.NoError(t, closer.Close())
+
+			// when
+			paths, err := spanFilePaths([]string{dir})
+			require.NoError(t, err)
+			records, err := ReadSpanFiles(paths...)
+			require.NoError(t, err)
+
+			// then
+			require.Len(t, records, 2)
+			inner, outer := records[0], records[1]
+			assert.Equal(t, "inner", inner.Operation)
+			assert.Equal(t, "my-op", outer.Operation)
+			assert.Equal(t, outer.SpanID, inner.ParentID)
+			assert.Equal(t, outer.TraceID, inner.TraceID)
+			assert.Empty(t, outer.ParentID)
+			assert.Equal(t, blockTime, outer.Start)
+			assert.Equal(t, "true", inner.Tags[tagErrored])
+			require.NotEmpty(t, inner.Logs)
+			assert.Equal(t, "my-error", inner.Logs[0].Fields["error.object"])
+			assert.False(t, inner.Logs[0].Timestamp.Before(blockTime))
+			assert.False(t, inner.Logs[0].Timestamp.After(inner.Finish))
+
+			// and when replayed
+			tracer := mocktracer.New()
+			count, err := ReplaySpanFiles(tracer, paths...)
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+			spans := tracer.FinishedSpans()
+			require.Len(t, spans, 2)
+			gotInner, gotOuter := spans[0], spans[1]
+			assert.Equal(t, "inner", gotInner.OperationName)
+			assert.Equal(t, gotOuter.SpanContext.SpanID, gotInner.ParentID)
+			assert.Equal(t, blockTime, gotOuter.StartTime)
+			assert.Equal(t, outer.Finish, gotOuter.FinishTime)
+			assert.Equal(t, int64(1234567), gotOuter.Tag(tagBlockHeight))
+			assert.Equal(t, "true", gotInner.Tag(tagErrored))
+			require.NotEmpty(t, gotInner.Logs())
+			assert.Equal(t, "my-error", gotInner.Logs()[0].Fields[0].ValueString)
+		})
+	}
+}
+
+func TestRotatingFileWriter(t *testing.T) {
+	dir := t.TempDir()
+	w := &rotatingFileWriter{dir: dir, maxSize: 10}
+	for _, line := range []string{"12345", "67890", "abc"} {
+		require.NoError(t, w.writeLine([]byte(line)))
+	}
+	require.NoError(t, w.close())
+
+	files, err := filepath.Glob(filepath.Join(dir, spanFilePrefix+"*"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	bz, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Equal(t, "12345\n", string(bz))
+	bz, err = os.ReadFile(files[1])
+	require.NoError(t, err)
+	assert.Equal(t, "67890\nabc\n", string(bz))
+}
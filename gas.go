@@ -23,12 +23,72 @@ func (g GasTrace) String() string {
 	return fmt.Sprintf("%d, %s, refund: %v", g.Gas, g.Descriptor, g.Refund)
 }
 
+// Gas trace modes
+const (
+	// GasTraceModeAll records every gas usage and refund
+	GasTraceModeAll = "all"
+	// GasTraceModeAggregate aggregates the gas usage and refunds by descriptor and keeps the last entries only
+	GasTraceModeAggregate = "aggregate"
+)
+
+// gasTraceMode and gasTraceLast are the settings for new span gas meters
+var (
+	gasTraceMode = GasTraceModeAll
+	gasTraceLast = 0
+)
+
+// GasTraceAggregate is the gas usage or refunds of a descriptor
+type GasTraceAggregate struct {
+	Descriptor  string
+	Refund      bool
+	Count       uint64
+	Sum         storetypes.Gas
+	Min         storetypes.Gas
+	Max         storetypes.Gas
+	FirstOffset storetypes.Gas
+	LastOffset  storetypes.Gas
+}
+
+func (a *GasTraceAggregate) add(g GasTrace) {
+	if a.Count == 0 {
+		a.Min, a.FirstOffset = g.Gas, g.Offset
+	}
+	a.Count++
+	a.Sum += g.Gas
+	if g.Gas < a.Min {
+		a.Min = g.Gas
+	}
+	if g.Gas > a.Max {
+		a.Max = g.Gas
+	}
+	a.LastOffset = g.Offset
+}
+
+// GasTraceSummary is the gas usage of a meter in aggregate mode. Aggregates are in order of the first usage,
+// Last are the most recent entries
+type GasTraceSummary struct {
+	Count      uint64
+	Aggregates []GasTraceAggregate
+	Last       []GasTrace `json:",omitempty"`
+}
+
+type gasTraceKey struct {
+	descriptor string
+	refund     bool
+}
+
 var _ sdk.GasMeter = &TraceGasMeter{}
 
 // TraceGasMeter is a decorator to the sdk GasMeter that catuptures all gas usage and refunds
 type TraceGasMeter struct {
 	o      sdk.GasMeter
 	traces []GasTrace
+	// aggregates are set in aggregate mode instead of the traces. The last traces are kept in a ring buffer
+	aggregates map[gasTraceKey]*GasTraceAggregate
+	order      []gasTraceKey
+	count      uint64
+	last       []GasTrace
+	lastPos    int
 }
 
 // NewTraceGasMeter constructor
@@ -36,6 +96,59 @@ func NewTraceGasMeter(o sdk.GasMeter) *TraceGasMeter {
 	return &TraceGasMeter{o: o, traces: make([]GasTrace, 0)}
 }
 
+// NewAggregatingTraceGasMeter constructor for a meter that aggregates by descriptor and keeps the last n entries only
+func NewAggregatingTraceGasMeter(o sdk.GasMeter, last int) *TraceGasMeter {
+	return &TraceGasMeter{o: o, aggregates: make(map[gasTraceKey]*GasTraceAggregate), last: make([]GasTrace, 0, last)}
+}
+
+// newSpanTraceGasMeter returns the trace gas meter for the configured gas trace mode
+func newSpanTraceGasMeter(o sdk.GasMeter) *TraceGasMeter {
+	if gasTraceMode == GasTraceModeAggregate {
+		return NewAggregatingTraceGasMeter(o, gasTraceLast)
+	}
+	return NewTraceGasMeter(o)
+}
+
+func (t *TraceGasMeter) record(g GasTrace) {
+	if t.aggregates == nil {
+		t.traces = append(t.traces, g)
+		return
+	}
+	t.count++
+	k := gasTraceKey{descriptor: g.Descriptor, refund: g.Refund}
+	a, ok := t.aggregates[k]
+	if !ok {
+		a = &GasTraceAggregate{Descriptor: g.Descriptor, Refund: g.Refund}
+		t.aggregates[k] = a
+		t.order = append(t.order, k)
+	}
+	a.add(g)
+	if cap(t.last) == 0 {
+		return
+	}
+	if len(t.last) < cap(t.last) {
+		t.last = append(t.last, g)
+		return
+	}
+	t.last[t.lastPos] = g
+	t.lastPos = (t.lastPos + 1) % len(t.last)
+}
+
+// usage returns all gas traces or the summary in aggregate mode
+func (t *TraceGasMeter) usage() any {
+	if t.aggregates == nil {
+		return t.traces
+	}
+	r := GasTraceSummary{Count: t.count, Aggregates: make([]GasTraceAggregate, len(t.order))}
+	for i, k := range t.order {
+		r.Aggregates[i] = *t.aggregates[k]
+	}
+	if len(t.last) != 0 {
+		r.Last = append(append(make([]GasTrace, 0, len(t.last)), t.last[t.lastPos:]...), t.last[:t.lastPos]...)
+	}
+	return r
+}
+
 func (t TraceGasMeter) GasConsumed() storetypes.Gas {
 	return t.o.GasConsumed()
 }
@@ -49,12 +162,12 @@ func (t TraceGasMeter) Limit() storetypes.Gas {
 }
 
 func (t *TraceGasMeter) ConsumeGas(amount storetypes.Gas, descriptor string) {
-	t.traces = append(t.traces, NewGasTrace(amount, descriptor, false, t.o.GasConsumed()))
+	t.record(NewGasTrace(amount, descriptor, false, t.o.GasConsumed()))
 	t.o.ConsumeGas(amount, descriptor)
 }
 
 func (t *TraceGasMeter) RefundGas(amount storetypes.Gas, descriptor string) {
-	t.traces = append(t.traces, NewGasTrace(amount, descriptor, true, t.o.GasConsumed()))
+	t.record(NewGasTrace(amount, descriptor, true, t.o.GasConsumed()))
 	t.o.RefundGas(amount, descriptor)
 }
 
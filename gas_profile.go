@@ -0,0 +1,196 @@
+package tracing
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	storetypes "github.com/cosmos/cosmos-sdk/store/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/google/pprof/profile"
+)
+
+const gasProfileFilePrefix = "gasprofile-"
+
+// gas profile sample labels
+const (
+	gasProfileLabelTx     = "tx"
+	gasProfileLabelHeight = "height"
+)
+
+// activeGasProfile records the block gas profiles when set
+var activeGasProfile *gasProfileRecorder
+
+var _ sdk.GasMeter = &gasProfileMeter{}
+
+// gasProfileMeter is a decorator to the gas meter of a span that records the gas consumed and refunded with the
+// span origin. The meters of the enclosing spans are bypassed so that the gas is attributed to the innermost span.
+type gasProfileMeter struct {
+	sdk.GasMeter
+	origin   *spanOrigin
+	recorder *gasProfileRecorder
+}
+
+// withoutGasProfile returns the gas meter that the profile meter decorates or the given meter
+func withoutGasProfile(gm sdk.GasMeter) sdk.GasMeter {
+	if p, ok := gm.(*gasProfileMeter); ok {
+		return p.GasMeter
+	}
+	return gm
+}
+
+func (g *gasProfileMeter) ConsumeGas(amount storetypes.Gas, descriptor string) {
+	g.recorder.record(g.origin, descriptor, amount, false)
+	g.GasMeter.ConsumeGas(amount, descriptor)
+}
+
+func (g *gasProfileMeter) RefundGas(amount storetypes.Gas, descriptor string) {
+	g.recorder.record(g.origin, descriptor, amount, true)
+	g.GasMeter.RefundGas(amount, descriptor)
+}
+
+type gasSampleKey struct {
+	origin     *spanOrigin
+	descriptor string
+	txHash     string
+}
+
+type gasSampleValue struct {
+	consumed, refunded int64
+	count              uint64
+}
+
+// gasProfileRecorder collects the gas of the traced spans of a block. On flush, it is written as pprof profile with
+// gas units as sample values when a dir is set and added to the gas report when set.
+// The span stack from the root span is the call stack with the gas descriptor as leaf.
+type gasProfileRecorder struct {
+	// dir is empty when no profiles are written
+	dir string
+	// report is nil when the gas is not aggregated
+	report *gasReport
+
+	mx      sync.Mutex
+	height  int64
+	txHash  string
+	order   []gasSampleKey
+	samples map[gasSampleKey]*gasSampleValue
+}
+
+func newGasProfileRecorder(dir string, report *gasReport) *gasProfileRecorder {
+	return &gasProfileRecorder{dir: dir, report: report, samples: make(map[gasSampleKey]*gasSampleValue)}
+}
+
+func (r *gasProfileRecorder) startBlock(height int64) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.height, r.txHash = height, ""
+}
+
+func (r *gasProfileRecorder) startTx(txHash string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.txHash = txHash
+}
+
+func (r *gasProfileRecorder) endTx() {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.txHash = ""
+}
+
+func (r *gasProfileRecorder) record(origin *spanOrigin, descriptor string, amount storetypes.Gas, refund bool) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	k := gasSampleKey{origin: origin, descriptor: descriptor, txHash: r.txHash}
+	v, ok := r.samples[k]
+	if !ok {
+		v = &gasSampleValue{}
+		r.samples[k] = v
+		r.order = append(r.order, k)
+	}
+	v.count++
+	if refund {
+		v.refunded += int64(amount)
+	} else {
+		v.consumed += int64(amount)
+	}
+}
+
+// gasProfile returns the pprof profile of the recorded gas in the given order
+func gasProfile(height int64, order []gasSampleKey, samples map[gasSampleKey]*gasSampleValue) *profile.Profile {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "gas_consumed", Unit: "gas"}, {Type: "gas_refunded", Unit: "gas"}},
+		PeriodType: &profile.ValueType{Type: "gas", Unit: "gas"},
+		Period:     1,
+	}
+	locations := make(map[string]*profile.Location)
+	location := func(name string) *profile.Location {
+		if l, ok := locations[name]; ok {
+			return l
+		}
+		f := &profile.Function{ID: uint64(len(p.Function) + 1), Name: name, SystemName: name}
+		p.Function = append(p.Function, f)
+		l := &profile.Location{ID: uint64(len(p.Location) + 1), Line: []profile.Line{{Function: f}}}
+		p.Location = append(p.Location, l)
+		locations[name] = l
+		return l
+	}
+	for _, k := range order {
+		v := samples[k]
+		// the leaf is first
+		stack := []*profile.Location{location(k.descriptor)}
+		for o := k.origin; o != nil; o = o.parent {
+			stack = append(stack, location(o.frame()))
+		}
+		s := &profile.Sample{
+			Location: stack,
+			Value:    []int64{v.consumed, v.refunded},
+			NumLabel: map[string][]int64{gasProfileLabelHeight: {height}},
+		}
+		if k.txHash != "" {
+			s.Label = map[string][]string{gasProfileLabelTx: {k.txHash}}
+		}
+		p.Sample = append(p.Sample, s)
+	}
+	return p
+}
+
+// flush writes the gas profile of the block to a file, adds it to the gas report and resets the recorder.
+// No file is written without gas.
+func (r *gasProfileRecorder) flush() error {
+	r.mx.Lock()
+	order, samples, height := r.order, r.samples, r.height
+	r.order, r.samples = nil, make(map[gasSampleKey]*gasSampleValue)
+	r.mx.Unlock()
+
+	if r.report != nil {
+		r.report.addBlock(height, order, samples)
+	}
+	if r.dir == "" || len(order) == 0 {
+		return nil
+	}
+	p := gasProfile(height, order, samples)
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(r.dir, gasProfileFileName(height))
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	// gzip compressed
+	if err := p.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func gasProfileFileName(height int64) string {
+	return fmt.Sprintf("%s%012d.pb.gz", gasProfileFilePrefix, height)
+}
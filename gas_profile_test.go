@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/google/pprof/profile"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordGasProfile(t *testing.T) {
+	t.Cleanup(func() { SetSampler(nil) })
+	specs := map[string]struct {
+		sampler *Sampler
+	}{
+		"sampled": {},
+		"not sampled": {
+			sampler: NewSampler(SamplingAction{Type: SamplingActionDrop}),
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			opentracing.SetGlobalTracer(mocktracer.New())
+			SetSampler(spec.sampler)
+			ctx, _, _ := createMinTestInput(t)
+			ctx = ctx.WithGasMeter(sdk.NewInfiniteGasMeter())
+			dir := t.TempDir()
+			recorder := newGasProfileRecorder(dir, nil)
+			activeGasProfile = recorder
+			t.Cleanup(func() { activeGasProfile = nil })
+			recorder.startBlock(7)
+			recorder.startTx("ABCD")
+
+			// when
+			p := SamplingParams{Operation: "new_msg_router", MsgTypes: []string{"/cosmwasm.wasm.v1.MsgExecuteContract"}}
+			DoWithTracingParams(ctx, p, StoreLogNothing, func(parentCtx sdk.Context, span opentracing.Span) error {
+				parentCtx.GasMeter().ConsumeGas(10, "outer")
+				p := SamplingParams{Operation: "messenger", Contracts: []string{"wasm1abc"}}
+				DoWithTracingParams(parentCtx, p, StoreLogNothing, func(workCtx sdk.Context, span opentracing.Span) error {
+					workCtx.GasMeter().ConsumeGas(5, "inner")
+					workCtx.GasMeter().ConsumeGas(3, "inner")
+					workCtx.GasMeter().RefundGas(2, "inner")
+					return nil
+				})
+				parentCtx.GasMeter().ConsumeGas(1, "outer")
+				return nil
+			})
+			recorder.endTx()
+			require.NoError(t, recorder.flush())
+
+			// then
+			assert.Equal(t, uint64(17), ctx.GasMeter().GasConsumed())
+			f, err := os.Open(filepath.Join(dir, "gasprofile-000000000007.pb.gz"))
+			require.NoError(t, err)
+			defer f.Close()
+			got, err := profile.Parse(f)
+			require.NoError(t, err)
+			require.Len(t, got.SampleType, 2)
+			assert.Equal(t, "gas_consumed", got.SampleType[0].Type)
+
+			type sample struct {
+				stack  []string
+				values []int64
+			}
+			var gotSamples []sample
+			for _, s := range got.Sample {
+				var stack []string
+				for _, l := range s.Location {
+					stack = append(stack, l.Line[0].Function.Name)
+				}
+				gotSamples = append(gotSamples, sample{stack: stack, values: s.Value})
+				assert.Equal(t, []string{"ABCD"}, s.Label[gasProfileLabelTx])
+				assert.Equal(t, []int64{7}, s.NumLabel[gasProfileLabelHeight])
+			}
+			exp := []sample{
+				{stack: []string{"outer", "new_msg_router /cosmwasm.wasm.v1.MsgExecuteContract"}, values: []int64{11, 0}},
+				{stack: []string{"inner", "messenger wasm1abc", "new_msg_router /cosmwasm.wasm.v1.MsgExecuteContract"}, values: []int64{8, 2}},
+			}
+			assert.Equal(t, exp, gotSamples)
+
+			// and reset
+			require.NoError(t, recorder.flush())
+			assert.Empty(t, recorder.samples)
+		})
+	}
+}
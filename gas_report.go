@@ -0,0 +1,215 @@
+package tracing
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// Gas report group by fields
+const (
+	GasReportByModule     = "module"
+	GasReportByMsgType    = "msg_type"
+	GasReportByContract   = "contract"
+	GasReportByCodeID     = "code_id"
+	GasReportByDescriptor = "descriptor"
+)
+
+// AllGasReportFields are the group by fields in column order
+var AllGasReportFields = []string{GasReportByModule, GasReportByMsgType, GasReportByContract, GasReportByCodeID, GasReportByDescriptor}
+
+// activeGasReport aggregates the block gas profiles when set
+var activeGasReport *gasReport
+
+// GasReportRow is the gas attributed to the innermost span attributes and the gas descriptor.
+// Attributes that are not grouped by are empty.
+type GasReportRow struct {
+	Module     string `json:"module,omitempty"`
+	MsgType    string `json:"msg_type,omitempty"`
+	Contract   string `json:"contract,omitempty"`
+	CodeID     string `json:"code_id,omitempty"`
+	Descriptor string `json:"descriptor,omitempty"`
+	Gas        uint64 `json:"gas"`
+	Refunded   uint64 `json:"refunded,omitempty"`
+	// Count is the number of gas meter calls
+	Count uint64 `json:"count"`
+}
+
+// Field returns the value of the group by field
+func (r GasReportRow) Field(name string) string {
+	switch name {
+	case GasReportByModule:
+		return r.Module
+	case GasReportByMsgType:
+		return r.MsgType
+	case GasReportByContract:
+		return r.Contract
+	case GasReportByCodeID:
+		return r.CodeID
+	case GasReportByDescriptor:
+		return r.Descriptor
+	default:
+		return ""
+	}
+}
+
+// GasReport is the gas attribution of the recent blocks. The rows are sorted by gas, descending.
+type GasReport struct {
+	FromHeight int64          `json:"from_height"`
+	ToHeight   int64          `json:"to_height"`
+	Blocks     int            `json:"blocks"`
+	GroupBy    []string       `json:"group_by"`
+	Rows       []GasReportRow `json:"rows"`
+}
+
+// ParseGasReportGroupBy parses the comma separated group by fields. All fields when empty
+func ParseGasReportGroupBy(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return AllGasReportFields, nil
+	}
+	var r []string
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if !containsAny(AllGasReportFields, f) {
+			return nil, fmt.Errorf("unsupported group by field: %q", f)
+		}
+		r = append(r, f)
+	}
+	return r, nil
+}
+
+type gasReportKey struct {
+	module, msgType, contract, codeID, descriptor string
+}
+
+type gasReportBlock struct {
+	height int64
+	rows   map[gasReportKey]*GasReportRow
+}
+
+// gasReport aggregates the gas of the block gas profiles over a window of recent blocks
+type gasReport struct {
+	mx        sync.Mutex
+	maxBlocks int
+	blocks    []gasReportBlock
+}
+
+func newGasReport(maxBlocks int) *gasReport {
+	return &gasReport{maxBlocks: maxBlocks}
+}
+
+// addBlock attributes the gas samples of the block. The oldest block leaves the window when it is full.
+func (g *gasReport) addBlock(height int64, order []gasSampleKey, samples map[gasSampleKey]*gasSampleValue) {
+	b := gasReportBlock{height: height, rows: make(map[gasReportKey]*GasReportRow)}
+	for _, k := range order {
+		key := gasReportKey{descriptor: k.descriptor}
+		if k.origin != nil {
+			key.module, key.msgType, key.contract = k.origin.attributes()
+			key.codeID = k.origin.innermostCodeID()
+		}
+		row, ok := b.rows[key]
+		if !ok {
+			row = &GasReportRow{Module: key.module, MsgType: key.msgType, Contract: key.contract, CodeID: key.codeID, Descriptor: key.descriptor}
+			b.rows[key] = row
+		}
+		v := samples[k]
+		row.Gas += uint64(v.consumed)
+		row.Refunded += uint64(v.refunded)
+		row.Count += v.count
+	}
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	g.blocks = append(g.blocks, b)
+	if len(g.blocks) > g.maxBlocks {
+		g.blocks = g.blocks[len(g.blocks)-g.maxBlocks:]
+	}
+}
+
+// report returns the gas attribution of the blocks in the window grouped by the fields
+func (g *gasReport) report(groupBy []string) GasReport {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	r := GasReport{Blocks: len(g.blocks), GroupBy: groupBy, Rows: []GasReportRow{}}
+	if len(g.blocks) == 0 {
+		return r
+	}
+	r.FromHeight, r.ToHeight = g.blocks[0].height, g.blocks[len(g.blocks)-1].height
+	grouped := make(map[gasReportKey]*GasReportRow)
+	for _, b := range g.blocks {
+		for _, row := range b.rows {
+			var key gasReportKey
+			for _, f := range groupBy {
+				switch f {
+				case GasReportByModule:
+					key.module = row.Module
+				case GasReportByMsgType:
+					key.msgType = row.MsgType
+				case GasReportByContract:
+					key.contract = row.Contract
+				case GasReportByCodeID:
+					key.codeID = row.CodeID
+				case GasReportByDescriptor:
+					key.descriptor = row.Descriptor
+				}
+			}
+			v, ok := grouped[key]
+			if !ok {
+				v = &GasReportRow{Module: key.module, MsgType: key.msgType, Contract: key.contract, CodeID: key.codeID, Descriptor: key.descriptor}
+				grouped[key] = v
+			}
+			v.Gas += row.Gas
+			v.Refunded += row.Refunded
+			v.Count += row.Count
+		}
+	}
+	for _, v := range grouped {
+		r.Rows = append(r.Rows, *v)
+	}
+	sort.Slice(r.Rows, func(i, j int) bool {
+		if r.Rows[i].Gas != r.Rows[j].Gas {
+			return r.Rows[i].Gas > r.Rows[j].Gas
+		}
+		for _, f := range AllGasReportFields {
+			if a, b := r.Rows[i].Field(f), r.Rows[j].Field(f); a != b {
+				return a < b
+			}
+		}
+		return false
+	})
+	return r
+}
+
+// RegisterGasReportRoutes registers the REST endpoint of the gas report, for example to the app's API router.
+// Query params: `group_by` with comma separated fields and `limit` for the number of rows.
+func RegisterGasReportRoutes(r *mux.Router) {
+	r.HandleFunc("/cosmos-tracing/v1/gas-report", func(w http.ResponseWriter, r *http.Request) {
+		report := activeGasReport
+		if report == nil {
+			writeJSONError(w, http.StatusNotFound, errors.New("gas report not enabled"))
+			return
+		}
+		groupBy, err := ParseGasReportGroupBy(r.URL.Query().Get("group_by"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		result := report.report(groupBy)
+		if v := r.URL.Query().Get("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit <= 0 {
+				writeJSONError(w, http.StatusBadRequest, errors.New("invalid limit"))
+				return
+			}
+			if limit < len(result.Rows) {
+				result.Rows = result.Rows[:limit]
+			}
+		}
+		writeJSON(w, http.StatusOK, result)
+	}).Methods(http.MethodGet)
+}
@@ -0,0 +1,116 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/gorilla/mux"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGasReportRoutes(t *testing.T) {
+	opentracing.SetGlobalTracer(mocktracer.New())
+	ctx, _, _ := createMinTestInput(t)
+	ctx = ctx.WithGasMeter(sdk.NewInfiniteGasMeter())
+	report := newGasReport(2)
+	recorder := newGasProfileRecorder("", report)
+	activeGasProfile, activeGasReport = recorder, report
+	t.Cleanup(func() { activeGasProfile, activeGasReport = nil, nil })
+
+	// when
+	for height, contracts := range [][]string{{"wasm1abc"}, {"wasm1abc", "wasm1def"}, {"wasm1abc"}} {
+		recorder.startBlock(int64(height + 1))
+		for _, contract := range contracts {
+			p := SamplingParams{Operation: "new_msg_router", MsgTypes: []string{"/cosmwasm.wasm.v1.MsgExecuteContract"}, Modules: []string{"wasm"}}
+			DoWithTracingParams(ctx, p, StoreLogNothing, func(parentCtx sdk.Context, span opentracing.Span) error {
+				parentCtx.GasMeter().ConsumeGas(1, "ReadFlat")
+				p := SamplingParams{Operation: "wasmvm_execute", Contracts: []string{contract}}
+				DoWithTracingParams(parentCtx, p, StoreLogNothing, func(workCtx sdk.Context, span opentracing.Span) error {
+					span.SetTag(tagCodeID, "1")
+					workCtx.GasMeter().ConsumeGas(100, "wasm contract")
+					workCtx.GasMeter().ConsumeGas(10, "WriteFlat")
+					return nil
+				})
+				return nil
+			})
+		}
+		require.NoError(t, recorder.flush())
+	}
+
+	// then
+	router := mux.NewRouter()
+	RegisterGasReportRoutes(router)
+	specs := map[string]struct {
+		path      string
+		expStatus int
+		exp       GasReport
+	}{
+		"by contract": {
+			path:      "/cosmos-tracing/v1/gas-report?group_by=contract",
+			expStatus: http.StatusOK,
+			exp: GasReport{FromHeight: 2, ToHeight: 3, Blocks: 2, GroupBy: []string{GasReportByContract}, Rows: []GasReportRow{
+				{Contract: "wasm1abc", Gas: 220, Count: 4},
+				{Contract: "wasm1def", Gas: 110, Count: 2},
+				{Gas: 3, Count: 3},
+			}},
+		},
+		"by module and descriptor with limit": {
+			path:      "/cosmos-tracing/v1/gas-report?group_by=module,descriptor&limit=2",
+			expStatus: http.StatusOK,
+			exp: GasReport{FromHeight: 2, ToHeight: 3, Blocks: 2, GroupBy: []string{GasReportByModule, GasReportByDescriptor}, Rows: []GasReportRow{
+				{Module: "wasm", Descriptor: "wasm contract", Gas: 300, Count: 3},
+				{Module: "wasm", Descriptor: "WriteFlat", Gas: 30, Count: 3},
+			}},
+		},
+		"all fields": {
+			path:      "/cosmos-tracing/v1/gas-report?limit=1",
+			expStatus: http.StatusOK,
+			exp: GasReport{FromHeight: 2, ToHeight: 3, Blocks: 2, GroupBy: AllGasReportFields, Rows: []GasReportRow{
+				{Module: "wasm", MsgType: "/cosmwasm.wasm.v1.MsgExecuteContract", Contract: "wasm1abc", CodeID: "1", Descriptor: "wasm contract", Gas: 200, Count: 2},
+			}},
+		},
+		"unknown field": {
+			path:      "/cosmos-tracing/v1/gas-report?group_by=foo",
+			expStatus: http.StatusBadRequest,
+		},
+		"invalid limit": {
+			path:      "/cosmos-tracing/v1/gas-report?limit=0",
+			expStatus: http.StatusBadRequest,
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, spec.path, nil))
+			require.Equal(t, spec.expStatus, rec.Code, rec.Body.String())
+			if spec.expStatus != http.StatusOK {
+				return
+			}
+			var got GasReport
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.Equal(t, spec.exp, got)
+		})
+	}
+}
+
+func TestPrintGasReport(t *testing.T) {
+	report := GasReport{FromHeight: 2, ToHeight: 3, Blocks: 2, GroupBy: []string{GasReportByContract}, Rows: []GasReportRow{
+		{Contract: "wasm1abc", Gas: 220, Count: 4},
+		{Gas: 3, Refunded: 1, Count: 3},
+	}}
+	var buf bytes.Buffer
+	require.NoError(t, printGasReport(&buf, report))
+	exp := `blocks 2 to 3 (2 blocks)
+CONTRACT  GAS  REFUNDED  COUNT
+wasm1abc  220  0         4
+-         3    1         3
+`
+	assert.Equal(t, exp, buf.String())
+}
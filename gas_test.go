@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceGasMeterUsage(t *testing.T) {
+	specs := map[string]struct {
+		gm  *TraceGasMeter
+		exp any
+	}{
+		"all": {
+			gm: NewTraceGasMeter(sdk.NewInfiniteGasMeter()),
+			exp: []GasTrace{
+				{Gas: 10, Descriptor: "ReadFlat", Offset: 0},
+				{Gas: 5, Descriptor: "ReadPerByte", Offset: 10},
+				{Gas: 30, Descriptor: "ReadFlat", Offset: 15},
+				{Gas: 20, Descriptor: "ReadFlat", Offset: 45},
+				{Gas: 7, Descriptor: "ReadFlat", Refund: true, Offset: 65},
+			},
+		},
+		"aggregate with last": {
+			gm: NewAggregatingTraceGasMeter(sdk.NewInfiniteGasMeter(), 2),
+			exp: GasTraceSummary{
+				Count: 5,
+				Aggregates: []GasTraceAggregate{
+					{Descriptor: "ReadFlat", Count: 3, Sum: 60, Min: 10, Max: 30, FirstOffset: 0, LastOffset: 45},
+					{Descriptor: "ReadPerByte", Count: 1, Sum: 5, Min: 5, Max: 5, FirstOffset: 10, LastOffset: 10},
+					{Descriptor: "ReadFlat", Refund: true, Count: 1, Sum: 7, Min: 7, Max: 7, FirstOffset: 65, LastOffset: 65},
+				},
+				Last: []GasTrace{
+					{Gas: 20, Descriptor: "ReadFlat", Offset: 45},
+					{Gas: 7, Descriptor: "ReadFlat", Refund: true, Offset: 65},
+				},
+			},
+		},
+		"aggregate only": {
+			gm: NewAggregatingTraceGasMeter(sdk.NewInfiniteGasMeter(), 0),
+			exp: GasTraceSummary{
+				Count: 5,
+				Aggregates: []GasTraceAggregate{
+					{Descriptor: "ReadFlat", Count: 3, Sum: 60, Min: 10, Max: 30, FirstOffset: 0, LastOffset: 45},
+					{Descriptor: "ReadPerByte", Count: 1, Sum: 5, Min: 5, Max: 5, FirstOffset: 10, LastOffset: 10},
+					{Descriptor: "ReadFlat", Refund: true, Count: 1, Sum: 7, Min: 7, Max: 7, FirstOffset: 65, LastOffset: 65},
+				},
+			},
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			// when
+			spec.gm.ConsumeGas(10, "ReadFlat")
+			spec.gm.ConsumeGas(5, "ReadPerByte")
+			spec.gm.ConsumeGas(30, "ReadFlat")
+			spec.gm.ConsumeGas(20, "ReadFlat")
+			spec.gm.RefundGas(7, "ReadFlat")
+
+			// then
+			assert.Equal(t, spec.exp, spec.gm.usage())
+			assert.Equal(t, uint64(58), spec.gm.GasConsumed())
+		})
+	}
+}
@@ -41,6 +41,11 @@ func NewTraceIBCHandler(other porttypes.IBCModule, moduleName string) porttypes.
 	return &TraceIBCHandler{other: other, moduleName: moduleName}
 }
 
+// sample returns the sampling decision for the subtree
+func (t TraceIBCHandler) sample(rootCtx sdk.Context, operation string, channelIDs ...string) (sdk.Context, bool) {
+	return sampleCtxWithOrigin(rootCtx, SamplingParams{Operation: operation, Modules: []string{t.moduleName}, IBCChannels: channelIDs})
+}
+
 func (t TraceIBCHandler) OnChanOpenInit(
 	rootCtx sdk.Context,
 	order channeltypes.Order,
@@ -54,7 +59,11 @@ func (t TraceIBCHandler) OnChanOpenInit(
 	if !IsTraceable(rootCtx) {
 		return t.other.OnChanOpenInit(rootCtx, order, connectionHops, portID, channelID, channelCap, counterparty, version)
 	}
-	DoWithTracing(rootCtx, "ibc_chan_open_init", all, func(workCtx sdk.Context, span opentracing.Span) error {
+	ctx, sampled := t.sample(rootCtx, "ibc_chan_open_init", channelID)
+	if !sampled {
+		return t.other.OnChanOpenInit(ctx, order, connectionHops, portID, channelID, channelCap, counterparty, version)
+	}
+	DoWithTracing(ctx, "ibc_chan_open_init", StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
 		span.SetTag(tagModule, t.moduleName)
 		v, err = t.other.OnChanOpenInit(workCtx, order, connectionHops, portID, channelID, channelCap, counterparty, version)
 		return err
@@ -74,7 +83,11 @@ func (t TraceIBCHandler) OnChanOpenTry(
 	if !IsTraceable(rootCtx) {
 		return t.other.OnChanOpenTry(rootCtx, order, connectionHops, portID, channelID, channelCap, counterparty, counterpartyVersion)
 	}
-	DoWithTracing(rootCtx, "ibc_chan_open_try", all, func(workCtx sdk.Context, span opentracing.Span) error {
+	ctx, sampled := t.sample(rootCtx, "ibc_chan_open_try", channelID)
+	if !sampled {
+		return t.other.OnChanOpenTry(ctx, order, connectionHops, portID, channelID, channelCap, counterparty, counterpartyVersion)
+	}
+	DoWithTracing(ctx, "ibc_chan_open_try", StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
 		span.SetTag(tagModule, t.moduleName)
 
 		version, err = t.other.OnChanOpenTry(workCtx, order, connectionHops, portID, channelID, channelCap, counterparty, counterpartyVersion)
@@ -95,7 +108,11 @@ func (t TraceIBCHandler) OnChanOpenAck(
 	if !IsTraceable(rootCtx) {
 		return t.other.OnChanOpenAck(rootCtx, portID, channelID, counterpartyChannelID, counterpartyVersion)
 	}
-	DoWithTracing(rootCtx, "ibc_chan_open_ack", all, func(workCtx sdk.Context, span opentracing.Span) error {
+	ctx, sampled := t.sample(rootCtx, "ibc_chan_open_ack", channelID)
+	if !sampled {
+		return t.other.OnChanOpenAck(ctx, portID, channelID, counterpartyChannelID, counterpartyVersion)
+	}
+	DoWithTracing(ctx, "ibc_chan_open_ack", StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
 		span.SetTag(tagModule, t.moduleName)
 		err = t.other.OnChanOpenAck(workCtx, portID, channelID, counterpartyChannelID, counterpartyVersion)
 		return err
@@ -107,7 +124,11 @@ func (t TraceIBCHandler) OnChanOpenConfirm(rootCtx sdk.Context, portID, channelI
 	if !IsTraceable(rootCtx) {
 		return t.other.OnChanOpenConfirm(rootCtx, portID, channelID)
 	}
-	DoWithTracing(rootCtx, "ibc_chan_open_confirm", all, func(workCtx sdk.Context, span opentracing.Span) error {
+	ctx, sampled := t.sample(rootCtx, "ibc_chan_open_confirm", channelID)
+	if !sampled {
+		return t.other.OnChanOpenConfirm(ctx, portID, channelID)
+	}
+	DoWithTracing(ctx, "ibc_chan_open_confirm", StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
 		span.SetTag(tagModule, t.moduleName)
 		err = t.other.OnChanOpenConfirm(workCtx, portID, channelID)
 		return err
@@ -120,7 +141,11 @@ func (t TraceIBCHandler) OnChanCloseInit(rootCtx sdk.Context, portID, channelID
 		return t.other.OnChanCloseInit(rootCtx, portID, channelID)
 	}
 
-	DoWithTracing(rootCtx, "ibc_chan_close_init", all, func(workCtx sdk.Context, span opentracing.Span) error {
+	ctx, sampled := t.sample(rootCtx, "ibc_chan_close_init", channelID)
+	if !sampled {
+		return t.other.OnChanCloseInit(ctx, portID, channelID)
+	}
+	DoWithTracing(ctx, "ibc_chan_close_init", StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
 		span.SetTag(tagModule, t.moduleName)
 		err = t.other.OnChanCloseInit(workCtx, portID, channelID)
 		return err
@@ -132,7 +157,11 @@ func (t TraceIBCHandler) OnChanCloseConfirm(rootCtx sdk.Context, portID, channel
 	if !IsTraceable(rootCtx) {
 		return t.other.OnChanCloseConfirm(rootCtx, portID, channelID)
 	}
-	DoWithTracing(rootCtx, "ibc_chan_close_confirm", all, func(workCtx sdk.Context, span opentracing.Span) error {
+	ctx, sampled := t.sample(rootCtx, "ibc_chan_close_confirm", channelID)
+	if !sampled {
+		return t.other.OnChanCloseConfirm(ctx, portID, channelID)
+	}
+	DoWithTracing(ctx, "ibc_chan_close_confirm", StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
 		span.SetTag(tagModule, t.moduleName)
 		err = t.other.OnChanCloseConfirm(workCtx, portID, channelID)
 		return err
@@ -169,7 +198,11 @@ func (t TraceIBCHandler) OnRecvPacket(rootCtx sdk.Context, packet channeltypes.P
 	if os.Getenv("no_tracing_ibcreceive") != "" {
 		return t.other.OnRecvPacket(rootCtx, packet, relayer)
 	}
-	DoWithTracing(rootCtx, "ibc_packet_recv", all, func(workCtx sdk.Context, span opentracing.Span) error {
+	ctx, sampled := t.sample(rootCtx, "ibc_packet_recv", packet.SourceChannel, packet.DestinationChannel)
+	if !sampled {
+		return t.other.OnRecvPacket(ctx, packet, relayer)
+	}
+	DoWithTracing(ctx, "ibc_packet_recv", StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
 		span.SetTag(tagModule, t.moduleName).
 			SetTag(tagIBCSrcPort, packet.SourcePort).
 			SetTag(tagIBCDestPort, packet.DestinationPort).
@@ -203,7 +236,11 @@ func (t TraceIBCHandler) OnAcknowledgementPacket(rootCtx sdk.Context, packet cha
 	if !IsTraceable(rootCtx) {
 		return t.other.OnAcknowledgementPacket(rootCtx, packet, acknowledgement, relayer)
 	}
-	DoWithTracing(rootCtx, "ibc_packet_ack", all, func(workCtx sdk.Context, span opentracing.Span) error {
+	ctx, sampled := t.sample(rootCtx, "ibc_packet_ack", packet.SourceChannel, packet.DestinationChannel)
+	if !sampled {
+		return t.other.OnAcknowledgementPacket(ctx, packet, acknowledgement, relayer)
+	}
+	DoWithTracing(ctx, "ibc_packet_ack", StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
 		span.SetTag(tagModule, t.moduleName).
 			SetTag(tagIBCSrcPort, packet.SourcePort).
 			SetTag(tagIBCDestPort, packet.DestinationPort).
@@ -223,7 +260,11 @@ func (t TraceIBCHandler) OnTimeoutPacket(rootCtx sdk.Context, packet channeltype
 	if !IsTraceable(rootCtx) {
 		return t.other.OnTimeoutPacket(rootCtx, packet, relayer)
 	}
-	DoWithTracing(rootCtx, "ibc_packet_timeout", all, func(workCtx sdk.Context, span opentracing.Span) error {
+	ctx, sampled := t.sample(rootCtx, "ibc_packet_timeout", packet.SourceChannel, packet.DestinationChannel)
+	if !sampled {
+		return t.other.OnTimeoutPacket(ctx, packet, relayer)
+	}
+	DoWithTracing(ctx, "ibc_packet_timeout", StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
 		span.SetTag(tagModule, t.moduleName).
 			SetTag(tagIBCSrcPort, packet.SourcePort).
 			SetTag(tagIBCDestPort, packet.DestinationPort).
@@ -0,0 +1,482 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	sdkmath "cosmossdk.io/math"
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	"github.com/cosmos/cosmos-sdk/codec"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	authtypes "github.com/cosmos/cosmos-sdk/x/auth/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	distrtypes "github.com/cosmos/cosmos-sdk/x/distribution/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types"
+	govv1 "github.com/cosmos/cosmos-sdk/x/gov/types/v1"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"github.com/cosmos/gogoproto/proto"
+	connectiontypes "github.com/cosmos/ibc-go/v7/modules/core/03-connection/types"
+	channeltypes "github.com/cosmos/ibc-go/v7/modules/core/04-channel/types"
+	host "github.com/cosmos/ibc-go/v7/modules/core/24-host"
+	ibcexported "github.com/cosmos/ibc-go/v7/modules/core/exported"
+)
+
+// KeyDecoder decodes a raw key of a store into a human readable description. The value is decoded when not nil.
+// ok is false when the key is not known to the decoder.
+type KeyDecoder func(key, value []byte) (keyDescr, valueDescr string, ok bool)
+
+var (
+	keyDecodersMx sync.RWMutex
+	keyDecoders   = make(map[string]KeyDecoder)
+)
+
+// RegisterKeyDecoder registers the decoder for the store name. An existing decoder is replaced.
+// Use it for the stores of custom modules.
+func RegisterKeyDecoder(storeName string, d KeyDecoder) {
+	keyDecodersMx.Lock()
+	defer keyDecodersMx.Unlock()
+	keyDecoders[storeName] = d
+}
+
+// RegisterDefaultKeyDecoders registers the built-in decoders for the bank, auth, staking, distribution, gov,
+// ibc and wasm stores. Values are unmarshalled with the app codec into JSON where possible.
+func RegisterDefaultKeyDecoders(cdc codec.Codec) {
+	RegisterKeyDecoder(banktypes.StoreKey, BankKeyDecoder(cdc))
+	RegisterKeyDecoder(authtypes.StoreKey, AuthKeyDecoder(cdc))
+	RegisterKeyDecoder(stakingtypes.StoreKey, StakingKeyDecoder(cdc))
+	RegisterKeyDecoder(distrtypes.StoreKey, DistributionKeyDecoder(cdc))
+	RegisterKeyDecoder(govtypes.StoreKey, GovKeyDecoder(cdc))
+	RegisterKeyDecoder(ibcexported.StoreKey, IBCKeyDecoder(cdc))
+	RegisterKeyDecoder(wasmtypes.StoreKey, WasmKeyDecoder(cdc))
+}
+
+func getKeyDecoder(storeName string) KeyDecoder {
+	keyDecodersMx.RLock()
+	defer keyDecodersMx.RUnlock()
+	return keyDecoders[storeName]
+}
+
+// describeStoreOp returns the decoded store operation, for example "bank balance wasm1... uatom: 100 -> 90".
+// The previous value is used for writes and deletes only. An empty string is returned when the key is not decoded.
+func describeStoreOp(d KeyDecoder, storeName, op string, key, prevValue, value []byte) (descr string) {
+	defer func() {
+		// decoders must not break the traced execution
+		if r := recover(); r != nil {
+			descr = ""
+		}
+	}()
+	keyDescr, valueDescr, ok := d(key, value)
+	if !ok {
+		return ""
+	}
+	if value == nil {
+		valueDescr = "nil"
+	}
+	switch op {
+	case StoreOpWrite, StoreOpDelete:
+		prevDescr := "nil"
+		if prevValue != nil {
+			_, prevDescr, _ = d(key, prevValue)
+		}
+		if op == StoreOpDelete {
+			valueDescr = "deleted"
+		}
+		return fmt.Sprintf("%s %s: %s -> %s", storeName, keyDescr, prevDescr, valueDescr)
+	default:
+		return fmt.Sprintf("%s %s: %s", storeName, keyDescr, valueDescr)
+	}
+}
+
+// keyPrefixCase decodes the keys with the prefix. The key function gets the key without the prefix.
+// The value is hex encoded when there is no value function.
+type keyPrefixCase struct {
+	prefix []byte
+	key    func(k []byte) (string, bool)
+	value  func(bz []byte) string
+}
+
+// prefixKeyDecoder returns a decoder for the first case with a matching key prefix
+func prefixKeyDecoder(cases ...keyPrefixCase) KeyDecoder {
+	return func(key, value []byte) (string, string, bool) {
+		for _, c := range cases {
+			if !bytes.HasPrefix(key, c.prefix) {
+				continue
+			}
+			keyDescr, ok := c.key(key[len(c.prefix):])
+			if !ok {
+				return "", "", false
+			}
+			switch {
+			case value == nil:
+				return keyDescr, "", true
+			case c.value == nil:
+				return keyDescr, hex.EncodeToString(value), true
+			default:
+				return keyDescr, c.value(value), true
+			}
+		}
+		return "", "", false
+	}
+}
+
+// BankKeyDecoder decodes the bank store keys for balances, supply, denom metadata and params
+func BankKeyDecoder(cdc codec.Codec) KeyDecoder {
+	return prefixKeyDecoder(
+		keyPrefixCase{prefix: banktypes.SupplyKey, key: named("supply", stringKey), value: intValue},
+		keyPrefixCase{prefix: banktypes.DenomMetadataPrefix, key: named("denom_metadata", stringKey), value: protoValue(cdc, func() codec.ProtoMarshaler { return &banktypes.Metadata{} })},
+		keyPrefixCase{prefix: banktypes.BalancesPrefix, key: func(k []byte) (string, bool) {
+			addr, denom, ok := lengthPrefixed(k)
+			if !ok {
+				return "", false
+			}
+			return fmt.Sprintf("balance %s %s", sdk.AccAddress(addr), denom), true
+		}, value: intValue},
+		keyPrefixCase{prefix: banktypes.DenomAddressPrefix, key: func(k []byte) (string, bool) {
+			pos := bytes.IndexByte(k, 0)
+			if pos == -1 {
+				return "", false
+			}
+			addr, _, ok := lengthPrefixed(k[pos+1:])
+			if !ok {
+				return "", false
+			}
+			return fmt.Sprintf("denom_owner %s %s", k[:pos], sdk.AccAddress(addr)), true
+		}},
+		keyPrefixCase{prefix: banktypes.SendEnabledPrefix, key: named("send_enabled", stringKey)},
+		keyPrefixCase{prefix: banktypes.ParamsKey, key: named("params", emptyKey), value: protoValue(cdc, func() codec.ProtoMarshaler { return &banktypes.Params{} })},
+	)
+}
+
+// AuthKeyDecoder decodes the auth store keys for accounts, account numbers and params
+func AuthKeyDecoder(cdc codec.Codec) KeyDecoder {
+	return prefixKeyDecoder(
+		keyPrefixCase{prefix: authtypes.GlobalAccountNumberKey, key: named("global_account_number", emptyKey)},
+		keyPrefixCase{prefix: authtypes.AccountNumberStoreKeyPrefix, key: named("account_number", bigEndianUint64Key), value: accAddressValue},
+		keyPrefixCase{prefix: authtypes.ParamsKey, key: named("params", emptyKey), value: protoValue(cdc, func() codec.ProtoMarshaler { return &authtypes.Params{} })},
+		keyPrefixCase{prefix: authtypes.AddressStoreKeyPrefix, key: named("account", rawAccAddressKey), value: func(bz []byte) string {
+			var acc authtypes.AccountI
+			if err := cdc.UnmarshalInterface(bz, &acc); err != nil {
+				return hex.EncodeToString(bz)
+			}
+			return interfaceJSON(cdc, acc, bz)
+		}},
+	)
+}
+
+// StakingKeyDecoder decodes the staking store keys for validators, delegations, unbondings, redelegations and params
+func StakingKeyDecoder(cdc codec.Codec) KeyDecoder {
+	return prefixKeyDecoder(
+		keyPrefixCase{prefix: stakingtypes.LastValidatorPowerKey, key: named("last_validator_power", valAddressKey)},
+		keyPrefixCase{prefix: stakingtypes.LastTotalPowerKey, key: named("last_total_power", emptyKey)},
+		keyPrefixCase{prefix: stakingtypes.ValidatorsKey, key: named("validator", valAddressKey), value: protoValue(cdc, func() codec.ProtoMarshaler { return &stakingtypes.Validator{} })},
+		keyPrefixCase{prefix: stakingtypes.ValidatorsByConsAddrKey, key: func(k []byte) (string, bool) {
+			addr, rest, ok := lengthPrefixed(k)
+			if !ok || len(rest) != 0 {
+				return "", false
+			}
+			return "validator_by_cons_addr " + sdk.ConsAddress(addr).String(), true
+		}, value: valAddressValue},
+		keyPrefixCase{prefix: stakingtypes.ValidatorsByPowerIndexKey, key: func(k []byte) (string, bool) {
+			addr := stakingtypes.ParseValidatorPowerRankKey(append(append([]byte{}, stakingtypes.ValidatorsByPowerIndexKey...), k...))
+			return "validator_by_power " + sdk.ValAddress(addr).String(), true
+		}},
+		keyPrefixCase{prefix: stakingtypes.DelegationKey, key: named("delegation", delValAddressKey), value: protoValue(cdc, func() codec.ProtoMarshaler { return &stakingtypes.Delegation{} })},
+		keyPrefixCase{prefix: stakingtypes.UnbondingDelegationKey, key: named("unbonding_delegation", delValAddressKey), value: protoValue(cdc, func() codec.ProtoMarshaler { return &stakingtypes.UnbondingDelegation{} })},
+		keyPrefixCase{prefix: stakingtypes.RedelegationKey, key: func(k []byte) (string, bool) {
+			del, rest, ok := lengthPrefixed(k)
+			if !ok {
+				return "", false
+			}
+			src, rest, ok := lengthPrefixed(rest)
+			if !ok {
+				return "", false
+			}
+			dst, rest, ok := lengthPrefixed(rest)
+			if !ok || len(rest) != 0 {
+				return "", false
+			}
+			return fmt.Sprintf("redelegation %s %s %s", sdk.AccAddress(del), sdk.ValAddress(src), sdk.ValAddress(dst)), true
+		}, value: protoValue(cdc, func() codec.ProtoMarshaler { return &stakingtypes.Redelegation{} })},
+		keyPrefixCase{prefix: stakingtypes.HistoricalInfoKey, key: named("historical_info", stringKey), value: protoValue(cdc, func() codec.ProtoMarshaler { return &stakingtypes.HistoricalInfo{} })},
+		keyPrefixCase{prefix: stakingtypes.ParamsKey, key: named("params", emptyKey), value: protoValue(cdc, func() codec.ProtoMarshaler { return &stakingtypes.Params{} })},
+	)
+}
+
+// DistributionKeyDecoder decodes the distribution store keys for the fee pool, rewards, commissions and params
+func DistributionKeyDecoder(cdc codec.Codec) KeyDecoder {
+	return prefixKeyDecoder(
+		keyPrefixCase{prefix: distrtypes.FeePoolKey, key: named("fee_pool", emptyKey), value: protoValue(cdc, func() codec.ProtoMarshaler { return &distrtypes.FeePool{} })},
+		keyPrefixCase{prefix: distrtypes.ProposerKey, key: named("proposer", emptyKey)},
+		keyPrefixCase{prefix: distrtypes.ValidatorOutstandingRewardsPrefix, key: named("outstanding_rewards", valAddressKey), value: protoValue(cdc, func() codec.ProtoMarshaler { return &distrtypes.ValidatorOutstandingRewards{} })},
+		keyPrefixCase{prefix: distrtypes.DelegatorWithdrawAddrPrefix, key: named("withdraw_address", accAddressKey), value: accAddressValue},
+		keyPrefixCase{prefix: distrtypes.DelegatorStartingInfoPrefix, key: func(k []byte) (string, bool) {
+			val, rest, ok := lengthPrefixed(k)
+			if !ok {
+				return "", false
+			}
+			del, rest, ok := lengthPrefixed(rest)
+			if !ok || len(rest) != 0 {
+				return "", false
+			}
+			return fmt.Sprintf("delegator_starting_info %s %s", sdk.ValAddress(val), sdk.AccAddress(del)), true
+		}, value: protoValue(cdc, func() codec.ProtoMarshaler { return &distrtypes.DelegatorStartingInfo{} })},
+		keyPrefixCase{prefix: distrtypes.ValidatorHistoricalRewardsPrefix, key: func(k []byte) (string, bool) {
+			val, rest, ok := lengthPrefixed(k)
+			if !ok || len(rest) != 8 {
+				return "", false
+			}
+			return fmt.Sprintf("historical_rewards %s %d", sdk.ValAddress(val), binary.LittleEndian.Uint64(rest)), true
+		}, value: protoValue(cdc, func() codec.ProtoMarshaler { return &distrtypes.ValidatorHistoricalRewards{} })},
+		keyPrefixCase{prefix: distrtypes.ValidatorCurrentRewardsPrefix, key: named("current_rewards", valAddressKey), value: protoValue(cdc, func() codec.ProtoMarshaler { return &distrtypes.ValidatorCurrentRewards{} })},
+		keyPrefixCase{prefix: distrtypes.ValidatorAccumulatedCommissionPrefix, key: named("accumulated_commission", valAddressKey), value: protoValue(cdc, func() codec.ProtoMarshaler { return &distrtypes.ValidatorAccumulatedCommission{} })},
+		keyPrefixCase{prefix: distrtypes.ValidatorSlashEventPrefix, key: func(k []byte) (string, bool) {
+			val, rest, ok := lengthPrefixed(k)
+			if !ok {
+				return "", false
+			}
+			return fmt.Sprintf("slash_event %s %x", sdk.ValAddress(val), rest), true
+		}, value: protoValue(cdc, func() codec.ProtoMarshaler { return &distrtypes.ValidatorSlashEvent{} })},
+		keyPrefixCase{prefix: distrtypes.ParamsKey, key: named("params", emptyKey), value: protoValue(cdc, func() codec.ProtoMarshaler { return &distrtypes.Params{} })},
+	)
+}
+
+// GovKeyDecoder decodes the gov store keys for proposals, deposits, votes and params
+func GovKeyDecoder(cdc codec.Codec) KeyDecoder {
+	proposalAddrKey := func(k []byte) (string, bool) {
+		if len(k) < 9 {
+			return "", false
+		}
+		addr, rest, ok := lengthPrefixed(k[8:])
+		if !ok || len(rest) != 0 {
+			return "", false
+		}
+		return fmt.Sprintf("%d %s", govtypes.GetProposalIDFromBytes(k[:8]), sdk.AccAddress(addr)), true
+	}
+	proposalQueueKey := func(k []byte) (string, bool) {
+		if len(k) < 8 {
+			return "", false
+		}
+		return fmt.Sprintf("%d %x", govtypes.GetProposalIDFromBytes(k[len(k)-8:]), k[:len(k)-8]), true
+	}
+	return prefixKeyDecoder(
+		keyPrefixCase{prefix: govtypes.ProposalsKeyPrefix, key: named("proposal", bigEndianUint64Key), value: protoValue(cdc, func() codec.ProtoMarshaler { return &govv1.Proposal{} })},
+		keyPrefixCase{prefix: govtypes.ActiveProposalQueuePrefix, key: named("active_proposal_queue", proposalQueueKey)},
+		keyPrefixCase{prefix: govtypes.InactiveProposalQueuePrefix, key: named("inactive_proposal_queue", proposalQueueKey)},
+		keyPrefixCase{prefix: govtypes.ProposalIDKey, key: named("proposal_id", emptyKey), value: uint64Value},
+		keyPrefixCase{prefix: govtypes.VotingPeriodProposalKeyPrefix, key: named("voting_period_proposal", bigEndianUint64Key)},
+		keyPrefixCase{prefix: govtypes.DepositsKeyPrefix, key: named("deposit", proposalAddrKey), value: protoValue(cdc, func() codec.ProtoMarshaler { return &govv1.Deposit{} })},
+		keyPrefixCase{prefix: govtypes.VotesKeyPrefix, key: named("vote", proposalAddrKey), value: protoValue(cdc, func() codec.ProtoMarshaler { return &govv1.Vote{} })},
+		keyPrefixCase{prefix: govtypes.ParamsKey, key: named("params", emptyKey), value: protoValue(cdc, func() codec.ProtoMarshaler { return &govv1.Params{} })},
+	)
+}
+
+// IBCKeyDecoder decodes the ibc store paths. Client and consensus states, connections, channels and
+// sequences are decoded, other values like commitments are hex encoded.
+func IBCKeyDecoder(cdc codec.Codec) KeyDecoder {
+	return func(key, value []byte) (string, string, bool) {
+		if !isPrintable(key) {
+			return "", "", false
+		}
+		path := string(key)
+		if value == nil {
+			return path, "", true
+		}
+		switch {
+		case strings.HasPrefix(path, string(host.KeyClientStorePrefix)) && strings.HasSuffix(path, host.KeyClientState):
+			var cs ibcexported.ClientState
+			if err := cdc.UnmarshalInterface(value, &cs); err != nil {
+				return path, hex.EncodeToString(value), true
+			}
+			return path, interfaceJSON(cdc, cs, value), true
+		case strings.HasPrefix(path, string(host.KeyClientStorePrefix)) && strings.Contains(path, host.KeyConsensusStatePrefix+"/"):
+			var cs ibcexported.ConsensusState
+			if err := cdc.UnmarshalInterface(value, &cs); err != nil {
+				return path, hex.EncodeToString(value), true
+			}
+			return path, interfaceJSON(cdc, cs, value), true
+		case strings.HasPrefix(path, host.KeyConnectionPrefix+"/"):
+			return path, protoValue(cdc, func() codec.ProtoMarshaler { return &connectiontypes.ConnectionEnd{} })(value), true
+		case strings.HasPrefix(path, host.KeyChannelEndPrefix+"/"):
+			return path, protoValue(cdc, func() codec.ProtoMarshaler { return &channeltypes.Channel{} })(value), true
+		case strings.HasPrefix(path, host.KeyNextSeqSendPrefix+"/"),
+			strings.HasPrefix(path, host.KeyNextSeqRecvPrefix+"/"),
+			strings.HasPrefix(path, host.KeyNextSeqAckPrefix+"/"):
+			return path, uint64Value(value), true
+		default:
+			return path, hex.EncodeToString(value), true
+		}
+	}
+}
+
+// WasmKeyDecoder decodes the wasm store keys for codes, contracts, contract state, sequences and params.
+// Contract state keys are split into the cw-storage-plus namespace and key parts.
+func WasmKeyDecoder(cdc codec.Codec) KeyDecoder {
+	return prefixKeyDecoder(
+		keyPrefixCase{prefix: wasmtypes.CodeKeyPrefix, key: named("code", bigEndianUint64Key), value: protoValue(cdc, func() codec.ProtoMarshaler { return &wasmtypes.CodeInfo{} })},
+		keyPrefixCase{prefix: wasmtypes.ContractKeyPrefix, key: named("contract", func(k []byte) (string, bool) {
+			return sdk.AccAddress(k).String(), len(k) != 0
+		}), value: protoValue(cdc, func() codec.ProtoMarshaler { return &wasmtypes.ContractInfo{} })},
+		keyPrefixCase{prefix: wasmtypes.ContractStorePrefix, key: func(k []byte) (string, bool) {
+			if len(k) < wasmtypes.ContractAddrLen {
+				return "", false
+			}
+			return fmt.Sprintf("contract_state %s %s", sdk.AccAddress(k[:wasmtypes.ContractAddrLen]), cwStorageKey(k[wasmtypes.ContractAddrLen:])), true
+		}, value: cwStorageValue},
+		keyPrefixCase{prefix: wasmtypes.SequenceKeyPrefix, key: named("sequence", stringKey), value: uint64Value},
+		keyPrefixCase{prefix: wasmtypes.ContractCodeHistoryElementPrefix, key: func(k []byte) (string, bool) {
+			if len(k) != wasmtypes.ContractAddrLen+8 {
+				return "", false
+			}
+			return fmt.Sprintf("contract_history %s %d", sdk.AccAddress(k[:wasmtypes.ContractAddrLen]), binary.BigEndian.Uint64(k[wasmtypes.ContractAddrLen:])), true
+		}, value: protoValue(cdc, func() codec.ProtoMarshaler { return &wasmtypes.ContractCodeHistoryEntry{} })},
+		keyPrefixCase{prefix: wasmtypes.PinnedCodeIndexPrefix, key: named("pinned_code", bigEndianUint64Key)},
+		keyPrefixCase{prefix: wasmtypes.ParamsKey, key: named("params", emptyKey), value: protoValue(cdc, func() codec.ProtoMarshaler { return &wasmtypes.Params{} })},
+	)
+}
+
+// named prefixes the decoded key with the name
+func named(name string, key func(k []byte) (string, bool)) func(k []byte) (string, bool) {
+	return func(k []byte) (string, bool) {
+		s, ok := key(k)
+		if !ok {
+			return "", false
+		}
+		if s == "" {
+			return name, true
+		}
+		return name + " " + s, true
+	}
+}
+
+func emptyKey(k []byte) (string, bool) {
+	return "", len(k) == 0
+}
+
+func stringKey(k []byte) (string, bool) {
+	return string(k), isPrintable(k)
+}
+
+func bigEndianUint64Key(k []byte) (string, bool) {
+	if len(k) != 8 {
+		return "", false
+	}
+	return strconv.FormatUint(binary.BigEndian.Uint64(k), 10), true
+}
+
+func accAddressKey(k []byte) (string, bool) {
+	addr, rest, ok := lengthPrefixed(k)
+	if !ok || len(rest) != 0 {
+		return "", false
+	}
+	return sdk.AccAddress(addr).String(), true
+}
+
+// rawAccAddressKey decodes an address without length prefix, like in the auth account keys
+func rawAccAddressKey(k []byte) (string, bool) {
+	if len(k) == 0 {
+		return "", false
+	}
+	return sdk.AccAddress(k).String(), true
+}
+
+func valAddressKey(k []byte) (string, bool) {
+	addr, rest, ok := lengthPrefixed(k)
+	if !ok || len(rest) != 0 {
+		return "", false
+	}
+	return sdk.ValAddress(addr).String(), true
+}
+
+func delValAddressKey(k []byte) (string, bool) {
+	del, rest, ok := lengthPrefixed(k)
+	if !ok {
+		return "", false
+	}
+	val, rest, ok := lengthPrefixed(rest)
+	if !ok || len(rest) != 0 {
+		return "", false
+	}
+	return fmt.Sprintf("%s %s", sdk.AccAddress(del), sdk.ValAddress(val)), true
+}
+
+// lengthPrefixed splits the length prefixed address from the remaining bytes
+func lengthPrefixed(bz []byte) (addr, rest []byte, ok bool) {
+	if len(bz) == 0 || len(bz) < 1+int(bz[0]) {
+		return nil, nil, false
+	}
+	n := int(bz[0])
+	return bz[1 : 1+n], bz[1+n:], true
+}
+
+// protoValue unmarshals the value into the proto type and returns it as JSON or hex encoded on failure
+func protoValue(cdc codec.Codec, newMsg func() codec.ProtoMarshaler) func(bz []byte) string {
+	return func(bz []byte) string {
+		msg := newMsg()
+		if err := cdc.Unmarshal(bz, msg); err != nil {
+			return hex.EncodeToString(bz)
+		}
+		js, err := cdc.MarshalJSON(msg)
+		if err != nil {
+			return hex.EncodeToString(bz)
+		}
+		return string(js)
+	}
+}
+
+func interfaceJSON(cdc codec.Codec, msg proto.Message, bz []byte) string {
+	js, err := cdc.MarshalInterfaceJSON(msg)
+	if err != nil {
+		return hex.EncodeToString(bz)
+	}
+	return string(js)
+}
+
+func intValue(bz []byte) string {
+	var amount sdkmath.Int
+	if err := amount.Unmarshal(bz); err != nil {
+		return hex.EncodeToString(bz)
+	}
+	return amount.String()
+}
+
+func uint64Value(bz []byte) string {
+	if len(bz) != 8 {
+		return hex.EncodeToString(bz)
+	}
+	return strconv.FormatUint(binary.BigEndian.Uint64(bz), 10)
+}
+
+func accAddressValue(bz []byte) string {
+	return sdk.AccAddress(bz).String()
+}
+
+func valAddressValue(bz []byte) string {
+	return sdk.ValAddress(bz).String()
+}
+
+// printableOrHex returns the bytes as string when printable or hex encoded otherwise
+func printableOrHex(bz []byte) string {
+	if isPrintable(bz) {
+		return string(bz)
+	}
+	return hex.EncodeToString(bz)
+}
+
+func isPrintable(bz []byte) bool {
+	if !utf8.Valid(bz) {
+		return false
+	}
+	for _, r := range string(bz) {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,185 @@
+package tracing
+
+import (
+	"encoding/binary"
+	"testing"
+
+	sdkmath "cosmossdk.io/math"
+	"github.com/cometbft/cometbft/libs/rand"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/address"
+	authtypes "github.com/cosmos/cosmos-sdk/x/auth/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	host "github.com/cosmos/ibc-go/v7/modules/core/24-host"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+)
+
+func TestDescribeStoreOp(t *testing.T) {
+	_, cdc, _ := createMinTestInput(t)
+	myAddr := sdk.AccAddress(rand.Bytes(address.Len))
+	myContract := sdk.AccAddress(rand.Bytes(wasmtypes.ContractAddrLen))
+	myVal := sdk.ValAddress(rand.Bytes(address.Len))
+	authtypes.RegisterInterfaces(cdc.InterfaceRegistry())
+	myAccount := authtypes.NewBaseAccount(myAddr, nil, 7, 1)
+	accountBz, err := cdc.MarshalInterface(authtypes.AccountI(myAccount))
+	require.NoError(t, err)
+	amount := func(v int64) []byte {
+		bz, err := sdkmath.NewInt(v).Marshal()
+		require.NoError(t, err)
+		return bz
+	}
+	specs := map[string]struct {
+		decoder        KeyDecoder
+		store, op      string
+		key, prev, val []byte
+		exp            string
+	}{
+		"bank balance write": {
+			decoder: BankKeyDecoder(cdc), store: "bank", op: StoreOpWrite,
+			key:  banktypes.CreatePrefixedAccountStoreKey(myAddr, []byte("uatom")),
+			prev: amount(100), val: amount(90),
+			exp: "bank balance " + myAddr.String() + " uatom: 100 -> 90",
+		},
+		"bank balance new": {
+			decoder: BankKeyDecoder(cdc), store: "bank", op: StoreOpWrite,
+			key: banktypes.CreatePrefixedAccountStoreKey(myAddr, []byte("uatom")),
+			val: amount(1),
+			exp: "bank balance " + myAddr.String() + " uatom: nil -> 1",
+		},
+		"bank supply delete": {
+			decoder: BankKeyDecoder(cdc), store: "bank", op: StoreOpDelete,
+			key:  append(banktypes.SupplyKey, []byte("uatom")...),
+			prev: amount(100),
+			exp:  "bank supply uatom: 100 -> deleted",
+		},
+		"auth account read": {
+			decoder: AuthKeyDecoder(cdc), store: "acc", op: StoreOpRead,
+			key: authtypes.AddressStoreKey(myAddr),
+			val: accountBz,
+			exp: "acc account " + myAddr.String() + `: {"@type":"/cosmos.auth.v1beta1.BaseAccount","address":"` + myAddr.String() +
+				`","pub_key":null,"account_number":"7","sequence":"1"}`,
+		},
+		"staking delegation read": {
+			decoder: StakingKeyDecoder(cdc), store: "staking", op: StoreOpRead,
+			key: stakingtypes.GetDelegationKey(myAddr, myVal),
+			val: cdc.MustMarshal(&stakingtypes.Delegation{DelegatorAddress: myAddr.String(), ValidatorAddress: myVal.String(), Shares: sdk.OneDec()}),
+			exp: "staking delegation " + myAddr.String() + " " + myVal.String() +
+				`: {"delegator_address":"` + myAddr.String() + `","validator_address":"` + myVal.String() + `","shares":"1.000000000000000000"}`,
+		},
+		"gov vote missing": {
+			decoder: GovKeyDecoder(cdc), store: "gov", op: StoreOpRead,
+			key: govtypes.VoteKey(1, myAddr),
+			exp: "gov vote 1 " + myAddr.String() + ": nil",
+		},
+		"ibc next sequence": {
+			decoder: IBCKeyDecoder(cdc), store: "ibc", op: StoreOpWrite,
+			key:  host.NextSequenceSendKey("transfer", "channel-0"),
+			prev: sdk.Uint64ToBigEndian(1), val: sdk.Uint64ToBigEndian(2),
+			exp: "ibc nextSequenceSend/ports/transfer/channels/channel-0: 1 -> 2",
+		},
+		"wasm contract state": {
+			decoder: WasmKeyDecoder(cdc), store: "wasm", op: StoreOpRead,
+			key: append(wasmtypes.GetContractStorePrefix(myContract), []byte("config")...),
+			val: []byte(`{"owner":"me"}`),
+			exp: "wasm contract_state " + myContract.String() + ` config: {"owner":"me"}`,
+		},
+		"wasm contract map entry": {
+			decoder: WasmKeyDecoder(cdc), store: "wasm", op: StoreOpWrite,
+			key:  append(wasmtypes.GetContractStorePrefix(myContract), cwMapKey("balances", []byte(myAddr.String()))...),
+			prev: []byte(`"400"`), val: []byte(`"500"`),
+			exp: "wasm contract_state " + myContract.String() + " balances[" + myAddr.String() + "]: 400 -> 500",
+		},
+		"unknown key": {
+			decoder: BankKeyDecoder(cdc), store: "bank", op: StoreOpRead,
+			key: []byte{0xff},
+			val: []byte{0x1},
+		},
+		"panic in decoder": {
+			decoder: func(key, value []byte) (string, string, bool) { panic("testing") },
+			store:   "custom", op: StoreOpRead,
+			key: []byte{0x1},
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			got := describeStoreOp(spec.decoder, spec.store, spec.op, spec.key, spec.prev, spec.val)
+			assert.Equal(t, spec.exp, got)
+		})
+	}
+}
+
+func TestRegisterKeyDecoder(t *testing.T) {
+	storeOpsLog = true
+	t.Cleanup(func() { storeOpsLog = false })
+	ctx, _, storeKey := createMinTestInput(t)
+	RegisterKeyDecoder(storeKey.Name(), func(key, value []byte) (string, string, bool) {
+		return "my " + string(key), string(value), true
+	})
+	t.Cleanup(func() { RegisterKeyDecoder(storeKey.Name(), nil) })
+	ctx.KVStore(storeKey).Set([]byte("foo"), []byte("bar"))
+	ms := NewTracingMultiStore(ctx.MultiStore(), false)
+
+	// when
+	store := ms.GetKVStore(storeKey)
+	store.Get([]byte("foo"))
+	store.Set([]byte("foo"), []byte("baz"))
+	store.Set([]byte("other"), []byte("value"))
+
+	// then
+	ops := ms.ops.all()
+	require.Len(t, ops, 3)
+	assert.Equal(t, storeKey.Name()+" my foo: bar", ops[0].Decoded)
+	assert.Equal(t, storeKey.Name()+" my foo: bar -> baz", ops[1].Decoded)
+	// previous value not known without an operation on the key before
+	assert.Equal(t, storeKey.Name()+" my other: nil -> value", ops[2].Decoded)
+}
+
+func TestCwStorageKey(t *testing.T) {
+	specs := map[string]struct {
+		key []byte
+		exp string
+	}{
+		"item": {
+			key: []byte("config"),
+			exp: "config",
+		},
+		"map": {
+			key: cwMapKey("balances", []byte("wasm1abc")),
+			exp: "balances[wasm1abc]",
+		},
+		"composite map key": {
+			key: cwMapKey("allowances", []byte("wasm1abc"), []byte("wasm1def")),
+			exp: "allowances[wasm1abc, wasm1def]",
+		},
+		"u64 map key": {
+			key: cwMapKey("proposals", sdk.Uint64ToBigEndian(7)),
+			exp: "proposals[7]",
+		},
+		"binary": {
+			key: []byte{0xff, 0xff, 0x01},
+			exp: "ffff01",
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, spec.exp, cwStorageKey(spec.key))
+		})
+	}
+}
+
+// cwMapKey builds a cw-storage-plus map key with the length prefixed namespace and key parts
+func cwMapKey(namespace string, parts ...[]byte) []byte {
+	r := append(binary.BigEndian.AppendUint16(nil, uint16(len(namespace))), namespace...)
+	for i, p := range parts {
+		if i != len(parts)-1 {
+			r = binary.BigEndian.AppendUint16(r, uint16(len(p)))
+		}
+		r = append(r, p...)
+	}
+	return r
+}
@@ -0,0 +1,160 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/cometbft/cometbft/libs/log"
+	"github.com/opentracing/opentracing-go"
+	"go.opentelemetry.io/otel"
+	otelbridge "go.opentelemetry.io/otel/bridge/opentracing"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// Supported tracer backends
+const (
+	ExporterJaeger   = "jaeger"
+	ExporterOTLPGRPC = "otlp-grpc"
+	ExporterOTLPHTTP = "otlp-http"
+	ExporterFile     = "file"
+	ExporterStore    = "store"
+)
+
+// shutdown timeout for flushing pending spans to the exporter
+const otelShutdownTimeout = 5 * time.Second
+
+// StartOTelTracer sets up an OpenTelemetry SDK pipeline with an OTLP, file or embedded store exporter. The pipeline is bridged
+// to the opentracing API so that all `DoWithTracing` call sites work unchanged.
+// The returned closer flushes and shuts down the pipeline. Reported spans are logged to the logger when LogSpans is set.
+func StartOTelTracer(cfg TracerConfig, logger log.Logger) (io.Closer, error) {
+	exp, err := newSpanExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sampler, err := newOTelSampler(cfg.SamplerType, cfg.SamplerParam)
+	if err != nil {
+		return nil, err
+	}
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithBatcher(exp,
+			sdktrace.WithMaxQueueSize(cfg.QueueSize),
+			sdktrace.WithBatchTimeout(cfg.FlushInterval),
+		),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName))),
+	}
+	if cfg.LogSpans {
+		opts = append(opts, sdktrace.WithSpanProcessor(logSpanProcessor{logger: logger}))
+	}
+	store, _ := exp.(*TraceStore)
+	activeTraceStore.Store(store)
+	tp := sdktrace.NewTracerProvider(opts...)
+	bridgeTracer, wrapperProvider := otelbridge.NewTracerPair(tp.Tracer(cfg.ServiceName))
+	otel.SetTracerProvider(wrapperProvider)
+	opentracing.SetGlobalTracer(bridgeTracer)
+	return closerFunc(func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), otelShutdownTimeout)
+		defer cancel()
+		err := tp.Shutdown(ctx)
+		if store != nil {
+			activeTraceStore.CompareAndSwap(store, nil)
+		}
+		return err
+	}), nil
+}
+
+func newSpanExporter(cfg TracerConfig) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case ExporterFile:
+		return NewFileSpanExporter(cfg.FileDir, cfg.FileMaxSize, cfg.FileCompress)
+	case ExporterStore:
+		return OpenTraceStore(cfg.StoreDir, uint64(cfg.StoreRetainBlocks))
+	}
+	return newOTLPExporter(cfg.Exporter, cfg.CollectorEndpoint, cfg.CollectorInsecure)
+}
+
+func newOTLPExporter(exporter, endpoint string, insecure bool) (*otlptrace.Exporter, error) {
+	ctx := context.Background()
+	switch exporter {
+	case ExporterOTLPGRPC:
+		opts := []otlptracegrpc.Option{}
+		if endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(endpoint))
+		}
+		if insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	case ExporterOTLPHTTP:
+		opts := []otlptracehttp.Option{}
+		if endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(endpoint))
+		}
+		if insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported otlp exporter: %q", exporter)
+	}
+}
+
+func newOTelSampler(samplerType string, param float64) (sdktrace.Sampler, error) {
+	switch samplerType {
+	case SamplerTypeConst:
+		if param >= 1 {
+			return sdktrace.AlwaysSample(), nil
+		}
+		return sdktrace.NeverSample(), nil
+	case SamplerTypeProbabilistic:
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(param)), nil
+	default:
+		return nil, fmt.Errorf("unsupported otel sampler type: %q", samplerType)
+	}
+}
+
+var _ sdktrace.SpanProcessor = logSpanProcessor{}
+
+// logSpanProcessor logs every finished span at info level
+type logSpanProcessor struct {
+	logger log.Logger
+}
+
+func (l logSpanProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (l logSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	l.logger.Info("reporting span", "trace_id", s.SpanContext().TraceID().String(), "span_id", s.SpanContext().SpanID().String(), "name", s.Name())
+}
+
+func (l logSpanProcessor) Shutdown(context.Context) error { return nil }
+
+func (l logSpanProcessor) ForceFlush(context.Context) error { return nil }
+
+// jaegerLogger adapter to the jaeger client logger
+type jaegerLogger struct {
+	logger log.Logger
+}
+
+func (j jaegerLogger) Error(msg string) {
+	j.logger.Error(msg)
+}
+
+func (j jaegerLogger) Infof(msg string, args ...interface{}) {
+	j.logger.Info(fmt.Sprintf(msg, args...))
+}
+
+var _ io.Closer = closerFunc(nil)
+
+// closerFunc adapter to io.Closer
+type closerFunc func() error
+
+func (c closerFunc) Close() error {
+	return c()
+}
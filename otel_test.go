@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cometbft/cometbft/libs/log"
+	"github.com/cosmos/cosmos-sdk/types"
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracev1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestStartOTelTracer(t *testing.T) {
+	specs := map[string]struct {
+		exporter  string
+		collector func(t *testing.T, c *otlpCollectorStub) string
+	}{
+		"grpc": {
+			exporter:  ExporterOTLPGRPC,
+			collector: startGRPCCollector,
+		},
+		"http": {
+			exporter:  ExporterOTLPHTTP,
+			collector: startHTTPCollector,
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			t.Cleanup(func() { opentracing.SetGlobalTracer(opentracing.NoopTracer{}) })
+			var collector otlpCollectorStub
+			endpoint := spec.collector(t, &collector)
+
+			cfg := DefaultTracerConfig()
+			cfg.ServiceName, cfg.Exporter, cfg.CollectorEndpoint, cfg.CollectorInsecure = "testapp", spec.exporter, endpoint, true
+			closer, err := StartOTelTracer(cfg, log.NewNopLogger())
+			require.NoError(t, err)
+
+			ctx, _, _ := createMinTestInput(t)
+			DoWithTracing(ctx, "my-op", StoreLogAll, func(parentCtx types.Context, span opentracing.Span) error {
+				DoWithTracing(parentCtx, "inner", StoreLogAll, func(workCtx types.Context, span opentracing.Span) error {
+					span.SetTag("inner", "sure")
+					return nil
+				})
+				return nil
+			})
+			// when
+			require.NoError(t, closer.Close())
+
+			// then
+			spans := collector.Spans()
+			require.Len(t, spans, 2)
+			assert.Equal(t, "inner", spans[0].Name)
+			assert.Equal(t, "my-op", spans[1].Name)
+			assert.Equal(t, spans[1].SpanId, spans[0].ParentSpanId)
+			assert.Equal(t, spans[1].TraceId, spans[0].TraceId)
+			assert.Equal(t, uint64(1587556800000000000), spans[1].StartTimeUnixNano)
+		})
+	}
+}
+
+func TestStartOTelTracerUnknownExporter(t *testing.T) {
+	cfg := DefaultTracerConfig()
+	cfg.Exporter = "unknown"
+	_, err := StartOTelTracer(cfg, log.NewNopLogger())
+	require.Error(t, err)
+}
+
+// otlpCollectorStub local stand-in for an OTel collector that captures all received spans
+type otlpCollectorStub struct {
+	collectortrace.UnimplementedTraceServiceServer
+	mx    sync.Mutex
+	spans []*tracev1.Span
+}
+
+func (c *otlpCollectorStub) Export(_ context.Context, req *collectortrace.ExportTraceServiceRequest) (*collectortrace.ExportTraceServiceResponse, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+	return &collectortrace.ExportTraceServiceResponse{}, nil
+}
+
+func (c *otlpCollectorStub) Spans() []*tracev1.Span {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.spans
+}
+
+func startGRPCCollector(t *testing.T, c *otlpCollectorStub) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	collectortrace.RegisterTraceServiceServer(srv, c)
+	go srv.Serve(l) //nolint:errcheck
+	t.Cleanup(srv.Stop)
+	return l.Addr().String()
+}
+
+func startHTTPCollector(t *testing.T, c *otlpCollectorStub) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bz, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var req collectortrace.ExportTraceServiceRequest
+		require.NoError(t, proto.Unmarshal(bz, &req))
+		_, _ = c.Export(r.Context(), &req)
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
@@ -0,0 +1,399 @@
+package tracing
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// Sampling action types
+const (
+	SamplingActionSample        = "sample"
+	SamplingActionDrop          = "drop"
+	SamplingActionProbabilistic = "probabilistic"
+	SamplingActionRateLimiting  = "ratelimiting"
+)
+
+// sampling rule condition keys
+const (
+	ruleKeyOperation  = "operation"
+	ruleKeyHeight     = "height"
+	ruleKeyMsgType    = "msg_type"
+	ruleKeyContract   = "contract"
+	ruleKeySender     = "sender"
+	ruleKeyModule     = "module"
+	ruleKeyIBCChannel = "ibc_channel"
+	ruleKeyGRPCMethod = "grpc_method"
+	ruleKeySimulation = "simulation"
+	ruleKeyAction     = "action"
+)
+
+// activeSampler is consulted before a new trace is started. Nil samples everything
+var activeSampler atomic.Pointer[Sampler]
+
+// SetSampler sets the sampler for new traces. Nil samples everything. Safe for concurrent use
+func SetSampler(s *Sampler) {
+	activeSampler.Store(s)
+}
+
+// shouldSampleBlock returns the decision of the active sampler for the block root span without rate limiting, so that
+// the block does not take the tokens of the tx and contract rules. True when none is set
+func shouldSampleBlock(p SamplingParams) bool {
+	s := activeSampler.Load()
+	return s == nil || s.ShouldSampleWithoutLimit(p)
+}
+
+// SamplingParams are the chain attributes known when a span is started
+type SamplingParams struct {
+	Operation   string
+	Height      int64
+	Simulation  bool
+	MsgTypes    []string
+	Contracts   []string
+	Senders     []string
+	Modules     []string
+	IBCChannels []string
+	GRPCMethod  string
+}
+
+// SamplingAction is applied to the matching traces
+type SamplingAction struct {
+	Type string
+	// Param is the sample rate for probabilistic or the max traces per second for ratelimiting
+	Param float64
+}
+
+// ParseSamplingAction parses the action string: `sample`, `drop`, `probabilistic:<rate>` or `ratelimiting:<traces per second>`
+func ParseSamplingAction(s string) (SamplingAction, error) {
+	typ, param, hasParam := strings.Cut(strings.TrimSpace(s), ":")
+	a := SamplingAction{Type: typ}
+	switch typ {
+	case SamplingActionSample, SamplingActionDrop:
+		if hasParam {
+			return a, fmt.Errorf("unexpected param for sampling action %q", typ)
+		}
+		return a, nil
+	case SamplingActionProbabilistic, SamplingActionRateLimiting:
+		v, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return a, fmt.Errorf("sampling action %q: %w", typ, err)
+		}
+		if v < 0 || typ == SamplingActionProbabilistic && v > 1 {
+			return a, fmt.Errorf("sampling action %q: param out of range: %v", typ, v)
+		}
+		a.Param = v
+		return a, nil
+	default:
+		return a, fmt.Errorf("unsupported sampling action: %q", s)
+	}
+}
+
+// String returns the action in the parsable format
+func (a SamplingAction) String() string {
+	switch a.Type {
+	case SamplingActionProbabilistic, SamplingActionRateLimiting:
+		return a.Type + ":" + strconv.FormatFloat(a.Param, 'f', -1, 64)
+	default:
+		return a.Type
+	}
+}
+
+// SamplingRule matches when all conditions set are satisfied. Lists match when any value is contained.
+type SamplingRule struct {
+	Operations  []string
+	MinHeight   int64 // 0 for no lower bound
+	MaxHeight   int64 // 0 for no upper bound
+	MsgTypes    []string
+	Contracts   []string
+	Senders     []string
+	Modules     []string
+	IBCChannels []string
+	GRPCMethods []string
+	Simulation  *bool
+	Action      SamplingAction
+}
+
+// ParseSamplingRule parses a rule string of space separated `key=value` conditions with `|` separated alternatives.
+// Supported keys are operation, height (`from-to`, open ends allowed), msg_type, contract, sender, module, ibc_channel,
+// grpc_method, simulation and the mandatory action.
+// For example: `msg_type=/cosmwasm.wasm.v1.MsgExecuteContract contract=wasm1abc|wasm1def action=sample`
+func ParseSamplingRule(s string) (SamplingRule, error) {
+	var r SamplingRule
+	var hasAction bool
+	for _, field := range strings.Fields(s) {
+		k, v, ok := strings.Cut(field, "=")
+		if !ok || v == "" {
+			return r, fmt.Errorf("invalid condition %q: expected key=value", field)
+		}
+		var err error
+		switch k {
+		case ruleKeyOperation:
+			r.Operations = strings.Split(v, "|")
+		case ruleKeyHeight:
+			r.MinHeight, r.MaxHeight, err = parseHeightRange(v)
+		case ruleKeyMsgType:
+			r.MsgTypes = strings.Split(v, "|")
+		case ruleKeyContract:
+			r.Contracts = strings.Split(v, "|")
+		case ruleKeySender:
+			r.Senders = strings.Split(v, "|")
+		case ruleKeyModule:
+			r.Modules = strings.Split(v, "|")
+		case ruleKeyIBCChannel:
+			r.IBCChannels = strings.Split(v, "|")
+		case ruleKeyGRPCMethod:
+			r.GRPCMethods = strings.Split(v, "|")
+		case ruleKeySimulation:
+			var sim bool
+			sim, err = strconv.ParseBool(v)
+			r.Simulation = &sim
+		case ruleKeyAction:
+			r.Action, err = ParseSamplingAction(v)
+			hasAction = true
+		default:
+			return r, fmt.Errorf("unsupported condition key: %q", k)
+		}
+		if err != nil {
+			return r, fmt.Errorf("condition %q: %w", k, err)
+		}
+	}
+	if !hasAction {
+		return r, errors.New("action must be set")
+	}
+	return r, nil
+}
+
+func parseHeightRange(s string) (int64, int64, error) {
+	from, to, isRange := strings.Cut(s, "-")
+	if !isRange {
+		to = from
+	}
+	var minHeight, maxHeight int64
+	var err error
+	if from != "" {
+		if minHeight, err = strconv.ParseInt(from, 10, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	if to != "" {
+		if maxHeight, err = strconv.ParseInt(to, 10, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	if minHeight < 0 || maxHeight < 0 || maxHeight != 0 && minHeight > maxHeight {
+		return 0, 0, fmt.Errorf("invalid height range: %q", s)
+	}
+	return minHeight, maxHeight, nil
+}
+
+// Matches returns true when all conditions are satisfied by the params.
+// Conditions on attributes that are not known in the params do not match.
+func (r SamplingRule) Matches(p SamplingParams) bool {
+	if len(r.Operations) != 0 && !containsAny(r.Operations, p.Operation) {
+		return false
+	}
+	if r.MinHeight != 0 && p.Height < r.MinHeight || r.MaxHeight != 0 && p.Height > r.MaxHeight {
+		return false
+	}
+	if r.Simulation != nil && *r.Simulation != p.Simulation {
+		return false
+	}
+	if len(r.GRPCMethods) != 0 && !containsAny(r.GRPCMethods, p.GRPCMethod) {
+		return false
+	}
+	return (len(r.MsgTypes) == 0 || containsAny(r.MsgTypes, p.MsgTypes...)) &&
+		(len(r.Contracts) == 0 || containsAny(r.Contracts, p.Contracts...)) &&
+		(len(r.Senders) == 0 || containsAny(r.Senders, p.Senders...)) &&
+		(len(r.Modules) == 0 || containsAny(r.Modules, p.Modules...)) &&
+		(len(r.IBCChannels) == 0 || containsAny(r.IBCChannels, p.IBCChannels...))
+}
+
+func containsAny(set []string, values ...string) bool {
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		for _, s := range set {
+			if s == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Sampler decides on new traces with the action of the first matching rule or the default action
+type Sampler struct {
+	defaultAction actionSampler
+	rules         []SamplingRule
+	actions       []actionSampler
+}
+
+// NewSampler constructor
+func NewSampler(defaultAction SamplingAction, rules ...SamplingRule) *Sampler {
+	actions := make([]actionSampler, len(rules))
+	for i, r := range rules {
+		actions[i] = newActionSampler(r.Action)
+	}
+	return &Sampler{defaultAction: newActionSampler(defaultAction), rules: rules, actions: actions}
+}
+
+// ShouldSample returns true when the trace should be recorded
+func (s *Sampler) ShouldSample(p SamplingParams) bool {
+	for i, r := range s.rules {
+		if r.Matches(p) {
+			return s.actions[i].sample()
+		}
+	}
+	return s.defaultAction.sample()
+}
+
+// ShouldSampleWithoutLimit returns the decision like ShouldSample but false for a rate limited action, so that no
+// tokens are taken from the rate limiter
+func (s *Sampler) ShouldSampleWithoutLimit(p SamplingParams) bool {
+	action := s.defaultAction
+	for i, r := range s.rules {
+		if r.Matches(p) {
+			action = s.actions[i]
+			break
+		}
+	}
+	if _, ok := action.(*rateLimiter); ok {
+		return false
+	}
+	return action.sample()
+}
+
+type actionSampler interface {
+	sample() bool
+}
+
+func newActionSampler(a SamplingAction) actionSampler {
+	switch a.Type {
+	case SamplingActionDrop:
+		return constSampler(false)
+	case SamplingActionProbabilistic:
+		return probabilisticSampler(a.Param)
+	case SamplingActionRateLimiting:
+		return newRateLimiter(a.Param, time.Now)
+	default:
+		return constSampler(true)
+	}
+}
+
+type constSampler bool
+
+func (c constSampler) sample() bool {
+	return bool(c)
+}
+
+type probabilisticSampler float64
+
+func (p probabilisticSampler) sample() bool {
+	return rand.Float64() < float64(p) //nolint:gosec // not security relevant
+}
+
+// rateLimiter token bucket that allows up to creditsPerSecond samples
+type rateLimiter struct {
+	mx               sync.Mutex
+	creditsPerSecond float64
+	maxBalance       float64
+	balance          float64
+	lastTick         time.Time
+	now              func() time.Time
+}
+
+func newRateLimiter(creditsPerSecond float64, now func() time.Time) *rateLimiter {
+	maxBalance := creditsPerSecond
+	if maxBalance < 1 {
+		maxBalance = 1
+	}
+	return &rateLimiter{
+		creditsPerSecond: creditsPerSecond,
+		maxBalance:       maxBalance,
+		balance:          maxBalance,
+		lastTick:         now(),
+		now:              now,
+	}
+}
+
+func (r *rateLimiter) sample() bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	now := r.now()
+	r.balance += now.Sub(r.lastTick).Seconds() * r.creditsPerSecond
+	r.lastTick = now
+	if r.balance > r.maxBalance {
+		r.balance = r.maxBalance
+	}
+	if r.balance < 1 {
+		return false
+	}
+	r.balance--
+	return true
+}
+
+// sampleCtx returns true when the subtree should be traced. The decision is made once at the trace root and
+// stored in the returned context so that it applies to all child spans.
+func sampleCtx(ctx sdk.Context, p SamplingParams) (sdk.Context, bool) {
+	if sampled, ok := ctx.Value(samplingKey).(bool); ok {
+		return ctx, sampled
+	}
+	sampler := activeSampler.Load()
+	if sampler == nil {
+		return ctx, true
+	}
+	p.Height = ctx.BlockHeight()
+	p.Simulation = IsSimulation(ctx)
+	sampled := sampler.ShouldSample(p)
+	return ctx.WithValue(samplingKey, sampled), sampled
+}
+
+// msgSamplingParams returns the sampling attributes of the sdk messages
+func msgSamplingParams(operation string, msgs ...sdk.Msg) SamplingParams {
+	p := SamplingParams{Operation: operation}
+	for _, msg := range msgs {
+		p.MsgTypes = append(p.MsgTypes, sdk.MsgTypeURL(msg), fmt.Sprintf("%T", msg))
+		p.Senders = append(p.Senders, addrsToString(msg.GetSigners())...)
+		if m, ok := msg.(routeable); ok {
+			p.Modules = append(p.Modules, m.Route())
+		}
+		switch m := msg.(type) {
+		case *wasmtypes.MsgExecuteContract:
+			p.Contracts = append(p.Contracts, m.Contract)
+		case *wasmtypes.MsgMigrateContract:
+			p.Contracts = append(p.Contracts, m.Contract)
+		case *wasmtypes.MsgUpdateAdmin:
+			p.Contracts = append(p.Contracts, m.Contract)
+		case *wasmtypes.MsgClearAdmin:
+			p.Contracts = append(p.Contracts, m.Contract)
+		}
+	}
+	return p
+}
+
+// newSamplerFromConfig returns nil when everything is sampled
+func newSamplerFromConfig(cfg TracerConfig) (*Sampler, error) {
+	defaultAction, err := ParseSamplingAction(cfg.SamplingDefault)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.SamplingRules) == 0 && defaultAction.Type == SamplingActionSample {
+		return nil, nil
+	}
+	rules := make([]SamplingRule, len(cfg.SamplingRules))
+	for i, s := range cfg.SamplingRules {
+		if rules[i], err = ParseSamplingRule(s); err != nil {
+			return nil, fmt.Errorf("sampling rule %d: %w", i, err)
+		}
+	}
+	return NewSampler(defaultAction, rules...), nil
+}
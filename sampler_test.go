@@ -0,0 +1,243 @@
+package tracing
+
+import (
+	"testing"
+	"time"
+
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	"github.com/cometbft/cometbft/libs/rand"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/address"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSamplingRule(t *testing.T) {
+	myTrue := true
+	specs := map[string]struct {
+		src    string
+		exp    SamplingRule
+		expErr bool
+	}{
+		"all conditions": {
+			src: "operation=ante_handler height=100-200 msg_type=/cosmwasm.wasm.v1.MsgExecuteContract contract=wasm1abc|wasm1def sender=wasm1xyz module=wasm ibc_channel=channel-0 grpc_method=/cosmos.bank.v1beta1.Msg/Send simulation=true action=probabilistic:0.5",
+			exp: SamplingRule{
+				Operations:  []string{"ante_handler"},
+				MinHeight:   100,
+				MaxHeight:   200,
+				MsgTypes:    []string{"/cosmwasm.wasm.v1.MsgExecuteContract"},
+				Contracts:   []string{"wasm1abc", "wasm1def"},
+				Senders:     []string{"wasm1xyz"},
+				Modules:     []string{"wasm"},
+				IBCChannels: []string{"channel-0"},
+				GRPCMethods: []string{"/cosmos.bank.v1beta1.Msg/Send"},
+				Simulation:  &myTrue,
+				Action:      SamplingAction{Type: SamplingActionProbabilistic, Param: 0.5},
+			},
+		},
+		"open height range": {
+			src: "height=100- action=drop",
+			exp: SamplingRule{MinHeight: 100, Action: SamplingAction{Type: SamplingActionDrop}},
+		},
+		"single height": {
+			src: "height=7 action=ratelimiting:2",
+			exp: SamplingRule{MinHeight: 7, MaxHeight: 7, Action: SamplingAction{Type: SamplingActionRateLimiting, Param: 2}},
+		},
+		"action only": {
+			src: "action=sample",
+			exp: SamplingRule{Action: SamplingAction{Type: SamplingActionSample}},
+		},
+		"no action": {
+			src:    "contract=wasm1abc",
+			expErr: true,
+		},
+		"unknown key": {
+			src:    "foo=bar action=sample",
+			expErr: true,
+		},
+		"invalid height range": {
+			src:    "height=200-100 action=sample",
+			expErr: true,
+		},
+		"probability out of range": {
+			src:    "action=probabilistic:1.5",
+			expErr: true,
+		},
+		"unknown action": {
+			src:    "action=foo",
+			expErr: true,
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			got, gotErr := ParseSamplingRule(spec.src)
+			if spec.expErr {
+				require.Error(t, gotErr)
+				return
+			}
+			require.NoError(t, gotErr)
+			assert.Equal(t, spec.exp, got)
+		})
+	}
+}
+
+func TestSamplerShouldSample(t *testing.T) {
+	mustParse := func(s string) SamplingRule {
+		r, err := ParseSamplingRule(s)
+		require.NoError(t, err)
+		return r
+	}
+	drop := SamplingAction{Type: SamplingActionDrop}
+	specs := map[string]struct {
+		rules  []SamplingRule
+		params SamplingParams
+		exp    bool
+	}{
+		"default action": {
+			params: SamplingParams{Operation: "ante_handler"},
+			exp:    false,
+		},
+		"contract matches": {
+			rules:  []SamplingRule{mustParse("contract=wasm1abc|wasm1def action=sample")},
+			params: SamplingParams{Contracts: []string{"wasm1other", "wasm1def"}},
+			exp:    true,
+		},
+		"contract unknown": {
+			rules:  []SamplingRule{mustParse("contract=wasm1abc action=sample")},
+			params: SamplingParams{Senders: []string{"wasm1abc"}},
+			exp:    false,
+		},
+		"height in range": {
+			rules:  []SamplingRule{mustParse("height=10-20 action=sample")},
+			params: SamplingParams{Height: 20},
+			exp:    true,
+		},
+		"height out of range": {
+			rules:  []SamplingRule{mustParse("height=10-20 action=sample")},
+			params: SamplingParams{Height: 21},
+			exp:    false,
+		},
+		"all conditions must match": {
+			rules:  []SamplingRule{mustParse("sender=wasm1xyz msg_type=/cosmos.bank.v1beta1.MsgSend action=sample")},
+			params: SamplingParams{Senders: []string{"wasm1xyz"}, MsgTypes: []string{"/cosmos.bank.v1beta1.MsgMultiSend"}},
+			exp:    false,
+		},
+		"simulation": {
+			rules:  []SamplingRule{mustParse("simulation=true action=sample")},
+			params: SamplingParams{Simulation: true},
+			exp:    true,
+		},
+		"ibc channel": {
+			rules:  []SamplingRule{mustParse("ibc_channel=channel-1 action=sample")},
+			params: SamplingParams{IBCChannels: []string{"channel-0", "channel-1"}},
+			exp:    true,
+		},
+		"grpc method": {
+			rules:  []SamplingRule{mustParse("grpc_method=/cosmos.bank.v1beta1.Msg/Send action=sample")},
+			params: SamplingParams{GRPCMethod: "/cosmos.bank.v1beta1.Msg/Send"},
+			exp:    true,
+		},
+		"first match wins": {
+			rules: []SamplingRule{
+				mustParse("module=bank action=drop"),
+				mustParse("sender=wasm1xyz action=sample"),
+			},
+			params: SamplingParams{Modules: []string{"bank"}, Senders: []string{"wasm1xyz"}},
+			exp:    false,
+		},
+		"probabilistic never": {
+			rules:  []SamplingRule{mustParse("action=probabilistic:0")},
+			params: SamplingParams{},
+			exp:    false,
+		},
+		"probabilistic always": {
+			rules:  []SamplingRule{mustParse("action=probabilistic:1")},
+			params: SamplingParams{},
+			exp:    true,
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			got := NewSampler(drop, spec.rules...).ShouldSample(spec.params)
+			assert.Equal(t, spec.exp, got)
+		})
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	r := newRateLimiter(2, func() time.Time { return now })
+	assert.True(t, r.sample())
+	assert.True(t, r.sample())
+	assert.False(t, r.sample())
+	// and after some time
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, r.sample())
+	assert.False(t, r.sample())
+	// balance is capped
+	now = now.Add(time.Hour)
+	assert.True(t, r.sample())
+	assert.True(t, r.sample())
+	assert.False(t, r.sample())
+}
+
+func TestDoWithTracingSampling(t *testing.T) {
+	t.Cleanup(func() { SetSampler(nil) })
+	specs := map[string]struct {
+		sampler  *Sampler
+		expSpans []string
+	}{
+		"no sampler": {
+			expSpans: []string{"inner", "root"},
+		},
+		"root dropped": {
+			sampler: NewSampler(SamplingAction{Type: SamplingActionSample},
+				SamplingRule{Operations: []string{"root"}, Action: SamplingAction{Type: SamplingActionDrop}}),
+		},
+		"root sampled": {
+			sampler: NewSampler(SamplingAction{Type: SamplingActionDrop},
+				SamplingRule{Operations: []string{"root"}, Action: SamplingAction{Type: SamplingActionSample}}),
+			expSpans: []string{"inner", "root"},
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			tracer := mocktracer.New()
+			opentracing.SetGlobalTracer(tracer)
+			SetSampler(spec.sampler)
+			ctx, _, _ := createMinTestInput(t)
+			var innerCalled bool
+			DoWithTracing(ctx, "root", StoreLogAll, func(parentCtx sdk.Context, span opentracing.Span) error {
+				DoWithTracing(parentCtx, "inner", StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
+					innerCalled = true
+					return nil
+				})
+				return nil
+			})
+			assert.True(t, innerCalled)
+			var gotSpans []string
+			for _, s := range tracer.FinishedSpans() {
+				gotSpans = append(gotSpans, s.OperationName)
+			}
+			assert.Equal(t, spec.expSpans, gotSpans)
+		})
+	}
+}
+
+func TestMsgSamplingParams(t *testing.T) {
+	sender := sdk.AccAddress(rand.Bytes(address.Len))
+	contract := sdk.AccAddress(rand.Bytes(address.Len))
+	msg := &wasmtypes.MsgExecuteContract{Sender: sender.String(), Contract: contract.String()}
+
+	got := msgSamplingParams("ante_handler", msg)
+	exp := SamplingParams{
+		Operation: "ante_handler",
+		MsgTypes:  []string{"/cosmwasm.wasm.v1.MsgExecuteContract", "*types.MsgExecuteContract"},
+		Senders:   []string{sender.String()},
+		Modules:   []string{"wasm"},
+		Contracts: []string{contract.String()},
+	}
+	assert.Equal(t, exp, got)
+}
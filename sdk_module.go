@@ -92,7 +92,7 @@ func (t TraceModuleManager) ExportGenesis(ctx sdk.Context, cdc codec.JSONCodec)
 }
 
 func (t TraceModuleManager) RunMigrations(rootCtx sdk.Context, cfg module.Configurator, fromVM module.VersionMap) (migrations module.VersionMap, err error) {
-	DoWithTracing(rootCtx, ABCIBeginBlockOperationName, writesOnly, func(ctx sdk.Context, span opentracing.Span) error {
+	DoWithTracing(rootCtx, ABCIBeginBlockOperationName, StoreLogWritesOnly, func(ctx sdk.Context, span opentracing.Span) error {
 		migrations, err = t.other.RunMigrations(ctx, cfg, fromVM)
 		return err
 	})
@@ -104,16 +104,17 @@ func (t TraceModuleManager) BeginBlock(rootCtx sdk.Context, req abci.RequestBegi
 		return t.other.BeginBlock(rootCtx, req)
 	}
 
-	rootCtx = rootCtx.WithEventManager(sdk.NewEventManager())
+	rootCtx = withBlockSpan(rootCtx).WithEventManager(sdk.NewEventManager())
 
-	DoWithTracing(rootCtx, ABCIBeginBlockOperationName, nothing, func(parentCtx sdk.Context, span opentracing.Span) error {
+	DoWithTracing(rootCtx, ABCIBeginBlockOperationName, StoreLogNothing, func(parentCtx sdk.Context, span opentracing.Span) error {
 		// run by order defined as in the sdk
 		for _, moduleName := range t.other.OrderBeginBlockers {
 			module, ok := t.other.Modules[moduleName].(module.BeginBlockAppModule)
 			if !ok {
 				continue
 			}
-			DoWithTracing(parentCtx, ModuleBeginBlockOperationName, writesOnly, func(workCtx sdk.Context, span opentracing.Span) error {
+			p := SamplingParams{Operation: ModuleBeginBlockOperationName, Modules: []string{moduleName}}
+			DoWithTracingParams(parentCtx, p, StoreLogWritesOnly, func(workCtx sdk.Context, span opentracing.Span) error {
 				span.SetTag(tagModule, moduleName)
 				module.BeginBlock(workCtx, req)
 				return nil
@@ -132,15 +133,16 @@ func (t TraceModuleManager) EndBlock(rootCtx sdk.Context, req abci.RequestEndBlo
 		return t.other.EndBlock(rootCtx, req)
 	}
 
-	rootCtx = rootCtx.WithEventManager(sdk.NewEventManager())
+	rootCtx = withBlockSpan(rootCtx).WithEventManager(sdk.NewEventManager())
 	validatorUpdates := []abci.ValidatorUpdate{} // nolint
-	DoWithTracing(rootCtx, ABCIEndBlockOperationName, nothing, func(parentCtx sdk.Context, span opentracing.Span) error {
+	DoWithTracing(rootCtx, ABCIEndBlockOperationName, StoreLogNothing, func(parentCtx sdk.Context, span opentracing.Span) error {
 		for _, moduleName := range t.other.OrderEndBlockers {
 			module, ok := t.other.Modules[moduleName].(module.EndBlockAppModule)
 			if !ok {
 				continue
 			}
-			DoWithTracing(parentCtx, ModuleEndBlockOperationName, writesOnly, func(workCtx sdk.Context, span opentracing.Span) error {
+			p := SamplingParams{Operation: ModuleEndBlockOperationName, Modules: []string{moduleName}}
+			DoWithTracingParams(parentCtx, p, StoreLogWritesOnly, func(workCtx sdk.Context, span opentracing.Span) error {
 				span.SetTag(tagModule, moduleName)
 
 				moduleValUpdates := module.EndBlock(workCtx, req)
@@ -264,7 +266,12 @@ func (t *TraceGRPCServer) decorateHandler(methodHandler methodHandlerFunc, fqMet
 
 func (t *TraceGRPCServer) traceHandler(fqMethod string, nestedHandler stdgrpc.UnaryHandler) func(goCtx3 context.Context, req2 interface{}) (result interface{}, err error) {
 	return func(goCtx3 context.Context, req2 interface{}) (result interface{}, err error) {
-		DoWithTracing(sdk.UnwrapSDKContext(goCtx3), "service", writesOnly,
+		p := SamplingParams{Operation: "service", GRPCMethod: fqMethod}
+		ctx, sampled := sampleCtxWithOrigin(sdk.UnwrapSDKContext(goCtx3), p)
+		if !sampled {
+			return nestedHandler(sdk.WrapSDKContext(ctx), req2)
+		}
+		DoWithTracingParams(ctx, p, StoreLogWritesOnly,
 			func(workCtx sdk.Context, span opentracing.Span) error {
 				span.SetTag(tagSDKGRPCService, fqMethod)
 				result, err = nestedHandler(sdk.WrapSDKContext(workCtx), req2)
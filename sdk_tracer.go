@@ -26,11 +26,24 @@ const (
 	tagSimulation     = "simulation"
 	tagQueryPath      = "query_path"
 	tagValsetUpdate   = "valset_update"
+	tagPanic          = "panic"
+	tagOutOfGas       = "out_of_gas"
+	tagGasConsumed    = "gas_consumed"
+	tagGasLimit       = "gas_limit"
 
-	logRawStoreIO   = "raw_store_io"
-	logValsetDiff   = "valset_diff"
-	logRawLoggerOut = "logger_out"
-	logGasUsage     = "gas_usage"
+	logRawStoreIO        = "raw_store_io"
+	logRawStoreIOOmitted = "raw_store_io_omitted"
+	logStoreIOSummary    = "store_io_summary"
+	logStoreBranches     = "store_branches"
+	logStoreOps          = "store_ops"
+	logStoreOpsDropped   = "store_ops_dropped"
+	logStoreDiff         = "store_diff"
+	logStoreDiffDropped  = "store_diff_dropped"
+	logValsetDiff        = "valset_diff"
+	logRawLoggerOut      = "logger_out"
+	logGasUsage          = "gas_usage"
+	logPanicValue        = "panic_value"
+	logPanicStack        = "panic_stack"
 )
 
 // BeginBlockTracer is a decorator to the begin block callback that adds tracing functionality
@@ -40,7 +53,7 @@ func BeginBlockTracer(other sdk.BeginBlocker) sdk.BeginBlocker {
 		return other
 	}
 	return func(rootCtx sdk.Context, req abci.RequestBeginBlock) (rsp abci.ResponseBeginBlock) {
-		DoWithTracing(rootCtx, "old-abci_begin_block", all, func(workCtx sdk.Context, span opentracing.Span) error {
+		DoWithTracing(rootCtx, "old-abci_begin_block", StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
 			rsp = other(workCtx, req)
 			return nil
 		})
@@ -55,7 +68,7 @@ func EndBlockTracer(other sdk.EndBlocker) sdk.EndBlocker {
 		return other
 	}
 	return func(rootCtx sdk.Context, req abci.RequestEndBlock) (rsp abci.ResponseEndBlock) {
-		DoWithTracing(rootCtx, "old-abci_end_block", all, func(workCtx sdk.Context, span opentracing.Span) error {
+		DoWithTracing(rootCtx, "old-abci_end_block", StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
 			rsp = other(workCtx, req)
 			return nil
 		})
@@ -72,8 +85,15 @@ func NewTraceAnteHandler(other sdk.AnteHandler, cdc codec.Codec) sdk.AnteHandler
 		if !isTraceable(rootCtx, simulate) {
 			return other(rootCtx, tx, simulate)
 		}
-		ctx := WithSimulation(rootCtx, simulate)
-		DoWithTracing(ctx, "ante_handler", writesOnly, func(workCtx sdk.Context, span opentracing.Span) error {
+		txHash := cmttypes.HexBytes(tmhash.Sum(rootCtx.TxBytes())).String()
+		// the keys touched are recorded for the comparison of simulation and delivery independent of the sampling
+		ctx := withTouchedKeys(txExecutions.attach(rootCtx, txHash, tx, simulate))
+		ctx, sampled := sampleCtxWithOrigin(WithSimulation(ctx, simulate), msgSamplingParams("ante_handler", tx.GetMsgs()...))
+		if !sampled {
+			return other(ctx, tx, simulate)
+		}
+		ctx, hasTxRoot := txRoots.start(ctx, txHash, simulate)
+		DoWithTracing(ctx, "ante_handler", StoreLogWritesOnly, func(workCtx sdk.Context, span opentracing.Span) error {
 			msgs := make([]string, len(tx.GetMsgs()))
 			senders := make([]string, 0, len(tx.GetMsgs()))
 			for i, msg := range tx.GetMsgs() {
@@ -89,7 +109,7 @@ func NewTraceAnteHandler(other sdk.AnteHandler, cdc codec.Codec) sdk.AnteHandler
 				span.LogFields(safeLogField(logRawSDKMsg, cutLength(string(jsonMsg), MaxSDKMsgTraced)))
 				senders = append(senders, addrsToString(msg.GetSigners())...)
 			}
-			span.SetTag(tagTXHash, cmttypes.HexBytes(tmhash.Sum(rootCtx.TxBytes())).String())
+			span.SetTag(tagTXHash, txHash)
 			span.SetTag(tagSDKMsgType, deduplicateStrings(msgs))
 			span.SetTag(tagSender, deduplicateStrings(senders))
 			span.SetTag(tagSimulation, strconv.FormatBool(simulate))
@@ -97,6 +117,10 @@ func NewTraceAnteHandler(other sdk.AnteHandler, cdc codec.Codec) sdk.AnteHandler
 			nextCtx, err = other(workCtx, tx, simulate)
 			return err
 		})
+		if hasTxRoot && !nextCtx.IsZero() {
+			// message and post handler spans are siblings of the ante span
+			nextCtx = nextCtx.WithContext(ctx.Context())
+		}
 		return
 	}
 }
@@ -157,7 +181,16 @@ func (t TraceGovRouter) GetRoute(path string) (h govv1beta1.Handler) {
 		if !IsTraceable(rootCtx) {
 			return realHandler(rootCtx, content)
 		}
-		DoWithTracing(rootCtx, "gov_router", all, func(workCtx sdk.Context, span opentracing.Span) error {
+		p := SamplingParams{
+			Operation: "gov_router",
+			MsgTypes:  []string{fmt.Sprintf("%T", content)},
+			Modules:   []string{content.ProposalRoute()},
+		}
+		ctx, sampled := sampleCtxWithOrigin(rootCtx, p)
+		if !sampled {
+			return realHandler(ctx, content)
+		}
+		DoWithTracingParams(ctx, p, StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
 			span.SetTag(tagModule, content.ProposalRoute()).
 				SetTag(tagSDKMsgType, fmt.Sprintf("%T", content))
 			err = realHandler(workCtx, content)
@@ -195,7 +228,12 @@ func (t TraceMessageRouter) Handler(msg sdk.Msg) baseapp.MsgServiceHandler {
 		if !IsTraceable(rootCtx) {
 			return realHandler(rootCtx, msg)
 		}
-		DoWithTracing(rootCtx, "new_msg_router", all, func(workCtx sdk.Context, span opentracing.Span) error {
+		p := msgSamplingParams("new_msg_router", msg)
+		ctx, sampled := sampleCtxWithOrigin(withTouchedKeys(rootCtx), p)
+		if !sampled {
+			return realHandler(ctx, msg)
+		}
+		DoWithTracingParams(ctx, p, StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
 			moduleName := "-"
 			if m, ok := msg.(routeable); ok {
 				moduleName = m.Route()
@@ -2,6 +2,8 @@ package tracing
 
 import (
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"testing"
 
@@ -19,12 +21,16 @@ import (
 
 func TestDispatchWithTracingStore(t *testing.T) {
 	tracerEnabled = true
+	storeOpsLog = true
 	var (
 		myKey                   = []byte(`foo`)
 		myVal                   = []byte(`bar`)
 		randAddr sdk.AccAddress = rand.Bytes(address.Len)
 	)
-	t.Cleanup(func() { tracerEnabled = false })
+	t.Cleanup(func() {
+		tracerEnabled = false
+		storeOpsLog = false
+	})
 
 	ctx, enc, storeKey := createMinTestInput(t)
 	xctx, commit := ctx.CacheContext()
@@ -48,8 +54,8 @@ func TestDispatchWithTracingStore(t *testing.T) {
 	// then
 	spans := tracer.FinishedSpans()
 	require.Len(t, spans, 1)
-	require.Len(t, spans[0].Logs(), 5)
-	idx := make(map[string]string, 5)
+	require.Len(t, spans[0].Logs(), 6)
+	idx := make(map[string]string, 6)
 	for _, v := range spans[0].Logs() {
 		require.Len(t, v.Fields, 1)
 		idx[v.Fields[0].Key] = v.Fields[0].ValueString
@@ -62,4 +68,14 @@ func TestDispatchWithTracingStore(t *testing.T) {
 	encoding := base64.StdEncoding
 	exp := fmt.Sprintf(`{"operation":"write","key":"%s","value":"%s","metadata":null}`, encoding.EncodeToString(myKey), encoding.EncodeToString(myVal))
 	assert.Equal(t, exp, line)
+
+	var gotOps []StoreOperation
+	require.NoError(t, json.Unmarshal([]byte(idx[logStoreOps]), &gotOps))
+	require.Len(t, gotOps, 1)
+	assert.Equal(t, "wasm", gotOps[0].Store)
+	assert.Equal(t, StoreOpWrite, gotOps[0].Op)
+	assert.Equal(t, hex.EncodeToString(myKey), gotOps[0].Key)
+	assert.Equal(t, len(myVal), gotOps[0].ValueLen)
+	assert.Equal(t, hex.EncodeToString(myVal), gotOps[0].Value)
+	assert.NotZero(t, gotOps[0].Gas)
 }
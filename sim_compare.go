@@ -0,0 +1,381 @@
+package tracing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	abci "github.com/cometbft/cometbft/abci/types"
+	"github.com/cometbft/cometbft/crypto/tmhash"
+	cmttypes "github.com/cometbft/cometbft/libs/bytes"
+	storetypes "github.com/cosmos/cosmos-sdk/store/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	txtypes "github.com/cosmos/cosmos-sdk/types/tx"
+	"github.com/cosmos/gogoproto/proto"
+	"github.com/opentracing/opentracing-go"
+)
+
+const (
+	tagSimGasUsed  = "sim_gas_used"
+	tagSimDiverged = "sim_diverged"
+
+	logSimComparison = "sim_comparison"
+)
+
+// SimulateFn is the simulate method of the baseapp. An alias to be assignable to the tx service argument
+type SimulateFn = func(txBytes []byte) (sdk.GasInfo, *sdk.Result, error)
+
+// activeSimulations holds the simulation results to compare with the delivered txs. Nil when disabled
+var activeSimulations *simulationCache
+
+// txExecutions holds the executions of the txs that are simulated or delivered
+var txExecutions = &txExecutionRegistry{execs: make(map[string][]*txExecution)}
+
+// txExecution is the data of a simulated or delivered tx that is compared
+type txExecution struct {
+	mx       sync.Mutex
+	simulate bool
+	// attached is set when the execution is claimed by the ante handler of a run
+	attached bool
+	// key identifies the tx in simulation and delivery. Empty when not known
+	key     string
+	touched map[string]struct{}
+	gasUsed uint64
+	events  []string
+	err     string
+}
+
+func (e *txExecution) touch(storeName string, key []byte) {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	e.touched[storeName+"/"+hex.EncodeToString(key)] = struct{}{}
+}
+
+// touchedKeys returns a copy of the store keys touched
+func (e *txExecution) touchedKeys() map[string]struct{} {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	r := make(map[string]struct{}, len(e.touched))
+	for k := range e.touched {
+		r[k] = struct{}{}
+	}
+	return r
+}
+
+// txExecutionRegistry holds the pending executions per tx hash. Each call registers its own execution, so that
+// concurrent simulations of the same tx bytes do not replace each other.
+type txExecutionRegistry struct {
+	mx    sync.Mutex
+	execs map[string][]*txExecution
+}
+
+// register a new execution of the tx for a simulation or delivery. It must be removed by the caller.
+func (r *txExecutionRegistry) register(txHash string, simulate bool) *txExecution {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	e := &txExecution{simulate: simulate, touched: make(map[string]struct{})}
+	r.execs[txHash] = append(r.execs[txHash], e)
+	return e
+}
+
+// remove the execution registered for the tx. Other executions of the tx are kept.
+func (r *txExecutionRegistry) remove(txHash string, e *txExecution) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	execs := r.execs[txHash]
+	for i, v := range execs {
+		if v == e {
+			execs = append(execs[:i:i], execs[i+1:]...)
+			break
+		}
+	}
+	if len(execs) == 0 {
+		delete(r.execs, txHash)
+		return
+	}
+	r.execs[txHash] = execs
+}
+
+// attach claims the first registered execution of the tx and mode that is not attached yet, sets its compare key and
+// returns the context with the execution set, so that the keys touched are recorded. The context is returned
+// unchanged when no execution is pending.
+func (r *txExecutionRegistry) attach(ctx sdk.Context, txHash string, tx sdk.Tx, simulate bool) sdk.Context {
+	r.mx.Lock()
+	var e *txExecution
+	for _, v := range r.execs[txHash] {
+		if v.simulate == simulate && !v.attached {
+			e, v.attached = v, true
+			break
+		}
+	}
+	r.mx.Unlock()
+	if e == nil {
+		return ctx
+	}
+	e.mx.Lock()
+	e.key = txCompareKey(tx)
+	e.mx.Unlock()
+	return ctx.WithValue(txExecutionKey, e)
+}
+
+// withTouchedKeys returns the context with the multistore that records the keys touched for the execution attached.
+// The keys are recorded independent of the sampling and the store capture filter. The context is returned
+// unchanged when no execution is attached or the multistore records for it already.
+func withTouchedKeys(ctx sdk.Context) sdk.Context {
+	e, _ := ctx.Value(txExecutionKey).(*txExecution)
+	if e == nil {
+		return ctx
+	}
+	return withStoreWrapper(ctx, e)
+}
+
+// txCompareKey returns the hash of the tx body with the signer sequences. Simulated txs differ from the delivered
+// ones in the fee, gas limit and signatures only. Empty when the tx does not provide the proto tx.
+func txCompareKey(tx sdk.Tx) string {
+	p, ok := tx.(interface{ GetProtoTx() *txtypes.Tx })
+	if !ok || p.GetProtoTx() == nil || p.GetProtoTx().Body == nil {
+		return ""
+	}
+	protoTx := p.GetProtoTx()
+	bz, err := proto.Marshal(protoTx.Body)
+	if err != nil {
+		return ""
+	}
+	h := sha256.Sum256(bz)
+	key := hex.EncodeToString(h[:])
+	if protoTx.AuthInfo != nil {
+		for _, s := range protoTx.AuthInfo.SignerInfos {
+			key += "/" + strconv.FormatUint(s.Sequence, 10)
+		}
+	}
+	return key
+}
+
+// simulationCache keeps the latest simulation results by compare key up to the max number
+type simulationCache struct {
+	mx      sync.Mutex
+	max     int
+	order   []string
+	results map[string]*txExecution
+}
+
+func newSimulationCache(max int) *simulationCache {
+	return &simulationCache{max: max, results: make(map[string]*txExecution)}
+}
+
+// add the result. The oldest result is dropped when the cache is full
+func (c *simulationCache) add(e *txExecution) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if _, exists := c.results[e.key]; !exists {
+		c.order = append(c.order, e.key)
+	}
+	c.results[e.key] = e
+	for len(c.order) > c.max {
+		delete(c.results, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// take returns and removes the result or returns nil when not found
+func (c *simulationCache) take(key string) *txExecution {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	e, ok := c.results[key]
+	if !ok {
+		return nil
+	}
+	delete(c.results, key)
+	for i, k := range c.order {
+		if k == key {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	return e
+}
+
+// takeFor returns and removes the simulation result of the same tx as the delivered one. Nil when not found or
+// the cache is not enabled
+func (c *simulationCache) takeFor(delivered *txExecution) *txExecution {
+	if c == nil || delivered == nil {
+		return nil
+	}
+	delivered.mx.Lock()
+	key := delivered.key
+	delivered.mx.Unlock()
+	if key == "" {
+		return nil
+	}
+	return c.take(key)
+}
+
+// TraceSimulate decorates the simulate method of the baseapp, for example in the app's RegisterTxService, to keep the
+// simulation results for the comparison with the delivered tx
+func TraceSimulate(other SimulateFn) SimulateFn {
+	if !tracerEnabled {
+		return other
+	}
+	return func(txBytes []byte) (sdk.GasInfo, *sdk.Result, error) {
+		cache := activeSimulations
+		if cache == nil {
+			return other(txBytes)
+		}
+		txHash := cmttypes.HexBytes(tmhash.Sum(txBytes)).String()
+		e := txExecutions.register(txHash, true)
+		defer txExecutions.remove(txHash, e)
+
+		gInfo, res, err := other(txBytes)
+		e.mx.Lock()
+		e.gasUsed = gInfo.GasUsed
+		if res != nil {
+			e.events = eventStrings(res.Events)
+		}
+		if err != nil {
+			e.err = err.Error()
+		}
+		key := e.key
+		e.mx.Unlock()
+		if key != "" {
+			cache.add(e)
+		}
+		return gInfo, res, err
+	}
+}
+
+// SimComparison is the difference between the simulation and the delivery of a tx
+type SimComparison struct {
+	GasSimulated        uint64   `json:"gas_simulated"`
+	GasUsed             uint64   `json:"gas_used"`
+	GasWanted           uint64   `json:"gas_wanted"`
+	KeysOnlySimulated   []string `json:"keys_only_simulated,omitempty"`
+	KeysOnlyDelivered   []string `json:"keys_only_delivered,omitempty"`
+	EventsOnlySimulated []string `json:"events_only_simulated,omitempty"`
+	EventsOnlyDelivered []string `json:"events_only_delivered,omitempty"`
+	ErrorSimulated      string   `json:"error_simulated,omitempty"`
+	ErrorDelivered      string   `json:"error_delivered,omitempty"`
+}
+
+// Diverged returns true when the gas, store keys, events or error differ
+func (c SimComparison) Diverged() bool {
+	return c.GasSimulated != c.GasUsed || len(c.KeysOnlySimulated) != 0 || len(c.KeysOnlyDelivered) != 0 ||
+		len(c.EventsOnlySimulated) != 0 || len(c.EventsOnlyDelivered) != 0 || c.ErrorSimulated != c.ErrorDelivered
+}
+
+// compareSimulation compares the simulation with the delivery result
+func compareSimulation(sim, delivered *txExecution, rsp abci.ResponseDeliverTx) SimComparison {
+	c := SimComparison{GasUsed: uint64(rsp.GasUsed), GasWanted: uint64(rsp.GasWanted)}
+	sim.mx.Lock()
+	c.GasSimulated, c.ErrorSimulated = sim.gasUsed, sim.err
+	simEvents := sim.events
+	sim.mx.Unlock()
+	if rsp.Code != 0 {
+		c.ErrorDelivered = rsp.Log
+	}
+	simKeys, deliveredKeys := sim.touchedKeys(), delivered.touchedKeys()
+	c.KeysOnlySimulated, c.KeysOnlyDelivered = setDiff(simKeys, deliveredKeys), setDiff(deliveredKeys, simKeys)
+	simEventSet, deliveredEventSet := toSet(simEvents), toSet(eventStrings(rsp.Events))
+	c.EventsOnlySimulated, c.EventsOnlyDelivered = setDiff(simEventSet, deliveredEventSet), setDiff(deliveredEventSet, simEventSet)
+	return c
+}
+
+// addSimComparison adds the comparison with the simulation to the tx span
+func addSimComparison(span opentracing.Span, c SimComparison) {
+	span.SetTag(tagSimGasUsed, c.GasSimulated)
+	if c.Diverged() {
+		span.SetTag(tagSimDiverged, "true")
+	}
+	span.LogFields(safeLogField(logSimComparison, toJson(c)))
+}
+
+// eventStrings renders the events as `type key=value ...`
+func eventStrings(events []abci.Event) []string {
+	r := make([]string, len(events))
+	for i, e := range events {
+		var b strings.Builder
+		b.WriteString(e.Type)
+		for _, a := range e.Attributes {
+			b.WriteString(" " + a.Key + "=" + a.Value)
+		}
+		r[i] = b.String()
+	}
+	return r
+}
+
+func toSet(s []string) map[string]struct{} {
+	r := make(map[string]struct{}, len(s))
+	for _, v := range s {
+		r[v] = struct{}{}
+	}
+	return r
+}
+
+// setDiff returns the sorted elements of a that are not in b
+func setDiff(a, b map[string]struct{}) []string {
+	var r []string
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			r = append(r, k)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+var _ kvStoreWrapper = &txExecution{}
+
+// wrap the store to record the keys touched
+func (e *txExecution) wrap(store storetypes.KVStore, storeName string) storetypes.KVStore {
+	return &touchedKVStore{KVStore: store, storeName: storeName, exec: e}
+}
+
+var _ storetypes.KVStore = &touchedKVStore{}
+
+// touchedKVStore is a decorator to the store that records the keys read, written or iterated for the tx execution
+type touchedKVStore struct {
+	storetypes.KVStore
+	storeName string
+	exec      *txExecution
+}
+
+func (s *touchedKVStore) Get(key []byte) []byte {
+	s.exec.touch(s.storeName, key)
+	return s.KVStore.Get(key)
+}
+
+func (s *touchedKVStore) Has(key []byte) bool {
+	s.exec.touch(s.storeName, key)
+	return s.KVStore.Has(key)
+}
+
+func (s *touchedKVStore) Set(key, value []byte) {
+	s.exec.touch(s.storeName, key)
+	s.KVStore.Set(key, value)
+}
+
+func (s *touchedKVStore) Delete(key []byte) {
+	s.exec.touch(s.storeName, key)
+	s.KVStore.Delete(key)
+}
+
+func (s *touchedKVStore) Iterator(start, end []byte) storetypes.Iterator {
+	return &touchedIterator{Iterator: s.KVStore.Iterator(start, end), store: s}
+}
+
+func (s *touchedKVStore) ReverseIterator(start, end []byte) storetypes.Iterator {
+	return &touchedIterator{Iterator: s.KVStore.ReverseIterator(start, end), store: s}
+}
+
+// touchedIterator records every entry that is iterated over
+type touchedIterator struct {
+	storetypes.Iterator
+	store *touchedKVStore
+}
+
+func (i *touchedIterator) Next() {
+	i.store.exec.touch(i.store.storeName, i.Key())
+	i.Iterator.Next()
+}
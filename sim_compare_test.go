@@ -0,0 +1,231 @@
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	abci "github.com/cometbft/cometbft/abci/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	txtypes "github.com/cosmos/cosmos-sdk/types/tx"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulationComparison(t *testing.T) {
+	tracerEnabled = true
+	activeSimulations = newSimulationCache(10)
+	t.Cleanup(func() {
+		tracerEnabled, activeSimulations, activeStoreFilter = false, nil, nil
+		SetSampler(nil)
+	})
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+
+	ctx, enc, storeKey := createMinTestInput(t)
+	ante := NewTraceAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (sdk.Context, error) {
+		return ctx, nil
+	}, enc)
+	// execute runs the tx with the store keys touched
+	execute := func(txBytes []byte, tx sdk.Tx, simulate bool, keys ...string) {
+		nextCtx, err := ante(ctx.WithTxBytes(txBytes), tx, simulate)
+		require.NoError(t, err)
+		DoWithTracing(nextCtx, "service", StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
+			for _, k := range keys {
+				workCtx.KVStore(storeKey).Get([]byte(k))
+			}
+			return nil
+		})
+	}
+	simEvents := []abci.Event{{Type: "transfer", Attributes: []abci.EventAttribute{{Key: "amount", Value: "1stake"}}}}
+	deliverTx := func(tx sdk.Tx, rsp abci.ResponseDeliverTx, keys ...string) *mocktracer.MockSpan {
+		TraceDeliverTx(func(req abci.RequestDeliverTx) abci.ResponseDeliverTx {
+			execute(req.Tx, tx, false, keys...)
+			return rsp
+		})(abci.RequestDeliverTx{Tx: []byte("signed-tx")})
+		spans := tracer.FinishedSpans()
+		root := spans[len(spans)-1]
+		require.Equal(t, "tx", root.OperationName)
+		return root
+	}
+	simulate := TraceSimulate(func(txBytes []byte) (sdk.GasInfo, *sdk.Result, error) {
+		execute(txBytes, newMockProtoTx("my memo", 1), true, "a", "b")
+		return sdk.GasInfo{GasUsed: 90}, &sdk.Result{Events: simEvents}, nil
+	})
+	simulation := true
+	specs := map[string]struct {
+		tx            sdk.Tx
+		rsp           abci.ResponseDeliverTx
+		keys          []string
+		sampler       *Sampler
+		filterExclude []string
+		exp           *SimComparison
+		expTag        any
+	}{
+		"same result": {
+			tx:   newMockProtoTx("my memo", 1),
+			rsp:  abci.ResponseDeliverTx{GasWanted: 200, GasUsed: 90, Events: simEvents},
+			keys: []string{"a", "b"},
+			exp:  &SimComparison{GasSimulated: 90, GasUsed: 90, GasWanted: 200},
+		},
+		"diverged": {
+			tx:   newMockProtoTx("my memo", 1),
+			rsp:  abci.ResponseDeliverTx{Code: 5, GasWanted: 200, GasUsed: 100, Log: "out of funds"},
+			keys: []string{"a", "c"},
+			exp: &SimComparison{
+				GasSimulated: 90, GasUsed: 100, GasWanted: 200,
+				KeysOnlySimulated:   []string{"wasm/62"},
+				KeysOnlyDelivered:   []string{"wasm/63"},
+				EventsOnlySimulated: []string{"transfer amount=1stake"},
+				ErrorDelivered:      "out of funds",
+			},
+			expTag: "true",
+		},
+		"simulation not sampled": {
+			tx:   newMockProtoTx("my memo", 1),
+			rsp:  abci.ResponseDeliverTx{GasWanted: 200, GasUsed: 90, Events: simEvents},
+			keys: []string{"a", "b"},
+			sampler: NewSampler(SamplingAction{Type: SamplingActionSample},
+				SamplingRule{Simulation: &simulation, Action: SamplingAction{Type: SamplingActionDrop}}),
+			exp: &SimComparison{GasSimulated: 90, GasUsed: 90, GasWanted: 200},
+		},
+		"store not captured": {
+			tx:            newMockProtoTx("my memo", 1),
+			rsp:           abci.ResponseDeliverTx{GasWanted: 200, GasUsed: 90, Events: simEvents},
+			keys:          []string{"a", "c"},
+			filterExclude: []string{"wasm"},
+			exp: &SimComparison{
+				GasSimulated: 90, GasUsed: 90, GasWanted: 200,
+				KeysOnlySimulated: []string{"wasm/62"},
+				KeysOnlyDelivered: []string{"wasm/63"},
+			},
+			expTag: "true",
+		},
+		"other sequence": {
+			tx:  newMockProtoTx("my memo", 2),
+			rsp: abci.ResponseDeliverTx{GasWanted: 200, GasUsed: 90},
+		},
+		"other body": {
+			tx:  newMockProtoTx("other memo", 1),
+			rsp: abci.ResponseDeliverTx{GasWanted: 200, GasUsed: 90},
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			tracer.Reset()
+			SetSampler(spec.sampler)
+			filter, err := newStoreCaptureFilter(nil, spec.filterExclude)
+			require.NoError(t, err)
+			activeStoreFilter = filter
+			_, _, err = simulate([]byte("unsigned-tx"))
+			require.NoError(t, err)
+
+			// when
+			root := deliverTx(spec.tx, spec.rsp, spec.keys...)
+
+			// then
+			idx := make(map[string]string)
+			for _, v := range root.Logs() {
+				idx[v.Fields[0].Key] = v.Fields[0].ValueString
+			}
+			if spec.exp == nil {
+				assert.Nil(t, root.Tag(tagSimGasUsed))
+				assert.NotContains(t, idx, logSimComparison)
+				return
+			}
+			assert.Equal(t, spec.exp.GasSimulated, root.Tag(tagSimGasUsed))
+			assert.Equal(t, spec.expTag, root.Tag(tagSimDiverged))
+			var got SimComparison
+			require.NoError(t, json.Unmarshal([]byte(idx[logSimComparison]), &got))
+			assert.Equal(t, *spec.exp, got)
+			// and taken from the cache
+			assert.Empty(t, activeSimulations.results)
+		})
+		activeSimulations = newSimulationCache(10)
+	}
+	assert.Empty(t, txExecutions.execs)
+}
+
+func TestTxExecutionRegistry(t *testing.T) {
+	ctx, _, _ := createMinTestInput(t)
+	r := &txExecutionRegistry{execs: make(map[string][]*txExecution)}
+	tx := newMockProtoTx("my memo", 1)
+	sim1, sim2, delivered := r.register("ABCD", true), r.register("ABCD", true), r.register("ABCD", false)
+
+	// when
+	got1 := r.attach(ctx, "ABCD", tx, true).Value(txExecutionKey)
+	got2 := r.attach(ctx, "ABCD", tx, true).Value(txExecutionKey)
+	gotDelivered := r.attach(ctx, "ABCD", tx, false).Value(txExecutionKey)
+	// then
+	assert.Same(t, sim1, got1)
+	assert.Same(t, sim2, got2)
+	assert.Same(t, delivered, gotDelivered)
+	assert.Nil(t, r.attach(ctx, "ABCD", tx, true).Value(txExecutionKey))
+
+	// and when
+	r.remove("ABCD", sim1)
+	// then
+	assert.Equal(t, []*txExecution{sim2, delivered}, r.execs["ABCD"])
+	r.remove("ABCD", sim2)
+	r.remove("ABCD", delivered)
+	assert.Empty(t, r.execs)
+}
+
+func TestSimulationCache(t *testing.T) {
+	c := newSimulationCache(2)
+	for _, k := range []string{"a", "b", "c"} {
+		c.add(&txExecution{key: k})
+	}
+	assert.Nil(t, c.take("a"))
+	require.NotNil(t, c.take("b"))
+	assert.Nil(t, c.take("b"))
+	assert.Equal(t, []string{"c"}, c.order)
+}
+
+func TestTraceSimulateError(t *testing.T) {
+	tracerEnabled = true
+	activeSimulations = newSimulationCache(1)
+	t.Cleanup(func() { tracerEnabled, activeSimulations = false, nil })
+	opentracing.SetGlobalTracer(mocktracer.New())
+	ctx, enc, _ := createMinTestInput(t)
+	ante := NewTraceAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (sdk.Context, error) {
+		return ctx, nil
+	}, enc)
+	tx := newMockProtoTx("my memo", 1)
+
+	// when
+	_, _, err := TraceSimulate(func(txBytes []byte) (sdk.GasInfo, *sdk.Result, error) {
+		_, err := ante(ctx.WithTxBytes(txBytes), tx, true)
+		require.NoError(t, err)
+		return sdk.GasInfo{GasUsed: 10}, nil, errors.New("insufficient funds")
+	})([]byte("unsigned-tx"))
+
+	// then
+	require.Error(t, err)
+	got := activeSimulations.take(txCompareKey(tx))
+	require.NotNil(t, got)
+	assert.Equal(t, "insufficient funds", got.err)
+	assert.Equal(t, uint64(10), got.gasUsed)
+}
+
+type mockProtoTx struct {
+	mockTx
+	protoTx *txtypes.Tx
+}
+
+func newMockProtoTx(memo string, sequence uint64) mockProtoTx {
+	return mockProtoTx{
+		mockTx: mockTx{msgs: []sdk.Msg{&banktypes.MsgSend{}}},
+		protoTx: &txtypes.Tx{
+			Body:     &txtypes.TxBody{Memo: memo},
+			AuthInfo: &txtypes.AuthInfo{SignerInfos: []*txtypes.SignerInfo{{Sequence: sequence}}},
+		},
+	}
+}
+
+func (m mockProtoTx) GetProtoTx() *txtypes.Tx {
+	return m.protoTx
+}
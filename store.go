@@ -1,7 +1,7 @@
 package tracing
 
 import (
-	"bytes"
+	"sync"
 
 	"github.com/cosmos/cosmos-sdk/store/gaskv"
 	"github.com/cosmos/cosmos-sdk/store/tracekv"
@@ -9,37 +9,219 @@ import (
 	sdk "github.com/cosmos/cosmos-sdk/types"
 )
 
-// TracingMultiStore Multistore that traces all operations
+// TracingMultiStore Multistore that traces all operations. Cache branches of it trace to the same buffer and gas meter.
 type TracingMultiStore struct {
 	sdk.MultiStore
-	buf             bytes.Buffer
+	// storeIO is bounded by MaxStoreTraced at construction
+	storeIO         *storeIOBuffer
 	traceWritesOnly bool
 	traceGasMeter   *TraceGasMeter
+	// ops and branches are shared with the cache branches. ops is nil when the net changes are captured or the
+	// operation log is not enabled
+	ops      *storeOps
+	branches *storeBranches
+	// diff is not nil when the net changes are captured. Each branch has its own
+	diff *storeDiff
+	// branch is nil for the root store
+	branch *StoreBranch
+	// captureStore decides which stores are captured. All stores are captured when nil
+	captureStore func(storeName string) bool
 }
 
 // NewTracingMultiStore constructor
 func NewTracingMultiStore(store sdk.MultiStore, traceWritesOnly bool) *TracingMultiStore {
 	return &TracingMultiStore{
 		MultiStore:      store,
+		storeIO:         newStoreIOBuffer(MaxStoreTraced),
 		traceWritesOnly: traceWritesOnly,
-		traceGasMeter:   NewTraceGasMeter(sdk.NewInfiniteGasMeter()),
+		traceGasMeter:   newSpanTraceGasMeter(sdk.NewInfiniteGasMeter()),
+		ops:             newStoreOps(),
+		branches:        &storeBranches{},
+	}
+}
+
+// NewTracingMultiStoreWithDiff constructor for a store that captures the net changes instead of the operations
+func NewTracingMultiStoreWithDiff(store sdk.MultiStore) *TracingMultiStore {
+	return &TracingMultiStore{
+		MultiStore:    store,
+		storeIO:       newStoreIOBuffer(MaxStoreTraced),
+		traceGasMeter: newSpanTraceGasMeter(sdk.NewInfiniteGasMeter()),
+		branches:      &storeBranches{},
+		diff:          newStoreDiff(),
 	}
 }
 
 func (t *TracingMultiStore) GetStore(k storetypes.StoreKey) sdk.Store {
-	return tracekv.NewStore(t.MultiStore.GetKVStore(k), &t.buf, nil)
+	if !t.isCaptured(k.Name()) {
+		return t.MultiStore.GetStore(k)
+	}
+	return tracekv.NewStore(t.MultiStore.GetKVStore(k), t.storeIO.writer(k.Name()), t.traceContext())
 }
 
 func (t *TracingMultiStore) GetKVStore(k storetypes.StoreKey) sdk.KVStore {
-	parentStore := t.MultiStore.GetKVStore(k)
+	rawStore := t.MultiStore.GetKVStore(k)
+	if !t.isCaptured(k.Name()) {
+		// pass through without any capturing or gas tracking
+		return rawStore
+	}
 	// wrap with gaskv to track gas usage
-	parentStore = gaskv.NewStore(parentStore, t.traceGasMeter, storetypes.KVGasConfig())
-	// wrap with trace store
-	traceStore := tracekv.NewStore(parentStore, &t.buf, nil)
-	if !t.traceWritesOnly {
-		return traceStore
+	parentStore := gaskv.NewStore(rawStore, t.traceGasMeter, storetypes.KVGasConfig())
+	var opStore sdk.KVStore = parentStore
+	if t.ops != nil || t.diff != nil {
+		// wrap with operation log store
+		opStore = &opLogKVStore{
+			KVStore:    parentStore,
+			raw:        rawStore,
+			decoder:    getKeyDecoder(k.Name()),
+			storeName:  k.Name(),
+			branch:     t.branchID(),
+			writesOnly: t.traceWritesOnly,
+			gasMeter:   t.traceGasMeter,
+			ops:        t.ops,
+			diff:       t.diff,
+		}
+	}
+	store := opStore
+	if t.diff == nil {
+		// wrap with trace store
+		traceStore := tracekv.NewStore(opStore, t.storeIO.writer(k.Name()), t.traceContext())
+		store = traceStore
+		if t.traceWritesOnly {
+			store = NewTraceWritesOnlyStore(opStore, traceStore)
+		}
 	}
-	return NewTraceWritesOnlyStore(parentStore, traceStore)
+	return store
+}
+
+// isCaptured returns true when the operations on the store are captured
+func (t *TracingMultiStore) isCaptured(storeName string) bool {
+	return t.captureStore == nil || t.captureStore(storeName)
+}
+
+func (t *TracingMultiStore) decorated() storetypes.MultiStore {
+	return t.MultiStore
+}
+
+// traceContext returns the branch id as metadata for the store operations of a branch
+func (t *TracingMultiStore) traceContext() storetypes.TraceContext {
+	if t.branch == nil {
+		return nil
+	}
+	return storetypes.TraceContext{"branch": t.branch.ID}
+}
+
+// branchID returns the id of the branch or 0 for the root store
+func (t *TracingMultiStore) branchID() int {
+	if t.branch == nil {
+		return 0
+	}
+	return t.branch.ID
+}
+
+// CacheMultiStore returns a traced cache branch
+func (t *TracingMultiStore) CacheMultiStore() storetypes.CacheMultiStore {
+	return t.newBranch(t.MultiStore.CacheMultiStore())
+}
+
+// CacheMultiStoreWithVersion returns a traced cache branch of the version
+func (t *TracingMultiStore) CacheMultiStoreWithVersion(version int64) (storetypes.CacheMultiStore, error) {
+	cms, err := t.MultiStore.CacheMultiStoreWithVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	return t.newBranch(cms), nil
+}
+
+// CacheWrap returns a traced cache branch
+func (t *TracingMultiStore) CacheWrap() storetypes.CacheWrap {
+	return t.CacheMultiStore()
+}
+
+func (t *TracingMultiStore) newBranch(cms storetypes.CacheMultiStore) *TracingCacheMultiStore {
+	b := t.branches.add(t.branchID())
+	var diff *storeDiff
+	if t.diff != nil {
+		diff = newStoreDiff()
+	}
+	return &TracingCacheMultiStore{
+		TracingMultiStore: &TracingMultiStore{
+			MultiStore:      cms,
+			storeIO:         t.storeIO,
+			traceWritesOnly: t.traceWritesOnly,
+			traceGasMeter:   t.traceGasMeter,
+			ops:             t.ops,
+			branches:        t.branches,
+			branch:          b,
+			diff:            diff,
+			captureStore:    t.captureStore,
+		},
+		cms:        cms,
+		parentDiff: t.diff,
+	}
+}
+
+var _ storetypes.CacheMultiStore = &TracingCacheMultiStore{}
+
+// TracingCacheMultiStore is a traced cache branch that records when it is written back to the parent
+type TracingCacheMultiStore struct {
+	*TracingMultiStore
+	cms storetypes.CacheMultiStore
+	// parentDiff is nil when the net changes are not captured
+	parentDiff *storeDiff
+}
+
+// Write writes the branch back to the parent store
+func (t *TracingCacheMultiStore) Write() {
+	t.cms.Write()
+	t.branches.written(t.branch)
+	if t.parentDiff != nil {
+		t.parentDiff.merge(t.diff)
+	}
+}
+
+// Status of the cache branches
+const (
+	StoreBranchWritten   = "written"
+	StoreBranchDiscarded = "discarded"
+)
+
+// StoreBranch is a cache branch of the traced store. The branch id is in the metadata of the store operations.
+// A branch that was not written back when the span finishes is discarded.
+type StoreBranch struct {
+	ID int `json:"id"`
+	// Parent is the id of the parent branch or 0 for the traced store
+	Parent int    `json:"parent,omitempty"`
+	Status string `json:"status"`
+}
+
+type storeBranches struct {
+	mx       sync.Mutex
+	branches []*StoreBranch
+}
+
+func (s *storeBranches) add(parent int) *StoreBranch {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	b := &StoreBranch{ID: len(s.branches) + 1, Parent: parent, Status: StoreBranchDiscarded}
+	s.branches = append(s.branches, b)
+	return b
+}
+
+func (s *storeBranches) written(b *StoreBranch) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	b.Status = StoreBranchWritten
+}
+
+// all returns a copy of the branches in creation order
+func (s *storeBranches) all() []StoreBranch {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	r := make([]StoreBranch, len(s.branches))
+	for i, b := range s.branches {
+		r[i] = *b
+	}
+	return r
 }
 
 var _ sdk.KVStore = &TraceWritesKVStore{}
@@ -78,7 +260,3 @@ func (t *TraceWritesKVStore) Set(key, value []byte) {
 func (t *TraceWritesKVStore) Delete(key []byte) {
 	t.Store.Delete(key)
 }
-
-func (t *TracingMultiStore) getStoreDataLimited(max int) string {
-	return cutLength(t.buf.String(), max)
-}
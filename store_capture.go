@@ -0,0 +1,226 @@
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+)
+
+// store capture setting names used in the config
+const (
+	StoreCaptureAll        = "all"
+	StoreCaptureWritesOnly = "writes-only"
+	StoreCaptureNothing    = "nothing"
+	StoreCaptureDiff       = "diff"
+)
+
+// store capture rule condition key for the setting
+const ruleKeyCapture = "capture"
+
+// activeStoreCapture overrides the store capture setting of the call sites. Nil keeps the call site settings
+var activeStoreCapture atomic.Pointer[StoreCapturePolicy]
+
+// SetStoreCapturePolicy sets the policy for new spans. Nil keeps the store capture setting of the call sites.
+// Safe to call at runtime.
+func SetStoreCapturePolicy(p *StoreCapturePolicy) {
+	activeStoreCapture.Store(p)
+}
+
+// ParseStoreLogSetting parses the setting name: `all`, `writes-only`, `nothing` or `diff`
+func ParseStoreLogSetting(s string) (StoreLogSetting, error) {
+	switch strings.TrimSpace(s) {
+	case StoreCaptureAll:
+		return StoreLogAll, nil
+	case StoreCaptureWritesOnly:
+		return StoreLogWritesOnly, nil
+	case StoreCaptureNothing:
+		return StoreLogNothing, nil
+	case StoreCaptureDiff:
+		return StoreLogDiff, nil
+	default:
+		return StoreLogAll, fmt.Errorf("unsupported store capture: %q", s)
+	}
+}
+
+// String returns the setting in the parsable format
+func (s StoreLogSetting) String() string {
+	switch s {
+	case StoreLogAll:
+		return StoreCaptureAll
+	case StoreLogWritesOnly:
+		return StoreCaptureWritesOnly
+	case StoreLogNothing:
+		return StoreCaptureNothing
+	case StoreLogDiff:
+		return StoreCaptureDiff
+	default:
+		return fmt.Sprintf("StoreLogSetting(%d)", int(s))
+	}
+}
+
+// StoreCaptureRule matches when all conditions set are satisfied. Lists match when any value is contained.
+type StoreCaptureRule struct {
+	Operations []string
+	Modules    []string
+	Contracts  []string
+	MsgTypes   []string
+	Capture    StoreLogSetting
+}
+
+// ParseStoreCaptureRule parses a rule string of space separated `key=value` conditions with `|` separated alternatives.
+// Supported keys are operation, module, contract, msg_type and the mandatory capture setting.
+// For example: `operation=wasmvm_execute contract=wasm1abc capture=all`
+func ParseStoreCaptureRule(s string) (StoreCaptureRule, error) {
+	var r StoreCaptureRule
+	var hasCapture bool
+	for _, field := range strings.Fields(s) {
+		k, v, ok := strings.Cut(field, "=")
+		if !ok || v == "" {
+			return r, fmt.Errorf("invalid condition %q: expected key=value", field)
+		}
+		switch k {
+		case ruleKeyOperation:
+			r.Operations = strings.Split(v, "|")
+		case ruleKeyModule:
+			r.Modules = strings.Split(v, "|")
+		case ruleKeyContract:
+			r.Contracts = strings.Split(v, "|")
+		case ruleKeyMsgType:
+			r.MsgTypes = strings.Split(v, "|")
+		case ruleKeyCapture:
+			var err error
+			if r.Capture, err = ParseStoreLogSetting(v); err != nil {
+				return r, fmt.Errorf("condition %q: %w", k, err)
+			}
+			hasCapture = true
+		default:
+			return r, fmt.Errorf("unsupported condition key: %q", k)
+		}
+	}
+	if !hasCapture {
+		return r, errors.New("capture must be set")
+	}
+	return r, nil
+}
+
+// String returns the rule in the parsable format
+func (r StoreCaptureRule) String() string {
+	var fields []string
+	for _, c := range []struct {
+		key    string
+		values []string
+	}{
+		{ruleKeyOperation, r.Operations},
+		{ruleKeyModule, r.Modules},
+		{ruleKeyContract, r.Contracts},
+		{ruleKeyMsgType, r.MsgTypes},
+	} {
+		if len(c.values) != 0 {
+			fields = append(fields, c.key+"="+strings.Join(c.values, "|"))
+		}
+	}
+	return strings.Join(append(fields, ruleKeyCapture+"="+r.Capture.String()), " ")
+}
+
+// Matches returns true when all conditions are satisfied by the span params.
+// Conditions on attributes that are not known in the params do not match.
+func (r StoreCaptureRule) Matches(p SamplingParams) bool {
+	return (len(r.Operations) == 0 || containsAny(r.Operations, p.Operation)) &&
+		(len(r.Modules) == 0 || containsAny(r.Modules, p.Modules...)) &&
+		(len(r.Contracts) == 0 || containsAny(r.Contracts, p.Contracts...)) &&
+		(len(r.MsgTypes) == 0 || containsAny(r.MsgTypes, p.MsgTypes...))
+}
+
+// StoreCapturePolicy overrides the store capture setting of a span with the setting of the first matching rule
+type StoreCapturePolicy struct {
+	rules []StoreCaptureRule
+}
+
+// NewStoreCapturePolicy constructor
+func NewStoreCapturePolicy(rules ...StoreCaptureRule) *StoreCapturePolicy {
+	return &StoreCapturePolicy{rules: rules}
+}
+
+// StoreLogFor returns the setting of the first matching rule or the call site setting when none matches
+func (s *StoreCapturePolicy) StoreLogFor(p SamplingParams, callSite StoreLogSetting) StoreLogSetting {
+	if s == nil {
+		return callSite
+	}
+	for _, r := range s.rules {
+		if r.Matches(p) {
+			return r.Capture
+		}
+	}
+	return callSite
+}
+
+// Rules returns the rules in the parsable format
+func (s *StoreCapturePolicy) Rules() []string {
+	if s == nil {
+		return []string{}
+	}
+	r := make([]string, len(s.rules))
+	for i, v := range s.rules {
+		r[i] = v.String()
+	}
+	return r
+}
+
+// newStoreCapturePolicyFromConfig returns nil when no rules are set
+func newStoreCapturePolicyFromConfig(cfg TracerConfig) (*StoreCapturePolicy, error) {
+	return parseStoreCapturePolicy(cfg.StoreCaptureRules)
+}
+
+// parseStoreCapturePolicy returns nil when no rules are given
+func parseStoreCapturePolicy(ruleStrs []string) (*StoreCapturePolicy, error) {
+	if len(ruleStrs) == 0 {
+		return nil, nil
+	}
+	rules := make([]StoreCaptureRule, len(ruleStrs))
+	for i, s := range ruleStrs {
+		var err error
+		if rules[i], err = ParseStoreCaptureRule(s); err != nil {
+			return nil, fmt.Errorf("store capture rule %d: %w", i, err)
+		}
+	}
+	return NewStoreCapturePolicy(rules...), nil
+}
+
+// StoreCaptureRules is the request and response body of the store capture rules endpoint
+type StoreCaptureRules struct {
+	Rules []string `json:"rules"`
+}
+
+// RegisterStoreCaptureRoutes registers the admin endpoint to read and replace the store capture rules at runtime,
+// for example to the app's API router. The rules are not persisted and the config applies again on restart.
+// Replacing the rules is forbidden unless enabled with the store-capture-updates config, as the endpoint changes the
+// node's tracing without authentication.
+func RegisterStoreCaptureRoutes(r *mux.Router) {
+	const path = "/cosmos-tracing/v1/store-capture-rules"
+	r.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, StoreCaptureRules{Rules: activeStoreCapture.Load().Rules()})
+	}).Methods(http.MethodGet)
+	r.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if !tracerConfig.StoreCaptureUpdates {
+			writeJSONError(w, http.StatusForbidden, errors.New("store capture updates are not enabled"))
+			return
+		}
+		var req StoreCaptureRules
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		p, err := parseStoreCapturePolicy(req.Rules)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		SetStoreCapturePolicy(p)
+		writeJSON(w, http.StatusOK, StoreCaptureRules{Rules: p.Rules()})
+	}).Methods(http.MethodPut)
+}
@@ -0,0 +1,191 @@
+package tracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/gorilla/mux"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStoreCaptureRule(t *testing.T) {
+	specs := map[string]struct {
+		src    string
+		exp    StoreCaptureRule
+		expErr bool
+	}{
+		"all conditions": {
+			src: "operation=wasmvm_execute|wasmvm_reply module=wasm contract=wasm1abc|wasm1def msg_type=/cosmwasm.wasm.v1.MsgExecuteContract capture=all",
+			exp: StoreCaptureRule{
+				Operations: []string{"wasmvm_execute", "wasmvm_reply"},
+				Modules:    []string{"wasm"},
+				Contracts:  []string{"wasm1abc", "wasm1def"},
+				MsgTypes:   []string{"/cosmwasm.wasm.v1.MsgExecuteContract"},
+				Capture:    StoreLogAll,
+			},
+		},
+		"writes only": {
+			src: "operation=ante_handler capture=writes-only",
+			exp: StoreCaptureRule{Operations: []string{"ante_handler"}, Capture: StoreLogWritesOnly},
+		},
+		"capture only": {
+			src: "capture=diff",
+			exp: StoreCaptureRule{Capture: StoreLogDiff},
+		},
+		"no capture": {
+			src:    "operation=ante_handler",
+			expErr: true,
+		},
+		"unknown capture": {
+			src:    "capture=foo",
+			expErr: true,
+		},
+		"unknown key": {
+			src:    "height=1 capture=nothing",
+			expErr: true,
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			got, gotErr := ParseStoreCaptureRule(spec.src)
+			if spec.expErr {
+				require.Error(t, gotErr)
+				return
+			}
+			require.NoError(t, gotErr)
+			assert.Equal(t, spec.exp, got)
+		})
+	}
+}
+
+func TestStoreCapturePolicy(t *testing.T) {
+	t.Cleanup(func() { SetStoreCapturePolicy(nil) })
+	const myContract = "wasm1abc"
+	specs := map[string]struct {
+		policy       *StoreCapturePolicy
+		contract     string
+		expNoStoreIO bool
+	}{
+		"no policy": {
+			contract:     myContract,
+			expNoStoreIO: true,
+		},
+		"contract matches": {
+			policy:   NewStoreCapturePolicy(StoreCaptureRule{Operations: []string{"wasmvm_execute"}, Contracts: []string{myContract}, Capture: StoreLogAll}),
+			contract: myContract,
+		},
+		"other contract": {
+			policy:       NewStoreCapturePolicy(StoreCaptureRule{Operations: []string{"wasmvm_execute"}, Contracts: []string{myContract}, Capture: StoreLogAll}),
+			contract:     "wasm1def",
+			expNoStoreIO: true,
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			tracer := mocktracer.New()
+			opentracing.SetGlobalTracer(tracer)
+			SetStoreCapturePolicy(spec.policy)
+			ctx, _, storeKey := createMinTestInput(t)
+
+			// when
+			p := SamplingParams{Operation: "wasmvm_execute", Contracts: []string{spec.contract}}
+			DoWithTracingParams(ctx, p, StoreLogWritesOnly, func(workCtx sdk.Context, span opentracing.Span) error {
+				workCtx.KVStore(storeKey).Get([]byte("foo"))
+				return nil
+			})
+
+			// then
+			spans := tracer.FinishedSpans()
+			require.Len(t, spans, 1)
+			idx := make(map[string]string)
+			for _, v := range spans[0].Logs() {
+				idx[v.Fields[0].Key] = v.Fields[0].ValueString
+			}
+			if spec.expNoStoreIO {
+				assert.Empty(t, idx[logRawStoreIO])
+				return
+			}
+			assert.Contains(t, idx[logRawStoreIO], `"operation":"read"`)
+		})
+	}
+}
+
+func TestStoreCaptureRoutes(t *testing.T) {
+	t.Cleanup(func() {
+		SetStoreCapturePolicy(nil)
+		tracerConfig.StoreCaptureUpdates = false
+	})
+	router := mux.NewRouter()
+	RegisterStoreCaptureRoutes(router)
+	const path = "/cosmos-tracing/v1/store-capture-rules"
+	specs := map[string]struct {
+		method          string
+		body            string
+		updatesDisabled bool
+		expStatus       int
+		exp             []string
+	}{
+		"replace not enabled": {
+			method:          http.MethodPut,
+			body:            `{"rules":["operation=wasmvm_execute capture=all"]}`,
+			updatesDisabled: true,
+			expStatus:       http.StatusForbidden,
+		},
+		"get without policy": {
+			method:    http.MethodGet,
+			expStatus: http.StatusOK,
+			exp:       []string{},
+		},
+		"replace": {
+			method:    http.MethodPut,
+			body:      `{"rules":["contract=wasm1abc|wasm1def operation=wasmvm_execute capture=diff"]}`,
+			expStatus: http.StatusOK,
+			exp:       []string{"operation=wasmvm_execute contract=wasm1abc|wasm1def capture=diff"},
+		},
+		"get replaced": {
+			method:    http.MethodGet,
+			expStatus: http.StatusOK,
+			exp:       []string{"operation=wasmvm_execute contract=wasm1abc|wasm1def capture=diff"},
+		},
+		"invalid rule": {
+			method:    http.MethodPut,
+			body:      `{"rules":["operation=wasmvm_execute"]}`,
+			expStatus: http.StatusBadRequest,
+		},
+		"get unchanged by invalid": {
+			method:    http.MethodGet,
+			expStatus: http.StatusOK,
+			exp:       []string{"operation=wasmvm_execute contract=wasm1abc|wasm1def capture=diff"},
+		},
+		"reset": {
+			method:    http.MethodPut,
+			body:      `{"rules":[]}`,
+			expStatus: http.StatusOK,
+			exp:       []string{},
+		},
+	}
+	// run in order as the cases build on each other
+	for _, name := range []string{"replace not enabled", "get without policy", "replace", "get replaced", "invalid rule", "get unchanged by invalid", "reset"} {
+		spec := specs[name]
+		t.Run(name, func(t *testing.T) {
+			tracerConfig.StoreCaptureUpdates = !spec.updatesDisabled
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(spec.method, path, strings.NewReader(spec.body)))
+			require.Equal(t, spec.expStatus, rec.Code, rec.Body.String())
+			if spec.expStatus != http.StatusOK {
+				return
+			}
+			var got StoreCaptureRules
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.Equal(t, spec.exp, got.Rules)
+		})
+	}
+	assert.Nil(t, activeStoreCapture.Load())
+}
@@ -0,0 +1,123 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"sync"
+)
+
+// StoreDiffEntry is the net change of a key in a span. Old is empty when the key did not exist before.
+type StoreDiffEntry struct {
+	Store string `json:"store"`
+	// Key hex encoded
+	Key string `json:"key"`
+	// Old value hex encoded
+	Old string `json:"old,omitempty"`
+	// New value hex encoded
+	New     string `json:"new,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+	// Decoded is the human readable change when a key decoder is registered for the store
+	Decoded string `json:"decoded,omitempty"`
+}
+
+type storeDiffKey struct {
+	store, key string
+}
+
+type storeDiffValue struct {
+	old, new []byte
+	deleted  bool
+}
+
+// storeDiffOverhead is the estimated JSON size of a diff entry without store, key and values
+const storeDiffOverhead = 48
+
+// storeDiff collects the net changes of a traced store or branch in order of the first write.
+// Reads are not captured and repeated writes to a key collapse into a single entry. New keys are captured up to max
+// bytes of the estimated JSON size, writes to keys past the limit are counted only.
+type storeDiff struct {
+	mx      sync.Mutex
+	order   []storeDiffKey
+	changes map[storeDiffKey]*storeDiffValue
+	max     int
+	size    int
+	omitted int
+}
+
+// newStoreDiff constructor for a diff bounded by MaxStoreTraced
+func newStoreDiff() *storeDiff {
+	return &storeDiff{changes: make(map[storeDiffKey]*storeDiffValue), max: MaxStoreTraced}
+}
+
+// record the write with the old value callback called on the first write to the key only
+func (d *storeDiff) record(store string, key, value []byte, deleted bool, old func() []byte) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	d.recordLocked(store, key, value, deleted, old)
+}
+
+func (d *storeDiff) recordLocked(store string, key, value []byte, deleted bool, old func() []byte) {
+	k := storeDiffKey{store: store, key: string(key)}
+	v, ok := d.changes[k]
+	if !ok {
+		if d.omitted != 0 || d.size+storeDiffOverhead+len(store)+2*len(key) > d.max {
+			d.omitted++
+			return
+		}
+		v = &storeDiffValue{old: old()}
+		d.changes[k] = v
+		d.order = append(d.order, k)
+		d.size += storeDiffOverhead + len(store) + 2*len(key) + 2*len(v.old)
+	}
+	d.size += 2 * (len(value) - len(v.new))
+	v.new, v.deleted = value, deleted
+}
+
+// merge the changes and omitted writes of a branch that is written back. The old values of this diff are kept.
+func (d *storeDiff) merge(other *storeDiff) {
+	other.mx.Lock()
+	defer other.mx.Unlock()
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	for _, k := range other.order {
+		v := other.changes[k]
+		d.recordLocked(k.store, []byte(k.key), v.new, v.deleted, func() []byte { return v.old })
+	}
+	d.omitted += other.omitted
+}
+
+// omittedWrites returns the number of writes to keys that were not captured
+func (d *storeDiff) omittedWrites() int {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	return d.omitted
+}
+
+// entries returns the net changes. Keys that end with the old value are left out.
+func (d *storeDiff) entries() []StoreDiffEntry {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	r := make([]StoreDiffEntry, 0, len(d.order))
+	for _, k := range d.order {
+		v := d.changes[k]
+		if (v.deleted && v.old == nil) || (!v.deleted && v.old != nil && bytes.Equal(v.old, v.new)) {
+			continue
+		}
+		e := StoreDiffEntry{
+			Store:   k.store,
+			Key:     hex.EncodeToString([]byte(k.key)),
+			Old:     hex.EncodeToString(v.old),
+			New:     hex.EncodeToString(v.new),
+			Deleted: v.deleted,
+		}
+		if decoder := getKeyDecoder(k.store); decoder != nil {
+			op := StoreOpWrite
+			if v.deleted {
+				op = StoreOpDelete
+			}
+			e.Decoded = describeStoreOp(decoder, k.store, op, []byte(k.key), v.old, v.new)
+		}
+		r = append(r, e)
+	}
+	return r
+}
@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"fmt"
+	"strings"
+)
+
+// activeStoreFilter decides which stores are captured by the spans. Nil captures all stores
+var activeStoreFilter *storeCaptureFilter
+
+type storeCaptureEntry struct {
+	// operation is empty for all operations
+	operation string
+	store     string
+}
+
+// storeCaptureFilter is the store include and exclude lists. Entries are store key names, like `params`, or
+// `<operation>:<store>`, like `ante_handler:acc`, to apply to the spans of the operation only.
+type storeCaptureFilter struct {
+	include []storeCaptureEntry
+	exclude []storeCaptureEntry
+}
+
+// newStoreCaptureFilter constructor. Returns nil when both lists are empty
+func newStoreCaptureFilter(include, exclude []string) (*storeCaptureFilter, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+	f := &storeCaptureFilter{}
+	var err error
+	if f.include, err = parseStoreCaptureEntries(include); err != nil {
+		return nil, fmt.Errorf("include: %w", err)
+	}
+	if f.exclude, err = parseStoreCaptureEntries(exclude); err != nil {
+		return nil, fmt.Errorf("exclude: %w", err)
+	}
+	return f, nil
+}
+
+func parseStoreCaptureEntries(entries []string) ([]storeCaptureEntry, error) {
+	r := make([]storeCaptureEntry, len(entries))
+	for i, v := range entries {
+		var e storeCaptureEntry
+		if op, store, ok := strings.Cut(v, ":"); ok {
+			e = storeCaptureEntry{operation: strings.TrimSpace(op), store: strings.TrimSpace(store)}
+			if e.operation == "" {
+				return nil, fmt.Errorf("empty operation: %q", v)
+			}
+		} else {
+			e.store = strings.TrimSpace(v)
+		}
+		if e.store == "" || strings.Contains(e.store, ":") {
+			return nil, fmt.Errorf("invalid store: %q", v)
+		}
+		r[i] = e
+	}
+	return r, nil
+}
+
+// forOperation returns the decision function for the store names in the spans of the operation.
+// Nil is returned when all stores are captured.
+func (f *storeCaptureFilter) forOperation(operation string) func(storeName string) bool {
+	if f == nil {
+		return nil
+	}
+	include, exclude := f.storesFor(f.include, operation), f.storesFor(f.exclude, operation)
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil
+	}
+	return func(storeName string) bool {
+		if _, ok := exclude[storeName]; ok {
+			return false
+		}
+		if len(include) == 0 {
+			return true
+		}
+		_, ok := include[storeName]
+		return ok
+	}
+}
+
+func (f *storeCaptureFilter) storesFor(entries []storeCaptureEntry, operation string) map[string]struct{} {
+	r := make(map[string]struct{})
+	for _, e := range entries {
+		if e.operation == "" || e.operation == operation {
+			r[e.store] = struct{}{}
+		}
+	}
+	return r
+}
@@ -0,0 +1,108 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreCaptureFilter(t *testing.T) {
+	specs := map[string]struct {
+		include, exclude []string
+		operation        string
+		expCaptured      []string
+		expNotCaptured   []string
+		expAll           bool
+		expErr           bool
+	}{
+		"empty": {
+			operation: "ante_handler",
+			expAll:    true,
+		},
+		"exclude": {
+			exclude:        []string{"params", "capability"},
+			operation:      "ante_handler",
+			expCaptured:    []string{"bank"},
+			expNotCaptured: []string{"params", "capability"},
+		},
+		"exclude for operation": {
+			exclude:        []string{"module_begin_block:distribution"},
+			operation:      "module_begin_block",
+			expCaptured:    []string{"bank"},
+			expNotCaptured: []string{"distribution"},
+		},
+		"exclude for other operation": {
+			exclude:   []string{"module_begin_block:distribution"},
+			operation: "ante_handler",
+			expAll:    true,
+		},
+		"include for operation": {
+			include:        []string{"ante_handler:acc", "ante_handler:bank"},
+			operation:      "ante_handler",
+			expCaptured:    []string{"acc", "bank"},
+			expNotCaptured: []string{"params", "wasm"},
+		},
+		"include and exclude": {
+			include:        []string{"acc", "bank"},
+			exclude:        []string{"ante_handler:bank"},
+			operation:      "ante_handler",
+			expCaptured:    []string{"acc"},
+			expNotCaptured: []string{"bank", "wasm"},
+		},
+		"empty operation": {
+			exclude: []string{":params"},
+			expErr:  true,
+		},
+		"empty store": {
+			include: []string{"ante_handler:"},
+			expErr:  true,
+		},
+		"multiple separators": {
+			exclude: []string{"a:b:c"},
+			expErr:  true,
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			f, gotErr := newStoreCaptureFilter(spec.include, spec.exclude)
+			if spec.expErr {
+				require.Error(t, gotErr)
+				return
+			}
+			require.NoError(t, gotErr)
+			// when
+			got := f.forOperation(spec.operation)
+			// then
+			if spec.expAll {
+				assert.Nil(t, got)
+				return
+			}
+			require.NotNil(t, got)
+			for _, s := range spec.expCaptured {
+				assert.True(t, got(s), s)
+			}
+			for _, s := range spec.expNotCaptured {
+				assert.False(t, got(s), s)
+			}
+		})
+	}
+}
+
+func TestTracingMultiStoreNotCaptured(t *testing.T) {
+	ctx, _, storeKey := createMinTestInput(t)
+	ms := NewTracingMultiStore(ctx.MultiStore(), false)
+	ms.captureStore = func(storeName string) bool { return storeName != storeKey.Name() }
+
+	// when
+	ms.GetKVStore(storeKey).Set([]byte("foo"), []byte("bar"))
+	branch := ms.CacheMultiStore()
+	branch.GetKVStore(storeKey).Set([]byte("other"), []byte("value"))
+	branch.Write()
+
+	// then
+	assert.Equal(t, []byte("value"), ctx.KVStore(storeKey).Get([]byte("other")))
+	assert.Empty(t, ms.ops.all())
+	assert.Empty(t, ms.storeIO.String())
+	assert.Zero(t, ms.traceGasMeter.GasConsumed())
+}
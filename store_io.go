@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// StoreIOSummary is the raw store io of a store in a span. The omitted operations exceeded the capture limit.
+type StoreIOSummary struct {
+	Store        string `json:"store"`
+	Ops          int    `json:"ops"`
+	Bytes        int    `json:"bytes"`
+	OmittedOps   int    `json:"omitted_ops,omitempty"`
+	OmittedBytes int    `json:"omitted_bytes,omitempty"`
+}
+
+// storeIOBuffer collects the raw store io lines of the trace stores up to max bytes. Lines past the limit are not
+// buffered but counted per store so that the memory stays bounded for heavy spans.
+type storeIOBuffer struct {
+	mx      sync.Mutex
+	buf     bytes.Buffer
+	max     int
+	full    bool
+	omitted int
+	order   []string
+	stores  map[string]*StoreIOSummary
+}
+
+func newStoreIOBuffer(max int) *storeIOBuffer {
+	return &storeIOBuffer{max: max, stores: make(map[string]*StoreIOSummary)}
+}
+
+// writer returns the writer for the trace store of the given store name
+func (b *storeIOBuffer) writer(storeName string) io.Writer {
+	return &storeIOWriter{target: b, storeName: storeName}
+}
+
+// add the complete line. Once a line does not fit, all following lines are omitted to keep the order.
+func (b *storeIOBuffer) add(storeName string, line []byte) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	s, ok := b.stores[storeName]
+	if !ok {
+		s = &StoreIOSummary{Store: storeName}
+		b.stores[storeName] = s
+		b.order = append(b.order, storeName)
+	}
+	s.Ops++
+	s.Bytes += len(line)
+	if !b.full && b.buf.Len()+len(line) <= b.max {
+		b.buf.Write(line)
+		return
+	}
+	b.full = true
+	b.omitted++
+	s.OmittedOps++
+	s.OmittedBytes += len(line)
+}
+
+// String returns the buffered lines
+func (b *storeIOBuffer) String() string {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.buf.String()
+}
+
+// omittedOps returns the number of operations not buffered
+func (b *storeIOBuffer) omittedOps() int {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.omitted
+}
+
+// summary returns the counters per store in order of the first operation
+func (b *storeIOBuffer) summary() []StoreIOSummary {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	r := make([]StoreIOSummary, len(b.order))
+	for i, name := range b.order {
+		r[i] = *b.stores[name]
+	}
+	return r
+}
+
+// storeIOWriter assembles the lines of a trace store. The tracekv store writes the operation and the newline separately.
+type storeIOWriter struct {
+	target    *storeIOBuffer
+	storeName string
+	line      []byte
+}
+
+func (w *storeIOWriter) Write(p []byte) (int, error) {
+	rest := p
+	for {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			w.line = append(w.line, rest...)
+			return len(p), nil
+		}
+		w.line = append(w.line, rest[:i+1]...)
+		w.target.add(w.storeName, w.line)
+		w.line = w.line[:0]
+		rest = rest[i+1:]
+	}
+}
@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreIOBuffer(t *testing.T) {
+	specs := map[string]struct {
+		max          int
+		expLines     int
+		expOmitted   int
+		expOmittedBz int
+	}{
+		"all fit": {
+			max:      1000,
+			expLines: 3,
+		},
+		"limited": {
+			max:          10,
+			expLines:     2,
+			expOmitted:   1,
+			expOmittedBz: 7,
+		},
+		"nothing fits": {
+			max:          3,
+			expOmitted:   3,
+			expOmittedBz: 15,
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			b := newStoreIOBuffer(spec.max)
+			bank, wasm := b.writer("bank"), b.writer("wasm")
+
+			// when
+			_, _ = bank.Write([]byte("op1"))
+			_, _ = bank.Write([]byte("\n"))
+			_, _ = wasm.Write([]byte("op2\n"))
+			_, _ = bank.Write([]byte("op3333\n"))
+
+			// then
+			assert.Equal(t, spec.expLines, strings.Count(b.String(), "\n"))
+			assert.LessOrEqual(t, len(b.String()), spec.max)
+			assert.Equal(t, spec.expOmitted, b.omittedOps())
+			var gotOmittedBz int
+			for _, s := range b.summary() {
+				gotOmittedBz += s.OmittedBytes
+			}
+			assert.Equal(t, spec.expOmittedBz, gotOmittedBz)
+			exp := []StoreIOSummary{{Store: "bank", Ops: 2, Bytes: 11}, {Store: "wasm", Ops: 1, Bytes: 4}}
+			for i, s := range b.summary() {
+				assert.Equal(t, exp[i].Store, s.Store)
+				assert.Equal(t, exp[i].Ops, s.Ops)
+				assert.Equal(t, exp[i].Bytes, s.Bytes)
+			}
+		})
+	}
+}
+
+func TestTracingMultiStoreIOLimit(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	ctx, _, storeKey := createMinTestInput(t)
+	myMax := MaxStoreTraced
+	t.Cleanup(func() { MaxStoreTraced = myMax })
+	MaxStoreTraced = 200
+
+	// when
+	DoWithTracing(ctx, "my-op", StoreLogWritesOnly, func(workCtx sdk.Context, span opentracing.Span) error {
+		for i := 0; i < 100; i++ {
+			workCtx.KVStore(storeKey).Set([]byte{byte(i)}, []byte("value"))
+		}
+		return nil
+	})
+
+	// then
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 1)
+	idx := make(map[string]string)
+	for _, v := range spans[0].Logs() {
+		idx[v.Fields[0].Key] = v.Fields[0].ValueString
+	}
+	gotLines := strings.Split(strings.TrimSpace(idx[logRawStoreIO]), "\n")
+	for _, l := range gotLines {
+		assert.True(t, json.Valid([]byte(l)), l)
+	}
+	assert.Equal(t, fmt.Sprintf("%d more ops omitted", 100-len(gotLines)), idx[logRawStoreIOOmitted])
+	var gotSummary []StoreIOSummary
+	require.NoError(t, json.Unmarshal([]byte(idx[logStoreIOSummary]), &gotSummary))
+	require.Len(t, gotSummary, 1)
+	assert.Equal(t, storeKey.Name(), gotSummary[0].Store)
+	assert.Equal(t, 100, gotSummary[0].Ops)
+	assert.Equal(t, 100-len(gotLines), gotSummary[0].OmittedOps)
+}
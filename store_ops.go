@@ -0,0 +1,276 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	storetypes "github.com/cosmos/cosmos-sdk/store/types"
+)
+
+// Store operation types
+const (
+	StoreOpRead   = "read"
+	StoreOpWrite  = "write"
+	StoreOpDelete = "delete"
+	StoreOpIter   = "iter"
+)
+
+// StoreOperation is a single store operation captured in a span
+type StoreOperation struct {
+	Store string `json:"store"`
+	Op    string `json:"op"`
+	// Key hex encoded
+	Key      string `json:"key"`
+	ValueLen int    `json:"value_len"`
+	// Value hex encoded
+	Value string         `json:"value,omitempty"`
+	Gas   storetypes.Gas `json:"gas"`
+	// Branch is the id of the cache branch or 0 for the traced store
+	Branch int `json:"branch,omitempty"`
+	// Decoded is the human readable operation when a key decoder is registered for the store
+	Decoded string `json:"decoded,omitempty"`
+}
+
+// storeOpsLog enables the structured store operation log in addition to the raw store io. Disabled by default
+var storeOpsLog = false
+
+// storeOp is a captured store operation. The encoding and decoding is done when the span finishes
+type storeOp struct {
+	store   string
+	op      string
+	key     []byte
+	value   []byte
+	gas     storetypes.Gas
+	branch  int
+	decoder KeyDecoder
+	// noValue is set for operations without value, like has
+	noValue bool
+}
+
+// storeOpOverhead is the estimated JSON size of a store operation without store, key and value
+const storeOpOverhead = 64
+
+// storeOps collects the store operations of a traced store and its branches up to max bytes of the estimated JSON
+// size. Operations past the limit are counted only so that the memory stays bounded for heavy spans.
+type storeOps struct {
+	mx      sync.Mutex
+	ops     []storeOp
+	max     int
+	size    int
+	omitted int
+}
+
+// newStoreOps returns the operation log bounded by MaxStoreTraced or nil when not enabled
+func newStoreOps() *storeOps {
+	if !storeOpsLog {
+		return nil
+	}
+	return &storeOps{max: MaxStoreTraced}
+}
+
+// add the operation. Once an operation does not fit, all following are omitted to keep the order.
+func (s *storeOps) add(op storeOp) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	size := storeOpOverhead + len(op.store) + len(op.op) + 2*len(op.key) + 2*len(op.value)
+	if s.omitted != 0 || s.size+size > s.max {
+		s.omitted++
+		return
+	}
+	s.size += size
+	s.ops = append(s.ops, op)
+}
+
+// omittedOps returns the number of operations not captured
+func (s *storeOps) omittedOps() int {
+	if s == nil {
+		return 0
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.omitted
+}
+
+// all returns the encoded operations. The operations of stores with a key decoder are described with the previous
+// value of a write or delete taken from the operations on the same key before. It is unknown, nil, when the key was
+// not accessed before in the span. Nil when the operations are not logged.
+func (s *storeOps) all() []StoreOperation {
+	if s == nil {
+		return nil
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	r := make([]StoreOperation, len(s.ops))
+	last := make(map[string][]byte)
+	for i, op := range s.ops {
+		r[i] = StoreOperation{
+			Store:    op.store,
+			Op:       op.op,
+			Key:      hex.EncodeToString(op.key),
+			ValueLen: len(op.value),
+			Value:    hex.EncodeToString(op.value),
+			Gas:      op.gas,
+			Branch:   op.branch,
+		}
+		k := op.store + "/" + string(op.key)
+		if op.decoder != nil {
+			r[i].Decoded = describeStoreOp(op.decoder, op.store, op.op, op.key, last[k], op.value)
+		}
+		if !op.noValue {
+			last[k] = op.value
+		}
+	}
+	return r
+}
+
+// jsonArrayLimited returns the items as JSON array that fits into max bytes and the number of items dropped.
+// An empty string is returned when there are no items.
+func jsonArrayLimited[T any](items []T, max int) (string, int) {
+	if len(items) == 0 {
+		return "", 0
+	}
+	var sb strings.Builder
+	sb.WriteByte('[')
+	for i, item := range items {
+		bz, err := json.Marshal(item)
+		if err != nil {
+			panic(err) // can not happen with the simple types
+		}
+		if sb.Len()+len(bz)+2 > max {
+			sb.WriteByte(']')
+			return sb.String(), len(items) - i
+		}
+		if i != 0 {
+			sb.WriteByte(',')
+		}
+		sb.Write(bz)
+	}
+	sb.WriteByte(']')
+	return sb.String(), 0
+}
+
+var _ storetypes.KVStore = &opLogKVStore{}
+
+// opLogKVStore is a decorator to the gas metered store that records the operations with the gas charged
+type opLogKVStore struct {
+	storetypes.KVStore
+	// raw is the store without gas metering to read the old values for the net changes
+	raw        storetypes.KVStore
+	decoder    KeyDecoder
+	storeName  string
+	branch     int
+	writesOnly bool
+	gasMeter   storetypes.GasMeter
+	// ops is nil when the operations are not logged
+	ops *storeOps
+	// diff is nil when the net changes are not captured
+	diff *storeDiff
+}
+
+func (s *opLogKVStore) record(op string, key, value []byte, gasBefore storetypes.Gas) {
+	if s.ops == nil {
+		return
+	}
+	s.ops.add(storeOp{
+		store:   s.storeName,
+		op:      op,
+		key:     key,
+		value:   value,
+		gas:     s.gasMeter.GasConsumed() - gasBefore,
+		branch:  s.branch,
+		decoder: s.decoder,
+	})
+}
+
+// recordDiff records the write for the net changes. The old value is read from the store on the first write only.
+func (s *opLogKVStore) recordDiff(key, value []byte, deleted bool) {
+	if s.diff == nil {
+		return
+	}
+	s.diff.record(s.storeName, key, value, deleted, func() []byte { return s.raw.Get(key) })
+}
+
+func (s *opLogKVStore) Get(key []byte) []byte {
+	before := s.gasMeter.GasConsumed()
+	value := s.KVStore.Get(key)
+	if !s.writesOnly {
+		s.record(StoreOpRead, key, value, before)
+	}
+	return value
+}
+
+func (s *opLogKVStore) Has(key []byte) bool {
+	before := s.gasMeter.GasConsumed()
+	ok := s.KVStore.Has(key)
+	if !s.writesOnly && s.ops != nil {
+		s.ops.add(storeOp{
+			store:   s.storeName,
+			op:      StoreOpRead,
+			key:     key,
+			gas:     s.gasMeter.GasConsumed() - before,
+			branch:  s.branch,
+			decoder: s.decoder,
+			noValue: true,
+		})
+	}
+	return ok
+}
+
+func (s *opLogKVStore) Set(key, value []byte) {
+	s.recordDiff(key, value, false)
+	before := s.gasMeter.GasConsumed()
+	s.KVStore.Set(key, value)
+	s.record(StoreOpWrite, key, value, before)
+}
+
+func (s *opLogKVStore) Delete(key []byte) {
+	s.recordDiff(key, nil, true)
+	before := s.gasMeter.GasConsumed()
+	s.KVStore.Delete(key)
+	s.record(StoreOpDelete, key, nil, before)
+}
+
+func (s *opLogKVStore) Iterator(start, end []byte) storetypes.Iterator {
+	before := s.gasMeter.GasConsumed()
+	return s.newIterator(s.KVStore.Iterator(start, end), before)
+}
+
+func (s *opLogKVStore) ReverseIterator(start, end []byte) storetypes.Iterator {
+	before := s.gasMeter.GasConsumed()
+	return s.newIterator(s.KVStore.ReverseIterator(start, end), before)
+}
+
+func (s *opLogKVStore) newIterator(it storetypes.Iterator, gasBefore storetypes.Gas) storetypes.Iterator {
+	if s.writesOnly || s.ops == nil {
+		return it
+	}
+	return &opLogIterator{Iterator: it, store: s, gasBefore: gasBefore}
+}
+
+// opLogIterator records every entry that is iterated over, including the entry it is positioned at when closed.
+// The gas is charged since the previous entry.
+type opLogIterator struct {
+	storetypes.Iterator
+	store     *opLogKVStore
+	gasBefore storetypes.Gas
+}
+
+func (i *opLogIterator) Next() {
+	i.recordEntry()
+	i.Iterator.Next()
+}
+
+// Close records the current entry, like when the caller stops before the end, and closes the iterator
+func (i *opLogIterator) Close() error {
+	if i.Valid() {
+		i.recordEntry()
+	}
+	return i.Iterator.Close()
+}
+
+func (i *opLogIterator) recordEntry() {
+	i.store.record(StoreOpIter, i.Key(), i.Value(), i.gasBefore)
+	i.gasBefore = i.store.gasMeter.GasConsumed()
+}
@@ -0,0 +1,226 @@
+package tracing
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/store/gaskv"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracingMultiStoreBranches(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	ctx, _, storeKey := createMinTestInput(t)
+
+	// when
+	DoWithTracing(ctx, "my-op", StoreLogWritesOnly, func(workCtx sdk.Context, span opentracing.Span) error {
+		written, commit := workCtx.CacheContext()
+		written.KVStore(storeKey).Set([]byte("foo"), []byte("bar"))
+		discarded, _ := written.CacheContext()
+		discarded.KVStore(storeKey).Set([]byte("other"), []byte("value"))
+		commit()
+		return nil
+	})
+
+	// then
+	assert.Equal(t, []byte("bar"), ctx.KVStore(storeKey).Get([]byte("foo")))
+	assert.Nil(t, ctx.KVStore(storeKey).Get([]byte("other")))
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 1)
+	idx := make(map[string]string)
+	for _, v := range spans[0].Logs() {
+		idx[v.Fields[0].Key] = v.Fields[0].ValueString
+	}
+	var gotBranches []StoreBranch
+	require.NoError(t, json.Unmarshal([]byte(idx[logStoreBranches]), &gotBranches))
+	expBranches := []StoreBranch{{ID: 1, Status: StoreBranchWritten}, {ID: 2, Parent: 1, Status: StoreBranchDiscarded}}
+	assert.Equal(t, expBranches, gotBranches)
+
+	encoding := base64.StdEncoding
+	expIO := []string{
+		fmt.Sprintf(`{"operation":"write","key":"%s","value":"%s","metadata":{"branch":1}}`, encoding.EncodeToString([]byte("foo")), encoding.EncodeToString([]byte("bar"))),
+		fmt.Sprintf(`{"operation":"write","key":"%s","value":"%s","metadata":{"branch":2}}`, encoding.EncodeToString([]byte("other")), encoding.EncodeToString([]byte("value"))),
+	}
+	assert.Equal(t, expIO, strings.Split(strings.TrimSpace(idx[logRawStoreIO]), "\n"))
+}
+
+func TestTracingMultiStoreOps(t *testing.T) {
+	storeOpsLog = true
+	t.Cleanup(func() { storeOpsLog = false })
+	specs := map[string]struct {
+		writesOnly bool
+		expOps     []string
+	}{
+		"all": {
+			expOps: []string{StoreOpWrite, StoreOpRead, StoreOpRead, StoreOpIter, StoreOpIter, StoreOpDelete},
+		},
+		"writes only": {
+			writesOnly: true,
+			expOps:     []string{StoreOpWrite, StoreOpDelete},
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			ctx, _, storeKey := createMinTestInput(t)
+			ctx.KVStore(storeKey).Set([]byte("existing"), []byte("value"))
+			ms := NewTracingMultiStore(ctx.MultiStore(), spec.writesOnly)
+			store := ms.GetKVStore(storeKey)
+
+			// when
+			store.Set([]byte("foo"), []byte("bar"))
+			store.Get([]byte("foo"))
+			store.Has([]byte("other"))
+			it := store.Iterator(nil, nil)
+			for ; it.Valid(); it.Next() {
+			}
+			require.NoError(t, it.Close())
+			store.Delete([]byte("foo"))
+
+			// then
+			var gotOps []string
+			for _, op := range ms.ops.all() {
+				assert.Equal(t, storeKey.Name(), op.Store)
+				assert.NotZero(t, op.Gas)
+				gotOps = append(gotOps, op.Op)
+			}
+			assert.Equal(t, spec.expOps, gotOps)
+		})
+	}
+}
+
+func TestTracingMultiStoreOpsIteratorClosed(t *testing.T) {
+	storeOpsLog = true
+	t.Cleanup(func() { storeOpsLog = false })
+	ctx, _, storeKey := createMinTestInput(t)
+	ctx.KVStore(storeKey).Set([]byte("a"), []byte("1"))
+	ctx.KVStore(storeKey).Set([]byte("b"), []byte("2"))
+	ctx.KVStore(storeKey).Set([]byte("c"), []byte("3"))
+	ms := NewTracingMultiStore(ctx.MultiStore(), false)
+
+	// when stopped at the second entry
+	it := ms.GetKVStore(storeKey).Iterator(nil, nil)
+	it.Next()
+	require.True(t, it.Valid())
+	require.NoError(t, it.Close())
+
+	// then
+	var gotKeys []string
+	for _, op := range ms.ops.all() {
+		assert.Equal(t, StoreOpIter, op.Op)
+		gotKeys = append(gotKeys, op.Key)
+	}
+	assert.Equal(t, []string{hex.EncodeToString([]byte("a")), hex.EncodeToString([]byte("b"))}, gotKeys)
+}
+
+func TestTracingMultiStoreOpsDisabled(t *testing.T) {
+	ctx, _, storeKey := createMinTestInput(t)
+	ms := NewTracingMultiStore(ctx.MultiStore(), true)
+
+	// when
+	store := ms.GetKVStore(storeKey)
+
+	// then
+	require.IsType(t, &TraceWritesKVStore{}, store)
+	assert.IsType(t, &gaskv.Store{}, store.(*TraceWritesKVStore).parent)
+}
+
+func TestJSONArrayLimited(t *testing.T) {
+	ops := make([]StoreOperation, 3)
+	for i := range ops {
+		ops[i] = StoreOperation{Store: "bank", Op: StoreOpWrite, Key: "01", ValueLen: 1, Value: "02", Gas: 1}
+	}
+	all, dropped := jsonArrayLimited(ops, 1000)
+	assert.Equal(t, 0, dropped)
+	var got []StoreOperation
+	require.NoError(t, json.Unmarshal([]byte(all), &got))
+	assert.Equal(t, ops, got)
+
+	limited, dropped := jsonArrayLimited(ops, len(all)-1)
+	assert.Equal(t, 1, dropped)
+	require.NoError(t, json.Unmarshal([]byte(limited), &got))
+	assert.Len(t, got, 2)
+
+	empty, _ := jsonArrayLimited([]StoreOperation{}, 1000)
+	assert.Empty(t, empty)
+}
+
+func TestStoreCaptureBudget(t *testing.T) {
+	op := storeOp{store: "bank", op: StoreOpWrite, key: []byte{1}, value: []byte{2}}
+	ops := &storeOps{max: 2 * (storeOpOverhead + 4 + len(StoreOpWrite) + 4)}
+
+	// when
+	for i := 0; i < 3; i++ {
+		ops.add(op)
+	}
+	// then
+	assert.Len(t, ops.ops, 2)
+	assert.Equal(t, 1, ops.omittedOps())
+
+	diff := &storeDiff{changes: make(map[storeDiffKey]*storeDiffValue), max: storeDiffOverhead + 4 + 2}
+	noOld := func() []byte { return nil }
+	// when
+	diff.record("bank", []byte{1}, []byte{2}, false, noOld)
+	diff.record("bank", []byte{2}, []byte{2}, false, noOld)
+	diff.record("bank", []byte{1}, []byte{3}, false, noOld)
+	branch := &storeDiff{changes: make(map[storeDiffKey]*storeDiffValue), max: 1}
+	branch.record("bank", []byte{3}, []byte{2}, false, noOld)
+	diff.merge(branch)
+	// then
+	require.Len(t, diff.order, 1)
+	assert.Equal(t, []byte{3}, diff.changes[diff.order[0]].new)
+	assert.Equal(t, 2, diff.omittedWrites())
+}
+
+func TestTracingMultiStoreDiff(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	ctx, _, storeKey := createMinTestInput(t)
+	ctx.KVStore(storeKey).Set([]byte("existing"), []byte("value"))
+	ctx.KVStore(storeKey).Set([]byte("removed"), []byte("value"))
+
+	// when
+	DoWithTracing(ctx, "my-op", StoreLogDiff, func(workCtx sdk.Context, span opentracing.Span) error {
+		store := workCtx.KVStore(storeKey)
+		store.Set([]byte("existing"), []byte("v1"))
+		store.Set([]byte("existing"), []byte("v2"))
+		store.Get([]byte("existing"))
+		store.Set([]byte("temp"), []byte("v1"))
+		store.Delete([]byte("temp"))
+		store.Delete([]byte("removed"))
+		written, commit := workCtx.CacheContext()
+		written.KVStore(storeKey).Set([]byte("existing"), []byte("v3"))
+		written.KVStore(storeKey).Set([]byte("branched"), []byte("v1"))
+		commit()
+		discarded, _ := workCtx.CacheContext()
+		discarded.KVStore(storeKey).Set([]byte("discarded"), []byte("v1"))
+		return nil
+	})
+
+	// then
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 1)
+	idx := make(map[string]string)
+	for _, v := range spans[0].Logs() {
+		idx[v.Fields[0].Key] = v.Fields[0].ValueString
+	}
+	assert.NotContains(t, idx, logRawStoreIO)
+	assert.NotContains(t, idx, logStoreOps)
+	var got []StoreDiffEntry
+	require.NoError(t, json.Unmarshal([]byte(idx[logStoreDiff]), &got))
+	h := func(s string) string { return hex.EncodeToString([]byte(s)) }
+	exp := []StoreDiffEntry{
+		{Store: storeKey.Name(), Key: h("existing"), Old: h("value"), New: h("v3")},
+		{Store: storeKey.Name(), Key: h("removed"), Old: h("value"), Deleted: true},
+		{Store: storeKey.Name(), Key: h("branched"), New: h("v1")},
+	}
+	assert.Equal(t, exp, got)
+}
@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	storetypes "github.com/cosmos/cosmos-sdk/store/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// kvStoreWrapper wraps the KV stores of a multistore to record the operations, independent of the sampling and the
+// store capture of the spans
+type kvStoreWrapper interface {
+	wrap(store storetypes.KVStore, storeName string) storetypes.KVStore
+}
+
+// multiStoreDecorator is implemented by the multistore decorators of this package to find the decorated stores
+type multiStoreDecorator interface {
+	decorated() storetypes.MultiStore
+}
+
+// wrappingStore is implemented by the multistores that wrap their KV stores
+type wrappingStore interface {
+	storeWrapper() kvStoreWrapper
+}
+
+// withStoreWrapper returns the context with the multistore that wraps the KV stores of it and all cache branches.
+// The context is returned unchanged when the multistore or one that it decorates wraps with the same wrapper already.
+func withStoreWrapper(ctx sdk.Context, w kvStoreWrapper) sdk.Context {
+	if hasStoreWrapper(ctx.MultiStore(), w) {
+		return ctx
+	}
+	return ctx.WithMultiStore(&wrappingMultiStore{MultiStore: ctx.MultiStore(), wrapper: w})
+}
+
+// hasStoreWrapper returns true when the multistore or one that it decorates wraps with the wrapper
+func hasStoreWrapper(ms storetypes.MultiStore, w kvStoreWrapper) bool {
+	for ms != nil {
+		if s, ok := ms.(wrappingStore); ok && s.storeWrapper() == w {
+			return true
+		}
+		d, ok := ms.(multiStoreDecorator)
+		if !ok {
+			return false
+		}
+		ms = d.decorated()
+	}
+	return false
+}
+
+var _ storetypes.MultiStore = &wrappingMultiStore{}
+
+// wrappingMultiStore is a decorator to the multistore that wraps the KV stores of it and all cache branches
+type wrappingMultiStore struct {
+	storetypes.MultiStore
+	wrapper kvStoreWrapper
+}
+
+func (t *wrappingMultiStore) storeWrapper() kvStoreWrapper {
+	return t.wrapper
+}
+
+func (t *wrappingMultiStore) decorated() storetypes.MultiStore {
+	return t.MultiStore
+}
+
+func (t *wrappingMultiStore) GetStore(k storetypes.StoreKey) storetypes.Store {
+	return t.GetKVStore(k)
+}
+
+func (t *wrappingMultiStore) GetKVStore(k storetypes.StoreKey) storetypes.KVStore {
+	return t.wrapper.wrap(t.MultiStore.GetKVStore(k), k.Name())
+}
+
+func (t *wrappingMultiStore) CacheMultiStore() storetypes.CacheMultiStore {
+	return t.newBranch(t.MultiStore.CacheMultiStore())
+}
+
+func (t *wrappingMultiStore) CacheMultiStoreWithVersion(version int64) (storetypes.CacheMultiStore, error) {
+	cms, err := t.MultiStore.CacheMultiStoreWithVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	return t.newBranch(cms), nil
+}
+
+func (t *wrappingMultiStore) CacheWrap() storetypes.CacheWrap {
+	return t.CacheMultiStore()
+}
+
+func (t *wrappingMultiStore) newBranch(cms storetypes.CacheMultiStore) *wrappingCacheMultiStore {
+	return &wrappingCacheMultiStore{wrappingMultiStore: &wrappingMultiStore{MultiStore: cms, wrapper: t.wrapper}, cms: cms}
+}
+
+var _ storetypes.CacheMultiStore = &wrappingCacheMultiStore{}
+
+// wrappingCacheMultiStore is a cache branch that wraps its KV stores
+type wrappingCacheMultiStore struct {
+	*wrappingMultiStore
+	cms storetypes.CacheMultiStore
+}
+
+// Write writes the branch back to the parent store
+func (t *wrappingCacheMultiStore) Write() {
+	t.cms.Write()
+}
@@ -0,0 +1,430 @@
+package tracing
+
+import (
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+)
+
+const (
+	tagTailOmittedSpans = "tail_omitted_spans"
+	tagTailOmittedLogs  = "tail_omitted_logs"
+
+	// rough memory estimates of the buffered span data
+	tailSpanBaseSize  = 256
+	tailFieldBaseSize = 32
+)
+
+var _ opentracing.Tracer = &TailSamplingTracer{}
+
+// TailSamplingTracer is a decorator to another tracer that buffers all spans of a trace in memory and only
+// reports them when any span in the trace was errored or exceeded the min duration. Otherwise, the spans are dropped.
+//
+// A trace is decided when it has no open spans anymore and either contains a failure or the next trace root is started.
+// With a failure, later spans of the trace are reported directly. Spans that do not fit into the memory bound
+// are omitted but still count for the decision.
+type TailSamplingTracer struct {
+	other          opentracing.Tracer
+	minDuration    time.Duration
+	maxBufferBytes int
+
+	mx            sync.Mutex
+	bufferedBytes int
+	idle          []*tailTrace
+}
+
+// NewTailSamplingTracer constructor. A zero min duration disables the duration criteria.
+func NewTailSamplingTracer(other opentracing.Tracer, minDuration time.Duration, maxBufferBytes int) *TailSamplingTracer {
+	return &TailSamplingTracer{other: other, minDuration: minDuration, maxBufferBytes: maxBufferBytes}
+}
+
+type tailTrace struct {
+	spans        []*tailSpan
+	finished     []*tailSpan // buffered spans in finish order
+	open         int
+	keep         bool
+	decided      bool
+	idle         bool
+	omittedSpans int
+	omittedLogs  int
+	bytes        int
+}
+
+// StartSpan starts a buffered span. Spans with a parent from the other tracer are passed through.
+func (t *TailSamplingTracer) StartSpan(operationName string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	var sso opentracing.StartSpanOptions
+	for _, o := range opts {
+		o.Apply(&sso)
+	}
+	var parent *tailSpan
+	for _, ref := range sso.References {
+		if ref.ReferencedContext == nil {
+			continue
+		}
+		c, ok := ref.ReferencedContext.(tailSpanContext)
+		if !ok {
+			return t.other.StartSpan(operationName, opts...)
+		}
+		if parent == nil || ref.Type == opentracing.ChildOfRef {
+			parent = c.span
+		}
+	}
+
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	var trace *tailTrace
+	if parent != nil {
+		trace = parent.trace
+		if trace.decided && trace.keep {
+			return t.startReported(operationName, sso, parent)
+		}
+	} else {
+		// a new root: pending traces without failures are dropped
+		for _, idle := range t.idle {
+			t.decide(idle)
+		}
+		t.idle = nil
+		trace = &tailTrace{}
+	}
+	startTime := sso.StartTime
+	if startTime.IsZero() {
+		startTime = time.Now()
+	}
+	s := &tailSpan{
+		tracer:        t,
+		trace:         trace,
+		parent:        parent,
+		operationName: operationName,
+		startTime:     startTime,
+		tags:          make(opentracing.Tags, len(sso.Tags)),
+	}
+	trace.open++
+	trace.idle = false
+	if trace.decided || !t.reserve(trace, tailSpanBaseSize+len(operationName)) {
+		s.omitted = true
+		trace.omittedSpans++
+	} else {
+		trace.spans = append(trace.spans, s)
+	}
+	for k, v := range sso.Tags {
+		s.setTag(k, v)
+	}
+	return s
+}
+
+// startReported starts the span with the other tracer as child of the nearest reported ancestor
+func (t *TailSamplingTracer) startReported(operationName string, sso opentracing.StartSpanOptions, parent *tailSpan) opentracing.Span {
+	opts := []opentracing.StartSpanOption{opentracing.StartTime(sso.StartTime), opentracing.Tags(sso.Tags)}
+	if p := parent.replayedAncestor(); p != nil {
+		opts = append(opts, opentracing.ChildOf(p.real.Context()))
+	}
+	return t.other.StartSpan(operationName, opts...)
+}
+
+// Inject is not supported for buffered spans
+func (t *TailSamplingTracer) Inject(sm opentracing.SpanContext, format interface{}, carrier interface{}) error {
+	if _, ok := sm.(tailSpanContext); ok {
+		return opentracing.ErrUnsupportedFormat
+	}
+	return t.other.Inject(sm, format, carrier)
+}
+
+// Extract delegates to the other tracer
+func (t *TailSamplingTracer) Extract(format interface{}, carrier interface{}) (opentracing.SpanContext, error) {
+	return t.other.Extract(format, carrier)
+}
+
+// Flush decides on all pending traces. Traces without a failure are dropped.
+func (t *TailSamplingTracer) Flush() {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	for _, idle := range t.idle {
+		t.decide(idle)
+	}
+	t.idle = nil
+}
+
+// reserve memory for the trace. Returns false when the bound is exceeded
+func (t *TailSamplingTracer) reserve(trace *tailTrace, size int) bool {
+	if t.bufferedBytes+size > t.maxBufferBytes {
+		return false
+	}
+	t.bufferedBytes += size
+	trace.bytes += size
+	return true
+}
+
+// onFinish is called with lock acquired
+func (t *TailSamplingTracer) onFinish(s *tailSpan) {
+	trace := s.trace
+	trace.open--
+	if !s.omitted && s.real == nil {
+		trace.finished = append(trace.finished, s)
+	}
+	if t.minDuration != 0 && s.finishTime.Sub(s.startTime) >= t.minDuration {
+		trace.keep = true
+	}
+	if trace.open != 0 || trace.decided {
+		return
+	}
+	if trace.keep {
+		t.decide(trace)
+		return
+	}
+	if !trace.idle {
+		trace.idle = true
+		t.idle = append(t.idle, trace)
+	}
+}
+
+// decide reports the buffered spans of kept traces and releases the memory. Called with lock acquired
+func (t *TailSamplingTracer) decide(trace *tailTrace) {
+	if trace.decided {
+		return
+	}
+	trace.decided = true
+	t.bufferedBytes -= trace.bytes
+	trace.bytes = 0
+	if !trace.keep {
+		trace.spans, trace.finished = nil, nil
+		return
+	}
+	for _, s := range trace.spans {
+		opts := []opentracing.StartSpanOption{opentracing.StartTime(s.startTime), s.tags}
+		if p := s.parent.replayedAncestor(); p != nil {
+			opts = append(opts, opentracing.ChildOf(p.real.Context()))
+		}
+		s.real = t.other.StartSpan(s.operationName, opts...)
+		s.tags = nil
+	}
+	if len(trace.spans) != 0 {
+		if trace.omittedSpans != 0 {
+			trace.spans[0].real.SetTag(tagTailOmittedSpans, trace.omittedSpans)
+		}
+		if trace.omittedLogs != 0 {
+			trace.spans[0].real.SetTag(tagTailOmittedLogs, trace.omittedLogs)
+		}
+	}
+	for _, s := range trace.finished {
+		s.real.FinishWithOptions(opentracing.FinishOptions{FinishTime: s.finishTime, LogRecords: s.logs})
+		s.logs = nil
+	}
+	trace.spans, trace.finished = nil, nil
+}
+
+var _ opentracing.Span = &tailSpan{}
+
+// tailSpan buffered span data. All methods are forwarded to the real span once replayed
+type tailSpan struct {
+	tracer        *TailSamplingTracer
+	trace         *tailTrace
+	parent        *tailSpan
+	operationName string
+	startTime     time.Time
+	finishTime    time.Time
+	tags          opentracing.Tags
+	logs          []opentracing.LogRecord
+	baggage       map[string]string
+	omitted       bool
+	finished      bool
+	real          opentracing.Span
+}
+
+// replayedAncestor returns the span or the nearest ancestor that was reported to the other tracer
+func (s *tailSpan) replayedAncestor() *tailSpan {
+	for p := s; p != nil; p = p.parent {
+		if p.real != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+func (s *tailSpan) Finish() {
+	s.FinishWithOptions(opentracing.FinishOptions{})
+}
+
+func (s *tailSpan) FinishWithOptions(opts opentracing.FinishOptions) {
+	s.tracer.mx.Lock()
+	defer s.tracer.mx.Unlock()
+	if s.finished {
+		return
+	}
+	s.finished = true
+	s.finishTime = opts.FinishTime
+	if s.finishTime.IsZero() {
+		s.finishTime = time.Now()
+	}
+	if s.real != nil {
+		opts.LogRecords = append(s.logs, opts.LogRecords...)
+		s.logs = nil
+		s.real.FinishWithOptions(opts)
+	} else {
+		for _, r := range opts.LogRecords {
+			s.log(r)
+		}
+	}
+	s.tracer.onFinish(s)
+}
+
+func (s *tailSpan) Context() opentracing.SpanContext {
+	return tailSpanContext{span: s}
+}
+
+func (s *tailSpan) SetOperationName(operationName string) opentracing.Span {
+	s.tracer.mx.Lock()
+	defer s.tracer.mx.Unlock()
+	if s.real != nil {
+		s.real.SetOperationName(operationName)
+	}
+	s.operationName = operationName
+	return s
+}
+
+func (s *tailSpan) SetTag(key string, value interface{}) opentracing.Span {
+	s.tracer.mx.Lock()
+	defer s.tracer.mx.Unlock()
+	s.setTag(key, value)
+	return s
+}
+
+// setTag is called with lock acquired
+func (s *tailSpan) setTag(key string, value interface{}) {
+	if isFailureTag(key, value) {
+		s.trace.keep = true
+	}
+	switch {
+	case s.real != nil:
+		s.real.SetTag(key, value)
+	case !s.omitted && s.tracer.reserve(s.trace, tailFieldBaseSize+len(key)+sizeOf(value)):
+		s.tags[key] = value
+	}
+}
+
+func isFailureTag(key string, value interface{}) bool {
+	switch key {
+	case tagErrored, tagPanic:
+		return value == "true"
+	case string(ext.Error):
+		v, ok := value.(bool)
+		return ok && v
+	}
+	return false
+}
+
+func (s *tailSpan) LogFields(fields ...otlog.Field) {
+	s.tracer.mx.Lock()
+	defer s.tracer.mx.Unlock()
+	s.log(opentracing.LogRecord{Timestamp: time.Now(), Fields: fields})
+}
+
+// log is called with lock acquired. Logs are kept until finish to preserve the timestamps
+func (s *tailSpan) log(r opentracing.LogRecord) {
+	if s.omitted {
+		return
+	}
+	if s.real != nil {
+		s.logs = append(s.logs, r)
+		return
+	}
+	size := tailFieldBaseSize
+	for _, f := range r.Fields {
+		size += tailFieldBaseSize + len(f.Key()) + sizeOf(f.Value())
+	}
+	if !s.tracer.reserve(s.trace, size) {
+		s.trace.omittedLogs++
+		return
+	}
+	s.logs = append(s.logs, r)
+}
+
+func (s *tailSpan) LogKV(alternatingKeyValues ...interface{}) {
+	fields, err := otlog.InterleavedKVToFields(alternatingKeyValues...)
+	if err != nil {
+		s.LogFields(otlog.Error(err), otlog.String("function", "LogKV"))
+		return
+	}
+	s.LogFields(fields...)
+}
+
+func (s *tailSpan) SetBaggageItem(restrictedKey, value string) opentracing.Span {
+	s.tracer.mx.Lock()
+	defer s.tracer.mx.Unlock()
+	if s.baggage == nil {
+		s.baggage = make(map[string]string)
+	}
+	s.baggage[restrictedKey] = value
+	return s
+}
+
+func (s *tailSpan) BaggageItem(restrictedKey string) string {
+	s.tracer.mx.Lock()
+	defer s.tracer.mx.Unlock()
+	for p := s; p != nil; p = p.parent {
+		if v, ok := p.baggage[restrictedKey]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+func (s *tailSpan) Tracer() opentracing.Tracer {
+	return s.tracer
+}
+
+// Deprecated: use LogFields or LogKV
+func (s *tailSpan) LogEvent(event string) {
+	s.LogFields(otlog.String("event", event))
+}
+
+// Deprecated: use LogFields or LogKV
+func (s *tailSpan) LogEventWithPayload(event string, payload interface{}) {
+	s.LogFields(otlog.String("event", event), otlog.Object("payload", payload))
+}
+
+// Deprecated: use LogFields or LogKV
+func (s *tailSpan) Log(data opentracing.LogData) {
+	s.LogFields(data.ToLogRecord().Fields...)
+}
+
+var _ opentracing.SpanContext = tailSpanContext{}
+
+type tailSpanContext struct {
+	span *tailSpan
+}
+
+func (c tailSpanContext) ForeachBaggageItem(handler func(k, v string) bool) {
+	c.span.tracer.mx.Lock()
+	items := make(map[string]string)
+	for p := c.span; p != nil; p = p.parent {
+		for k, v := range p.baggage {
+			if _, exists := items[k]; !exists {
+				items[k] = v
+			}
+		}
+	}
+	c.span.tracer.mx.Unlock()
+	for k, v := range items {
+		if !handler(k, v) {
+			return
+		}
+	}
+}
+
+func sizeOf(v interface{}) int {
+	switch x := v.(type) {
+	case string:
+		return len(x)
+	case []string:
+		var n int
+		for _, s := range x {
+			n += len(s)
+		}
+		return n
+	default:
+		return 8
+	}
+}
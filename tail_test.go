@@ -0,0 +1,151 @@
+package tracing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTailSamplingTracer(t *testing.T) {
+	startTime := time.Date(2020, time.April, 22, 12, 0, 0, 0, time.UTC)
+	specs := map[string]struct {
+		minDuration    time.Duration
+		maxBufferBytes int
+		exec           func(t *testing.T, tracer opentracing.Tracer)
+		expSpans       []string
+		expTags        map[string]interface{}
+	}{
+		"succeeded trace dropped": {
+			exec: func(t *testing.T, tracer opentracing.Tracer) {
+				root := tracer.StartSpan("root")
+				tracer.StartSpan("inner", opentracing.ChildOf(root.Context())).Finish()
+				root.Finish()
+			},
+		},
+		"errored trace reported": {
+			exec: func(t *testing.T, tracer opentracing.Tracer) {
+				root := tracer.StartSpan("root", opentracing.StartTime(startTime))
+				inner := tracer.StartSpan("inner", opentracing.ChildOf(root.Context()))
+				inner.SetTag(tagErrored, "true")
+				inner.Finish()
+				root.Finish()
+			},
+			expSpans: []string{"inner", "root"},
+		},
+		"panicked trace reported": {
+			exec: func(t *testing.T, tracer opentracing.Tracer) {
+				root := tracer.StartSpan("root", opentracing.StartTime(startTime))
+				root.SetTag(tagPanic, "true")
+				root.Finish()
+			},
+			expSpans: []string{"root"},
+		},
+		"slow trace reported": {
+			minDuration: time.Second,
+			exec: func(t *testing.T, tracer opentracing.Tracer) {
+				root := tracer.StartSpan("root", opentracing.StartTime(startTime))
+				root.FinishWithOptions(opentracing.FinishOptions{FinishTime: startTime.Add(time.Second)})
+			},
+			expSpans: []string{"root"},
+		},
+		"child errored after root finished": {
+			exec: func(t *testing.T, tracer opentracing.Tracer) {
+				root := tracer.StartSpan("root")
+				root.Finish()
+				inner := tracer.StartSpan("inner", opentracing.ChildOf(root.Context()))
+				inner.SetTag(tagErrored, "true")
+				inner.Finish()
+			},
+			expSpans: []string{"root", "inner"},
+		},
+		"idle trace dropped on next root": {
+			exec: func(t *testing.T, tracer opentracing.Tracer) {
+				root := tracer.StartSpan("root")
+				root.Finish()
+				tracer.StartSpan("other").Finish()
+				inner := tracer.StartSpan("inner", opentracing.ChildOf(root.Context()))
+				inner.SetTag(tagErrored, "true")
+				inner.Finish()
+			},
+		},
+		"spans after decision reported directly": {
+			exec: func(t *testing.T, tracer opentracing.Tracer) {
+				root := tracer.StartSpan("root")
+				inner := tracer.StartSpan("inner", opentracing.ChildOf(root.Context()))
+				inner.SetTag(tagErrored, "true")
+				inner.Finish()
+				root.Finish()
+				tracer.StartSpan("late", opentracing.ChildOf(root.Context())).Finish()
+			},
+			expSpans: []string{"inner", "root", "late"},
+		},
+		"memory bound exceeded": {
+			maxBufferBytes: tailSpanBaseSize + 10,
+			exec: func(t *testing.T, tracer opentracing.Tracer) {
+				root := tracer.StartSpan("root")
+				inner := tracer.StartSpan("inner", opentracing.ChildOf(root.Context()))
+				inner.SetTag(tagErrored, "true")
+				inner.Finish()
+				root.LogFields(otlog.String("foo", "bar"))
+				root.Finish()
+			},
+			expSpans: []string{"root"},
+			expTags:  map[string]interface{}{tagTailOmittedSpans: 1, tagTailOmittedLogs: 1},
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			mock := mocktracer.New()
+			maxBufferBytes := spec.maxBufferBytes
+			if maxBufferBytes == 0 {
+				maxBufferBytes = DefaultTracerConfig().TailMaxBufferBytes
+			}
+			tracer := NewTailSamplingTracer(mock, spec.minDuration, maxBufferBytes)
+			// when
+			spec.exec(t, tracer)
+			tracer.Flush()
+			// then
+			var gotSpans []string
+			for _, s := range mock.FinishedSpans() {
+				gotSpans = append(gotSpans, s.OperationName)
+			}
+			assert.Equal(t, spec.expSpans, gotSpans)
+			for k, v := range spec.expTags {
+				assert.Equal(t, v, mock.FinishedSpans()[0].Tag(k), k)
+			}
+			assert.Equal(t, 0, tracer.bufferedBytes)
+		})
+	}
+}
+
+func TestTailSamplingTracerReplay(t *testing.T) {
+	startTime := time.Date(2020, time.April, 22, 12, 0, 0, 0, time.UTC)
+	mock := mocktracer.New()
+	tracer := NewTailSamplingTracer(mock, 0, DefaultTracerConfig().TailMaxBufferBytes)
+
+	root := tracer.StartSpan("root", opentracing.StartTime(startTime), opentracing.Tag{Key: "foo", Value: "bar"})
+	inner := tracer.StartSpan("inner", opentracing.ChildOf(root.Context()), opentracing.StartTime(startTime.Add(time.Millisecond)))
+	inner.LogFields(otlog.String("my-log", "value"))
+	inner.SetTag(tagErrored, "true")
+	inner.FinishWithOptions(opentracing.FinishOptions{FinishTime: startTime.Add(2 * time.Millisecond)})
+	root.FinishWithOptions(opentracing.FinishOptions{FinishTime: startTime.Add(3 * time.Millisecond)})
+
+	spans := mock.FinishedSpans()
+	require.Len(t, spans, 2)
+	gotInner, gotRoot := spans[0], spans[1]
+	assert.Equal(t, gotRoot.SpanContext.SpanID, gotInner.ParentID)
+	assert.Equal(t, gotRoot.SpanContext.TraceID, gotInner.SpanContext.TraceID)
+	assert.Equal(t, startTime, gotRoot.StartTime)
+	assert.Equal(t, startTime.Add(3*time.Millisecond), gotRoot.FinishTime)
+	assert.Equal(t, "bar", gotRoot.Tag("foo"))
+	assert.Equal(t, startTime.Add(time.Millisecond), gotInner.StartTime)
+	assert.Equal(t, "true", gotInner.Tag(tagErrored))
+	require.Len(t, gotInner.Logs(), 1)
+	assert.Equal(t, "my-log", gotInner.Logs()[0].Fields[0].Key)
+	assert.Equal(t, "value", gotInner.Logs()[0].Fields[0].ValueString)
+}
@@ -0,0 +1,476 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	dbm "github.com/cometbft/cometbft-db"
+	"github.com/gorilla/mux"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// key prefixes of the trace store
+var (
+	spanPrefix          = []byte{0x01}
+	heightIndexPrefix   = []byte{0x02}
+	txIndexPrefix       = []byte{0x03}
+	contractIndexPrefix = []byte{0x04}
+	senderIndexPrefix   = []byte{0x05}
+	erroredIndexPrefix  = []byte{0x06}
+)
+
+const (
+	traceStoreDBName      = "traces"
+	defaultTraceListLimit = 10
+	maxTraceListLimit     = 100
+)
+
+// activeTraceStore is served by the REST endpoints. Nil when not enabled
+var activeTraceStore atomic.Pointer[TraceStore]
+
+var _ sdktrace.SpanExporter = &TraceStore{}
+
+// TraceStore is an embedded span store that indexes the traces by height, tx hash, contract, sender and errored flag.
+//
+// Keys:
+//
+//	0x01 | trace id | span id -> span record json
+//	0x02 | height | trace id
+//	0x03 | tx hash | 0x00 | trace id
+//	0x04 | contract | 0x00 | height | trace id
+//	0x05 | sender | 0x00 | height | trace id
+//	0x06 | height | trace id
+//
+// Traces of heights older than the retained blocks are pruned when newer spans are added.
+type TraceStore struct {
+	db dbm.DB
+	// retainBlocks is the number of recent heights kept. All are kept when 0
+	retainBlocks uint64
+	pruneMx      sync.Mutex
+	// prunedHeight is the height that all older traces are pruned below
+	prunedHeight uint64
+}
+
+// NewTraceStore constructor. Traces older than the retained blocks are pruned, nothing is pruned when 0.
+func NewTraceStore(db dbm.DB, retainBlocks uint64) *TraceStore {
+	return &TraceStore{db: db, retainBlocks: retainBlocks}
+}
+
+// OpenTraceStore opens or creates the leveldb trace store in the dir
+func OpenTraceStore(dir string, retainBlocks uint64) (*TraceStore, error) {
+	if dir == "" {
+		return nil, errors.New("trace store dir must not be empty")
+	}
+	db, err := dbm.NewGoLevelDB(traceStoreDBName, dir)
+	if err != nil {
+		return nil, err
+	}
+	return NewTraceStore(db, retainBlocks), nil
+}
+
+// ExportSpans stores and indexes the spans
+func (t *TraceStore) ExportSpans(_ context.Context, spans []sdktrace.ReadOnlySpan) error {
+	records := make([]SpanRecord, len(spans))
+	for i, s := range spans {
+		records[i] = toSpanRecord(s)
+	}
+	return t.AddSpans(records...)
+}
+
+// AddSpans stores and indexes the span records. Traces older than the retained blocks are pruned afterwards.
+func (t *TraceStore) AddSpans(records ...SpanRecord) error {
+	batch := t.db.NewBatch()
+	defer batch.Close()
+	var maxHeight uint64
+	for _, r := range records {
+		if err := t.addSpan(batch, r); err != nil {
+			return err
+		}
+		if h := heightOf(r); h > maxHeight {
+			maxHeight = h
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	return t.prune(maxHeight)
+}
+
+func (t *TraceStore) addSpan(batch dbm.Batch, r SpanRecord) error {
+	bz, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := batch.Set(concat(spanPrefix, []byte(r.TraceID), []byte("/"), []byte(r.SpanID)), bz); err != nil {
+		return err
+	}
+	for _, k := range indexKeys(r) {
+		if err := batch.Set(k, []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexKeys returns the index keys of the span record
+func indexKeys(r SpanRecord) [][]byte {
+	traceID := []byte(r.TraceID)
+	height := heightOf(r)
+	var keys [][]byte
+	if height != 0 {
+		keys = append(keys, concat(heightIndexPrefix, uint64Key(height), traceID))
+	}
+	for _, v := range tagValues(r.Tags[tagTXHash]) {
+		keys = append(keys, concat(txIndexPrefix, []byte(strings.ToUpper(v)), []byte{0}, traceID))
+	}
+	for _, tag := range []string{tagContract, tagSenderContract} {
+		for _, v := range tagValues(r.Tags[tag]) {
+			keys = append(keys, concat(contractIndexPrefix, []byte(v), []byte{0}, uint64Key(height), traceID))
+		}
+	}
+	for _, v := range tagValues(r.Tags[tagSender]) {
+		keys = append(keys, concat(senderIndexPrefix, []byte(v), []byte{0}, uint64Key(height), traceID))
+	}
+	if v, ok := r.Tags[tagErrored]; ok && v == "true" {
+		keys = append(keys, concat(erroredIndexPrefix, uint64Key(height), traceID))
+	}
+	return keys
+}
+
+// prune deletes the spans and index entries of the traces with heights older than the retained blocks from the
+// height. Traces without height are not pruned.
+func (t *TraceStore) prune(height uint64) error {
+	if t.retainBlocks == 0 || height <= t.retainBlocks {
+		return nil
+	}
+	t.pruneMx.Lock()
+	defer t.pruneMx.Unlock()
+	below := height - t.retainBlocks + 1
+	if below <= t.prunedHeight {
+		return nil
+	}
+	start, end := concat(heightIndexPrefix, uint64Key(t.prunedHeight)), concat(heightIndexPrefix, uint64Key(below))
+	ids, err := t.traceIDsInRange(start, end)
+	if err != nil {
+		return err
+	}
+	batch := t.db.NewBatch()
+	defer batch.Close()
+	for _, id := range ids {
+		if err := t.deleteTrace(batch, id); err != nil {
+			return err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	t.prunedHeight = below
+	return nil
+}
+
+// traceIDsInRange returns the unique trace ids of the index keys in the range
+func (t *TraceStore) traceIDsInRange(start, end []byte) ([]string, error) {
+	it, err := t.db.Iterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	var r []string
+	seen := make(map[string]struct{})
+	for ; it.Valid(); it.Next() {
+		key := it.Key()
+		if len(key) < traceIDHexLen {
+			continue
+		}
+		id := string(key[len(key)-traceIDHexLen:])
+		if _, exists := seen[id]; !exists {
+			seen[id] = struct{}{}
+			r = append(r, id)
+		}
+	}
+	return r, it.Error()
+}
+
+// deleteTrace adds the deletes of the spans and index entries of the trace to the batch
+func (t *TraceStore) deleteTrace(batch dbm.Batch, traceID string) error {
+	it, err := dbm.IteratePrefix(t.db, concat(spanPrefix, []byte(traceID), []byte("/")))
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		var r SpanRecord
+		if err := json.Unmarshal(it.Value(), &r); err != nil {
+			return err
+		}
+		keys := append(indexKeys(r), it.Key())
+		for _, k := range keys {
+			if err := batch.Delete(k); err != nil {
+				return err
+			}
+		}
+	}
+	return it.Error()
+}
+
+// Shutdown closes the db
+func (t *TraceStore) Shutdown(context.Context) error {
+	return t.db.Close()
+}
+
+// Trace returns the span tree of the trace. Nil when not found
+func (t *TraceStore) Trace(traceID string) ([]*SpanNode, error) {
+	prefix := concat(spanPrefix, []byte(traceID), []byte("/"))
+	it, err := dbm.IteratePrefix(t.db, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	var records []SpanRecord
+	for ; it.Valid(); it.Next() {
+		var r SpanRecord
+		if err := json.Unmarshal(it.Value(), &r); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	if len(records) == 0 {
+		return nil, it.Error()
+	}
+	return BuildSpanTree(records), it.Error()
+}
+
+// TracesByTx returns the trace ids for the tx hash
+func (t *TraceStore) TracesByTx(hash string) ([]string, error) {
+	return t.traceIDs(concat(txIndexPrefix, []byte(strings.ToUpper(hash)), []byte{0}), maxTraceListLimit)
+}
+
+// TracesByHeight returns the trace ids of the block height
+func (t *TraceStore) TracesByHeight(height uint64, limit int) ([]string, error) {
+	return t.traceIDs(concat(heightIndexPrefix, uint64Key(height)), limit)
+}
+
+// TracesByContract returns the latest trace ids with the contract address
+func (t *TraceStore) TracesByContract(addr string, limit int) ([]string, error) {
+	return t.traceIDs(concat(contractIndexPrefix, []byte(addr), []byte{0}), limit)
+}
+
+// TracesBySender returns the latest trace ids with the sender address
+func (t *TraceStore) TracesBySender(addr string, limit int) ([]string, error) {
+	return t.traceIDs(concat(senderIndexPrefix, []byte(addr), []byte{0}), limit)
+}
+
+// ErroredTraces returns the latest trace ids with an errored span
+func (t *TraceStore) ErroredTraces(limit int) ([]string, error) {
+	return t.traceIDs(erroredIndexPrefix, limit)
+}
+
+// traceIDs returns the unique trace ids from the index keys with the trace id suffix in reverse order
+func (t *TraceStore) traceIDs(prefix []byte, limit int) ([]string, error) {
+	it, err := t.db.ReverseIterator(prefix, prefixEnd(prefix))
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	var r []string
+	seen := make(map[string]struct{})
+	for ; it.Valid() && len(r) < limit; it.Next() {
+		key := it.Key()
+		if len(key) < traceIDHexLen {
+			continue
+		}
+		id := string(key[len(key)-traceIDHexLen:])
+		if _, exists := seen[id]; exists {
+			continue
+		}
+		seen[id] = struct{}{}
+		r = append(r, id)
+	}
+	return r, it.Error()
+}
+
+// length of the hex encoded trace id
+const traceIDHexLen = 32
+
+// SpanNode is a span with its child spans
+type SpanNode struct {
+	SpanRecord
+	Children []*SpanNode `json:"children,omitempty"`
+}
+
+// BuildSpanTree returns the root spans with children ordered by start time
+func BuildSpanTree(records []SpanRecord) []*SpanNode {
+	nodes := make(map[string]*SpanNode, len(records))
+	for _, r := range records {
+		nodes[r.SpanID] = &SpanNode{SpanRecord: r}
+	}
+	var roots []*SpanNode
+	for _, r := range records {
+		n := nodes[r.SpanID]
+		if p, ok := nodes[r.ParentID]; ok && r.ParentID != r.SpanID {
+			p.Children = append(p.Children, n)
+			continue
+		}
+		roots = append(roots, n)
+	}
+	for _, n := range nodes {
+		sortByStart(n.Children)
+	}
+	sortByStart(roots)
+	return roots
+}
+
+func sortByStart(nodes []*SpanNode) {
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].Start.Before(nodes[j].Start) })
+}
+
+func heightOf(r SpanRecord) uint64 {
+	switch v := r.Tags[tagBlockHeight].(type) {
+	case int64:
+		if v > 0 {
+			return uint64(v)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil && i > 0 {
+			return uint64(i)
+		}
+	case float64:
+		if v > 0 {
+			return uint64(v)
+		}
+	}
+	return 0
+}
+
+// tagValues returns the tag values. String slices are exported in the `[a b]` format.
+func tagValues(v any) []string {
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return nil
+	}
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		return strings.Fields(s[1 : len(s)-1])
+	}
+	return []string{s}
+}
+
+func uint64Key(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
+
+func concat(parts ...[]byte) []byte {
+	var r []byte
+	for _, p := range parts {
+		r = append(r, p...)
+	}
+	return r
+}
+
+// prefixEnd returns the exclusive end key for a prefix scan
+func prefixEnd(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// RegisterTraceStoreRoutes registers the REST endpoints of the embedded trace store, for example to the app's API router
+func RegisterTraceStoreRoutes(r *mux.Router) {
+	sr := r.PathPrefix("/cosmos-tracing/v1").Subrouter()
+	sr.HandleFunc("/trace/{id}", traceStoreHandler(func(s *TraceStore, r *http.Request, _ int) ([]string, error) {
+		return []string{mux.Vars(r)["id"]}, nil
+	})).Methods(http.MethodGet)
+	sr.HandleFunc("/tx/{hash}", traceStoreHandler(func(s *TraceStore, r *http.Request, _ int) ([]string, error) {
+		return s.TracesByTx(mux.Vars(r)["hash"])
+	})).Methods(http.MethodGet)
+	sr.HandleFunc("/height/{height}", traceStoreHandler(func(s *TraceStore, r *http.Request, limit int) ([]string, error) {
+		height, err := strconv.ParseUint(mux.Vars(r)["height"], 10, 64)
+		if err != nil {
+			return nil, errInvalidRequest{err}
+		}
+		return s.TracesByHeight(height, limit)
+	})).Methods(http.MethodGet)
+	sr.HandleFunc("/contract/{address}", traceStoreHandler(func(s *TraceStore, r *http.Request, limit int) ([]string, error) {
+		return s.TracesByContract(mux.Vars(r)["address"], limit)
+	})).Methods(http.MethodGet)
+	sr.HandleFunc("/sender/{address}", traceStoreHandler(func(s *TraceStore, r *http.Request, limit int) ([]string, error) {
+		return s.TracesBySender(mux.Vars(r)["address"], limit)
+	})).Methods(http.MethodGet)
+	sr.HandleFunc("/errored", traceStoreHandler(func(s *TraceStore, r *http.Request, limit int) ([]string, error) {
+		return s.ErroredTraces(limit)
+	})).Methods(http.MethodGet)
+}
+
+type errInvalidRequest struct{ error }
+
+// traceStoreHandler responds with the span trees of the trace ids returned by the query
+func traceStoreHandler(query func(s *TraceStore, r *http.Request, limit int) ([]string, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := activeTraceStore.Load()
+		if store == nil {
+			writeJSONError(w, http.StatusNotFound, errors.New("trace store not enabled"))
+			return
+		}
+		limit := defaultTraceListLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			l, err := strconv.Atoi(v)
+			if err != nil || l <= 0 || l > maxTraceListLimit {
+				writeJSONError(w, http.StatusBadRequest, errors.New("invalid limit"))
+				return
+			}
+			limit = l
+		}
+		ids, err := query(store, r, limit)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.As(err, &errInvalidRequest{}) {
+				status = http.StatusBadRequest
+			}
+			writeJSONError(w, status, err)
+			return
+		}
+		type trace struct {
+			TraceID string      `json:"trace_id"`
+			Spans   []*SpanNode `json:"spans"`
+		}
+		result := make([]trace, 0, len(ids))
+		for _, id := range ids {
+			spans, err := store.Trace(id)
+			if err != nil {
+				writeJSONError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if spans != nil {
+				result = append(result, trace{TraceID: id, Spans: spans})
+			}
+		}
+		if len(result) == 0 {
+			writeJSONError(w, http.StatusNotFound, errors.New("not found"))
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, obj any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(obj)
+}
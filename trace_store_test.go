@@ -0,0 +1,183 @@
+package tracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dbm "github.com/cometbft/cometbft-db"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceStoreRoutes(t *testing.T) {
+	const (
+		trace1 = "0102030405060708090a0b0c0d0e0f10"
+		trace2 = "1102030405060708090a0b0c0d0e0f10"
+	)
+	startTime := time.Date(2020, time.April, 22, 12, 0, 0, 0, time.UTC)
+	store := NewTraceStore(dbm.NewMemDB(), 0)
+	require.NoError(t, store.AddSpans(
+		SpanRecord{TraceID: trace1, SpanID: "0000000000000002", ParentID: "0000000000000001", Operation: "new_msg_router", Start: startTime.Add(time.Millisecond),
+			Tags: map[string]any{tagBlockHeight: int64(2), tagSender: "[wasm1sender wasm1other]", tagErrored: "true"}},
+		SpanRecord{TraceID: trace1, SpanID: "0000000000000001", Operation: "ante_handler", Start: startTime,
+			Tags: map[string]any{tagBlockHeight: int64(2), tagTXHash: "ABCDEF"}},
+		SpanRecord{TraceID: trace2, SpanID: "0000000000000003", Operation: "wasmvm_execute", Start: startTime,
+			Tags: map[string]any{tagBlockHeight: int64(3), tagContract: "wasm1contract"}},
+	))
+	activeTraceStore.Store(store)
+	t.Cleanup(func() { activeTraceStore.Store(nil) })
+	router := mux.NewRouter()
+	RegisterTraceStoreRoutes(router)
+
+	specs := map[string]struct {
+		path      string
+		expStatus int
+		expTraces []string
+	}{
+		"by tx hash": {
+			path:      "/cosmos-tracing/v1/tx/abcdef",
+			expStatus: http.StatusOK,
+			expTraces: []string{trace1},
+		},
+		"by trace id": {
+			path:      "/cosmos-tracing/v1/trace/" + trace2,
+			expStatus: http.StatusOK,
+			expTraces: []string{trace2},
+		},
+		"by height": {
+			path:      "/cosmos-tracing/v1/height/3",
+			expStatus: http.StatusOK,
+			expTraces: []string{trace2},
+		},
+		"by contract": {
+			path:      "/cosmos-tracing/v1/contract/wasm1contract",
+			expStatus: http.StatusOK,
+			expTraces: []string{trace2},
+		},
+		"by sender": {
+			path:      "/cosmos-tracing/v1/sender/wasm1other",
+			expStatus: http.StatusOK,
+			expTraces: []string{trace1},
+		},
+		"errored": {
+			path:      "/cosmos-tracing/v1/errored",
+			expStatus: http.StatusOK,
+			expTraces: []string{trace1},
+		},
+		"unknown tx": {
+			path:      "/cosmos-tracing/v1/tx/012345",
+			expStatus: http.StatusNotFound,
+		},
+		"invalid height": {
+			path:      "/cosmos-tracing/v1/height/foo",
+			expStatus: http.StatusBadRequest,
+		},
+		"by height with limit": {
+			path:      "/cosmos-tracing/v1/height/2?limit=1",
+			expStatus: http.StatusOK,
+			expTraces: []string{trace1},
+		},
+		"invalid limit": {
+			path:      "/cosmos-tracing/v1/errored?limit=0",
+			expStatus: http.StatusBadRequest,
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, spec.path, nil))
+			require.Equal(t, spec.expStatus, rec.Code, rec.Body.String())
+			if spec.expStatus != http.StatusOK {
+				return
+			}
+			var got []struct {
+				TraceID string      `json:"trace_id"`
+				Spans   []*SpanNode `json:"spans"`
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			var gotIDs []string
+			for _, v := range got {
+				gotIDs = append(gotIDs, v.TraceID)
+			}
+			assert.Equal(t, spec.expTraces, gotIDs)
+		})
+	}
+}
+
+func TestTraceStorePrune(t *testing.T) {
+	const (
+		trace1 = "0102030405060708090a0b0c0d0e0f10"
+		trace2 = "1102030405060708090a0b0c0d0e0f10"
+		trace3 = "2102030405060708090a0b0c0d0e0f10"
+	)
+	db := dbm.NewMemDB()
+	store := NewTraceStore(db, 2)
+	require.NoError(t, store.AddSpans(
+		SpanRecord{TraceID: trace1, SpanID: "0000000000000001", Operation: "tx",
+			Tags: map[string]any{tagBlockHeight: int64(1), tagTXHash: "ABCDEF", tagSender: "wasm1sender", tagErrored: "true"}},
+		SpanRecord{TraceID: trace2, SpanID: "0000000000000002", Operation: "tx",
+			Tags: map[string]any{tagBlockHeight: int64(2), tagContract: "wasm1contract"}},
+	))
+	keysBefore := countDBKeys(t, db)
+
+	// when
+	require.NoError(t, store.AddSpans(
+		SpanRecord{TraceID: trace3, SpanID: "0000000000000003", Operation: "tx",
+			Tags: map[string]any{tagBlockHeight: int64(3)}},
+	))
+
+	// then
+	got, err := store.Trace(trace1)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+	for _, ids := range [][]string{
+		must(store.TracesByTx("ABCDEF")),
+		must(store.TracesBySender("wasm1sender", 10)),
+		must(store.ErroredTraces(10)),
+		must(store.TracesByHeight(1, 10)),
+	} {
+		assert.Empty(t, ids)
+	}
+	assert.Equal(t, []string{trace2}, must(store.TracesByContract("wasm1contract", 10)))
+	assert.Equal(t, []string{trace3}, must(store.TracesByHeight(3, 10)))
+	// 5 keys of the pruned trace removed, 2 keys of the new trace added
+	assert.Equal(t, keysBefore-5+2, countDBKeys(t, db))
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func countDBKeys(t *testing.T, db dbm.DB) int {
+	it, err := db.Iterator(nil, nil)
+	require.NoError(t, err)
+	defer it.Close()
+	var n int
+	for ; it.Valid(); it.Next() {
+		n++
+	}
+	return n
+}
+
+func TestBuildSpanTree(t *testing.T) {
+	startTime := time.Date(2020, time.April, 22, 12, 0, 0, 0, time.UTC)
+	got := BuildSpanTree([]SpanRecord{
+		{SpanID: "3", ParentID: "1", Operation: "second", Start: startTime.Add(2 * time.Millisecond)},
+		{SpanID: "2", ParentID: "1", Operation: "first", Start: startTime.Add(time.Millisecond)},
+		{SpanID: "1", Operation: "root", Start: startTime},
+		{SpanID: "4", ParentID: "unknown", Operation: "orphan", Start: startTime.Add(time.Second)},
+	})
+	require.Len(t, got, 2)
+	assert.Equal(t, "root", got[0].Operation)
+	assert.Equal(t, "orphan", got[1].Operation)
+	require.Len(t, got[0].Children, 2)
+	assert.Equal(t, "first", got[0].Children[0].Operation)
+	assert.Equal(t, "second", got[0].Children[1].Operation)
+}
@@ -2,8 +2,10 @@ package tracing
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
+	"runtime/debug"
 	"time"
 
 	"github.com/cometbft/cometbft/libs/log"
@@ -12,64 +14,330 @@ import (
 	otlog "github.com/opentracing/opentracing-go/log"
 )
 
-type storeLogSetting int
+// StoreLogSetting defines which store operations are captured in a span
+type StoreLogSetting int
 
 const (
-	all storeLogSetting = iota
-	writesOnly
-	nothing
+	// StoreLogAll captures reads and writes
+	StoreLogAll StoreLogSetting = iota
+	// StoreLogWritesOnly captures writes and deletes only
+	StoreLogWritesOnly
+	// StoreLogNothing does not capture any store operations
+	StoreLogNothing
+	// StoreLogDiff captures the net changes with old and new values instead of the operations
+	StoreLogDiff
 )
 
 // Exec callback to be executed within a tracing contexts. returned error is for tracking only and not causing any side effects
 type Exec func(workCtx sdk.Context, span opentracing.Span) error
 
 // DoWithTracing execute callback in tracing context
-func DoWithTracing(ctx sdk.Context, operationName string, logStore storeLogSetting, cb Exec) {
-	DoWithTracingAsync(ctx, operationName, logStore, cb)()
+func DoWithTracing(ctx sdk.Context, operationName string, logStore StoreLogSetting, cb Exec) {
+	DoWithTracingParams(ctx, SamplingParams{Operation: operationName}, logStore, cb)
 }
 
-func DoWithTracingAsync(ctx sdk.Context, operationName string, logStore storeLogSetting, cb Exec) func() {
+// DoWithTracingParams execute callback in tracing context of the params operation. The chain attributes of the params
+// are used for the sampling decision and the store capture policy.
+func DoWithTracingParams(ctx sdk.Context, p SamplingParams, logStore StoreLogSetting, cb Exec) {
+	doWithTracingAsync(ctx, p, logStore, cb)()
+}
+
+// DoWithTracingAsync execute callback in tracing context. The span is finished by the returned function.
+func DoWithTracingAsync(ctx sdk.Context, operationName string, logStore StoreLogSetting, cb Exec) func() {
+	return doWithTracingAsync(ctx, SamplingParams{Operation: operationName}, logStore, cb)
+}
+
+func doWithTracingAsync(ctx sdk.Context, p SamplingParams, logStore StoreLogSetting, cb Exec) func() {
+	ctx, sampled := sampleCtx(ctx, p)
+	if !sampled {
+		ctx, span := withUnsampledOrigin(ctx, p)
+		_ = cb(ctx, span)
+		return func() {}
+	}
+	opts := defaultSpanOptions()
+	opts.storeLog = logStore
+	workCtx, c := startSpanCapture(ctx, p, opts)
+	defer func() {
+		// capture and finish the span on panics, like out of gas, before the panic is passed on unchanged
+		if r := recover(); r != nil {
+			c.recordPanic(r, workCtx.GasMeter())
+			c.done(nil)()
+			panic(r)
+		}
+	}()
+	return c.done(cb(workCtx, c.span))
+}
+
+// SpanOption configures the data captured by a span started with StartSpan
+type SpanOption func(*spanOptions)
+
+type spanOptions struct {
+	storeLog      StoreLogSetting
+	captureGas    bool
+	captureLogger bool
+	captureEvents bool
+}
+
+func defaultSpanOptions() spanOptions {
+	return spanOptions{storeLog: StoreLogAll, captureGas: true, captureLogger: true, captureEvents: true}
+}
+
+// WithStoreCapture sets the store operations that are captured. Default is StoreLogAll.
+// A matching rule of the store capture policy takes precedence.
+func WithStoreCapture(s StoreLogSetting) SpanOption {
+	return func(o *spanOptions) {
+		o.storeLog = s
+	}
+}
+
+// WithGasCapture enables or disables the gas usage capture. Default is enabled
+func WithGasCapture(enabled bool) SpanOption {
+	return func(o *spanOptions) {
+		o.captureGas = enabled
+	}
+}
+
+// WithLoggerCapture enables or disables the logger output capture. Default is enabled
+func WithLoggerCapture(enabled bool) SpanOption {
+	return func(o *spanOptions) {
+		o.captureLogger = enabled
+	}
+}
+
+// WithEventCapture enables or disables the events capture. Default is enabled
+func WithEventCapture(enabled bool) SpanOption {
+	return func(o *spanOptions) {
+		o.captureEvents = enabled
+	}
+}
+
+// StartSpan starts a child span of the span in the context for custom module or keeper code.
+// The returned context must be used for the traced work. The returned function records the error, if any, with the
+// captured data and finishes the span. Captured events are emitted to the event manager of the given context.
+// Nothing is traced when the tracer is disabled, the context is not traceable or the trace is not sampled.
+func StartSpan(ctx sdk.Context, operationName string, opts ...SpanOption) (sdk.Context, func(err error)) {
+	if !tracerEnabled || !IsTraceable(ctx) {
+		return ctx, func(error) {}
+	}
+	p := SamplingParams{Operation: operationName}
+	ctx, sampled := sampleCtx(ctx, p)
+	if !sampled {
+		ctx, _ = withUnsampledOrigin(ctx, p)
+		return ctx, func(error) {}
+	}
+	o := defaultSpanOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	workCtx, c := startSpanCapture(ctx, p, o)
+	return workCtx, func(err error) {
+		c.done(err)()
+	}
+}
+
+// SpanFromContext returns the active span in the context or nil
+func SpanFromContext(ctx sdk.Context) opentracing.Span {
+	return opentracing.SpanFromContext(ctx.Context())
+}
+
+// SetTag sets the tag on the active span in the context. Noop when there is none
+func SetTag(ctx sdk.Context, key string, value interface{}) {
+	if span := SpanFromContext(ctx); span != nil {
+		span.SetTag(key, value)
+	}
+}
+
+// LogField logs the key value pair on the active span in the context. Noop when there is none
+func LogField(ctx sdk.Context, key, value string) {
+	if span := SpanFromContext(ctx); span != nil {
+		span.LogFields(safeLogField(key, value))
+	}
+}
+
+// spanCapture holds the span and the data captured while it is active
+type spanCapture struct {
+	parentCtx sdk.Context
+	span      opentracing.Span
+	opts      spanOptions
+	ms        *TracingMultiStore
+	em        *sdk.EventManager
+	logBuf    *bytes.Buffer
+	gm        *TraceGasMeter
+	// panicked is set when a panic was recorded. The captured events are not emitted then
+	panicked bool
+}
+
+// startSpanCapture starts the span of the params operation and returns the work context with the capturing components set.
+// The store capture of the options is overridden by a matching rule of the store capture policy.
+func startSpanCapture(ctx sdk.Context, p SamplingParams, opts spanOptions) (sdk.Context, *spanCapture) {
+	operationName := p.Operation
+	opts.storeLog = activeStoreCapture.Load().StoreLogFor(p, opts.storeLog)
 	var now time.Time
-	ctx, now = WithBlockTimeClock(ctx)
-	span, goCtx := opentracing.StartSpanFromContext(ctx.Context(), operationName, opentracing.StartTime(now))
+	ctx, now = WithBlockTimeClock(startBlockSpan(ctx))
+	rawSpan, goCtx := opentracing.StartSpanFromContext(ctx.Context(), operationName, opentracing.StartTime(now))
+	span := newBlockClockSpan(rawSpan, blockClock(ctx))
+	goCtx = opentracing.ContextWithSpan(goCtx, span)
 
 	span.SetTag(tagBlockHeight, ctx.BlockHeight())
 
-	ms := NewTracingMultiStore(ctx.MultiStore(), logStore == writesOnly)
-	if logStore != nothing {
-		ctx = ctx.WithMultiStore(ms)
+	c := &spanCapture{parentCtx: ctx, span: span, opts: opts}
+	origin := newSpanOrigin(ctx, p)
+	workCtx := withWriteSetOrigin(ctx.WithContext(goCtx), origin)
+	if opts.storeLog == StoreLogDiff {
+		c.ms = NewTracingMultiStoreWithDiff(workCtx.MultiStore())
+	} else {
+		c.ms = NewTracingMultiStore(workCtx.MultiStore(), opts.storeLog == StoreLogWritesOnly)
+	}
+	c.ms.captureStore = activeStoreFilter.forOperation(operationName)
+	if origin != nil {
+		c.span = &originSpan{Span: span, origin: origin}
+		workCtx = workCtx.WithValue(originKey, origin)
+	}
+	if opts.storeLog != StoreLogNothing {
+		workCtx = workCtx.WithMultiStore(c.ms)
+	}
+	if opts.captureEvents {
+		c.em = sdk.NewEventManager()
+		workCtx = workCtx.WithEventManager(c.em)
+	}
+	if opts.captureLogger {
+		c.logBuf = new(bytes.Buffer)
+		workCtx = workCtx.WithLogger(log.NewTMLogger(log.NewSyncWriter(io.MultiWriter(c.logBuf, os.Stdout))))
+	}
+	if opts.captureGas {
+		c.gm = newSpanTraceGasMeter(withoutGasProfile(ctx.GasMeter()))
+		workCtx = workCtx.WithGasMeter(c.gm)
+	}
+	return withGasProfile(workCtx, origin), c
+}
+
+// newSpanOrigin returns the origin of the writes for the block write set and of the gas for the block gas profile.
+// Nil when neither is recorded or in check tx and simulation.
+func newSpanOrigin(ctx sdk.Context, p SamplingParams) *spanOrigin {
+	if (activeWriteSet == nil && activeGasProfile == nil) || ctx.IsCheckTx() || IsSimulation(ctx) {
+		return nil
 	}
-	em := sdk.NewEventManager()
-	var buf bytes.Buffer
-	logger := log.NewTMLogger(log.NewSyncWriter(io.MultiWriter(&buf, os.Stdout)))
+	parent, _ := ctx.Value(originKey).(*spanOrigin)
+	origin := &spanOrigin{parent: parent, operation: p.Operation}
+	origin.module, origin.msgType, origin.contract = firstOf(p.Modules), firstOf(p.MsgTypes), firstOf(p.Contracts)
+	return origin
+}
 
-	gm := NewTraceGasMeter(ctx.GasMeter())
-	if err := cb(ctx.WithContext(goCtx).WithEventManager(em).WithLogger(logger).WithGasMeter(gm), span); err != nil {
+// withGasProfile returns the context with the gas meter that records the gas of the origin for the block gas profile.
+// The context is returned unchanged when the origin is nil or no gas profile is recorded.
+func withGasProfile(ctx sdk.Context, origin *spanOrigin) sdk.Context {
+	if origin == nil || activeGasProfile == nil {
+		return ctx
+	}
+	return ctx.WithGasMeter(&gasProfileMeter{GasMeter: withoutGasProfile(ctx.GasMeter()), origin: origin, recorder: activeGasProfile})
+}
+
+// sampleCtxWithOrigin returns the sampling decision like sampleCtx. When the subtree is not traced, the span origin
+// and gas profile meter are set on the returned context for the hooks that skip the span.
+func sampleCtxWithOrigin(ctx sdk.Context, p SamplingParams) (sdk.Context, bool) {
+	ctx, sampled := sampleCtx(ctx, p)
+	if !sampled {
+		ctx, _ = withUnsampledOrigin(ctx, p)
+	}
+	return ctx, sampled
+}
+
+// withUnsampledOrigin returns the context with the span origin, write set recorder and gas profile meter set for a span
+// that is not sampled, so that the write set, gas profile and report attribute the writes and gas independent of the
+// sampling. The returned noop span captures the origin attributes from the tags.
+func withUnsampledOrigin(ctx sdk.Context, p SamplingParams) (sdk.Context, opentracing.Span) {
+	span := opentracing.NoopTracer{}.StartSpan(p.Operation)
+	origin := newSpanOrigin(ctx, p)
+	if origin == nil {
+		return ctx, span
+	}
+	ctx = withWriteSetOrigin(ctx.WithValue(originKey, origin), origin)
+	return withGasProfile(ctx, origin), &originSpan{Span: span, origin: origin}
+}
+
+// done records the error and the captured data. The captured events are emitted to the parent context unless a panic
+// was recorded. The span is finished by the returned function.
+func (c *spanCapture) done(err error) func() {
+	span := c.span
+	if err != nil {
 		span.LogFields(otlog.Error(err))
 		span.SetTag(tagErrored, "true")
 	}
 
-	if logStore != nothing {
-		span.LogFields(safeLogField(logRawStoreIO, ms.getStoreDataLimited(MaxStoreTraced)))
+	switch c.opts.storeLog {
+	case StoreLogNothing:
+	case StoreLogDiff:
+		logLimitedJSON(span, logStoreDiff, logStoreDiffDropped, c.ms.diff.entries(), c.ms.diff.omittedWrites())
+	default:
+		span.LogFields(safeLogField(logRawStoreIO, c.ms.storeIO.String()))
+		if omitted := c.ms.storeIO.omittedOps(); omitted != 0 {
+			span.LogFields(otlog.String(logRawStoreIOOmitted, fmt.Sprintf("%d more ops omitted", omitted)))
+			span.LogFields(safeLogField(logStoreIOSummary, toJson(c.ms.storeIO.summary())))
+		}
+		logLimitedJSON(span, logStoreOps, logStoreOpsDropped, c.ms.ops.all(), c.ms.ops.omittedOps())
+	}
+	if c.opts.storeLog != StoreLogNothing {
+		if branches := c.ms.branches.all(); len(branches) != 0 {
+			span.LogFields(safeLogField(logStoreBranches, toJson(branches)))
+		}
+	}
+	if c.em != nil {
+		span.LogFields(safeLogField(logRawEvents, toJson(c.em.Events())))
+	}
+	if c.logBuf != nil {
+		span.LogFields(safeLogField(logRawLoggerOut, cutLength(c.logBuf.String(), MaxSDKLogTraced)))
+	}
+	if c.gm != nil {
+		gasUsage := struct {
+			Application any
+			Storage     any
+		}{c.gm.usage(), c.ms.traceGasMeter.usage()}
+		span.LogFields(safeLogField(logGasUsage, toJson(gasUsage)))
 	}
-	span.LogFields(safeLogField(logRawEvents, toJson(em.Events())))
-	span.LogFields(safeLogField(logRawLoggerOut, cutLength(buf.String(), MaxSDKLogTraced)))
-
-	gasUsage := struct {
-		Application []GasTrace
-		Storage     []GasTrace
-	}{gm.traces, ms.traceGasMeter.traces}
-	span.LogFields(safeLogField(logGasUsage, toJson(gasUsage)))
 
-	ctx.EventManager().EmitEvents(em.Events())
+	if c.em != nil && !c.panicked {
+		c.parentCtx.EventManager().EmitEvents(c.em.Events())
+	}
 	return func() {
-		_, now := WithBlockTimeClock(ctx)
+		_, now := WithBlockTimeClock(c.parentCtx)
 		span.FinishWithOptions(opentracing.FinishOptions{
 			FinishTime: now,
 		})
 	}
 }
 
+// recordPanic adds the panic details and gas consumption to the span
+func (c *spanCapture) recordPanic(r interface{}, gm sdk.GasMeter) {
+	c.panicked = true
+	span := c.span
+	span.SetTag(tagErrored, "true")
+	span.SetTag(tagPanic, "true")
+	if oog, ok := r.(sdk.ErrorOutOfGas); ok {
+		span.SetTag(tagOutOfGas, oog.Descriptor)
+	}
+	span.SetTag(tagGasConsumed, gm.GasConsumed())
+	span.SetTag(tagGasLimit, gm.Limit())
+	span.LogFields(
+		safeLogField(logPanicValue, fmt.Sprintf("%v", r)),
+		safeLogField(logPanicStack, string(debug.Stack())),
+	)
+}
+
+// logLimitedJSON logs the items as JSON array bounded by MaxStoreTraced and the number of items left out, including
+// the ones omitted already when captured. Nothing is logged without items.
+func logLimitedJSON[T any](span opentracing.Span, key, droppedKey string, items []T, omitted int) {
+	bz, dropped := jsonArrayLimited(items, MaxStoreTraced)
+	dropped += omitted
+	if bz == "" {
+		return
+	}
+	// limited already, not cut to keep the JSON valid
+	span.LogFields(otlog.String(key, bz))
+	if dropped != 0 {
+		span.LogFields(otlog.Int(droppedKey, dropped))
+	}
+}
+
 func safeLogField(key string, descr string) otlog.Field {
 	return otlog.String(key, cutLength(descr, DefaultMaxLength))
 }
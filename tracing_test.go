@@ -36,7 +36,7 @@ func TestDoWithTracing(t *testing.T) {
 		"with other calls": {
 			cb: func(parentCtx types.Context, span opentracing.Span) error {
 				span.SetTag("outer", "true")
-				DoWithTracing(parentCtx, "inner", all, func(workCtx types.Context, span opentracing.Span) error {
+				DoWithTracing(parentCtx, "inner", StoreLogAll, func(workCtx types.Context, span opentracing.Span) error {
 					span.SetTag("inner", "sure")
 					return nil
 				})
@@ -54,6 +54,7 @@ func TestDoWithTracing(t *testing.T) {
 		},
 		"with clock shift": {
 			cb: func(workCtx types.Context, span opentracing.Span) error {
+				LogField(workCtx, "custom", "my-field")
 				return nil
 			},
 			expect: func(t *testing.T, cap *mocktracer.MockTracer) {
@@ -62,6 +63,12 @@ func TestDoWithTracing(t *testing.T) {
 				blockTime := time.Date(2020, time.April, 22, 12, 0, 0, 0, time.UTC)
 				require.Equal(t, blockTime, spans[0].StartTime)
 				assert.Less(t, spans[0].FinishTime, blockTime.Add(time.Second))
+				logs := spans[0].Logs()
+				require.NotEmpty(t, logs)
+				for _, l := range logs {
+					assert.False(t, l.Timestamp.Before(blockTime))
+					assert.False(t, l.Timestamp.After(spans[0].FinishTime))
+				}
 			},
 		},
 	}
@@ -70,8 +77,120 @@ func TestDoWithTracing(t *testing.T) {
 			tracer := mocktracer.New()
 			opentracing.SetGlobalTracer(tracer)
 			ctx, _, _ := createMinTestInput(t)
-			DoWithTracing(ctx, "my-op", all, spec.cb)
+			DoWithTracing(ctx, "my-op", StoreLogAll, spec.cb)
 			spec.expect(t, tracer)
 		})
 	}
 }
+
+func TestStartSpan(t *testing.T) {
+	specs := map[string]struct {
+		opts    []SpanOption
+		enabled bool
+		expLogs []string
+		expSpan bool
+	}{
+		"all captured by default": {
+			enabled: true,
+			expLogs: []string{"custom", "error.object", logRawStoreIO, logRawEvents, logRawLoggerOut, logGasUsage},
+			expSpan: true,
+		},
+		"nothing captured": {
+			opts:    []SpanOption{WithStoreCapture(StoreLogNothing), WithGasCapture(false), WithLoggerCapture(false), WithEventCapture(false)},
+			enabled: true,
+			expLogs: []string{"custom", "error.object"},
+			expSpan: true,
+		},
+		"tracer disabled": {},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			tracerEnabled = spec.enabled
+			t.Cleanup(func() { tracerEnabled = false })
+			tracer := mocktracer.New()
+			opentracing.SetGlobalTracer(tracer)
+			ctx, _, _ := createMinTestInput(t)
+			em := types.NewEventManager()
+			ctx = ctx.WithEventManager(em)
+
+			// when
+			workCtx, finish := StartSpan(ctx, "my-op", spec.opts...)
+			SetTag(workCtx, "my-tag", "my-value")
+			LogField(workCtx, "custom", "my-field")
+			workCtx.EventManager().EmitEvent(types.NewEvent("my-event"))
+			finish(errors.New("my-error"))
+
+			// then
+			assert.Len(t, em.Events(), 1)
+			spans := tracer.FinishedSpans()
+			if !spec.expSpan {
+				assert.Empty(t, spans)
+				assert.Nil(t, SpanFromContext(workCtx))
+				return
+			}
+			require.Len(t, spans, 1)
+			assert.Equal(t, spans[0].Context(), SpanFromContext(workCtx).Context())
+			assert.Equal(t, "my-value", spans[0].Tag("my-tag"))
+			assert.Equal(t, "true", spans[0].Tag(tagErrored))
+			var gotLogs []string
+			for _, l := range spans[0].Logs() {
+				gotLogs = append(gotLogs, l.Fields[0].Key)
+			}
+			assert.Equal(t, spec.expLogs, gotLogs)
+		})
+	}
+}
+
+func TestDoWithTracingPanic(t *testing.T) {
+	specs := map[string]struct {
+		cb          func(workCtx types.Context, span opentracing.Span) error
+		expPanic    interface{}
+		expOutOfGas interface{}
+	}{
+		"out of gas": {
+			cb: func(workCtx types.Context, span opentracing.Span) error {
+				workCtx.EventManager().EmitEvent(types.NewEvent("my-event"))
+				workCtx.GasMeter().ConsumeGas(101, "my-descriptor")
+				return nil
+			},
+			expPanic:    types.ErrorOutOfGas{Descriptor: "my-descriptor"},
+			expOutOfGas: "my-descriptor",
+		},
+		"other panic": {
+			cb: func(workCtx types.Context, span opentracing.Span) error {
+				workCtx.EventManager().EmitEvent(types.NewEvent("my-event"))
+				panic("my-panic")
+			},
+			expPanic: "my-panic",
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			tracer := mocktracer.New()
+			opentracing.SetGlobalTracer(tracer)
+			ctx, _, _ := createMinTestInput(t)
+			em := types.NewEventManager()
+			ctx = ctx.WithGasMeter(types.NewGasMeter(100)).WithEventManager(em)
+
+			// when
+			require.PanicsWithValue(t, spec.expPanic, func() {
+				DoWithTracing(ctx, "my-op", StoreLogAll, spec.cb)
+			})
+
+			// then
+			spans := tracer.FinishedSpans()
+			require.Len(t, spans, 1)
+			assert.Equal(t, "true", spans[0].Tag(tagErrored))
+			assert.Equal(t, "true", spans[0].Tag(tagPanic))
+			assert.Equal(t, spec.expOutOfGas, spans[0].Tag(tagOutOfGas))
+			assert.Equal(t, types.Gas(100), spans[0].Tag(tagGasLimit))
+			var gotLogs []string
+			for _, l := range spans[0].Logs() {
+				gotLogs = append(gotLogs, l.Fields[0].Key)
+			}
+			assert.Equal(t, []string{logPanicValue, logRawStoreIO, logRawEvents, logRawLoggerOut, logGasUsage}, gotLogs)
+			// events of the panicked work are not passed on
+			assert.Empty(t, em.Events())
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package tracing
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	abci "github.com/cometbft/cometbft/abci/types"
+	"github.com/cometbft/cometbft/crypto/tmhash"
+	cmttypes "github.com/cometbft/cometbft/libs/bytes"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/opentracing/opentracing-go"
+)
+
+const (
+	tagTxCode      = "code"
+	tagTxCodespace = "codespace"
+	tagGasWanted   = "gas_wanted"
+	tagGasUsed     = "gas_used"
+
+	logTxResultLog = "result_log"
+)
+
+// DeliverTxFn is the ABCI deliver tx method
+type DeliverTxFn func(req abci.RequestDeliverTx) abci.ResponseDeliverTx
+
+// txRoots holds the root spans of the txs that are delivered
+var txRoots = &txRootRegistry{roots: make(map[string]*txRoot)}
+
+// txRoot is registered when the tx is delivered. The span is started lazily by the ante handler, when the
+// sdk context with the block clock and sampling decision is available
+type txRoot struct {
+	ctx  sdk.Context
+	span opentracing.Span
+}
+
+type txRootRegistry struct {
+	mx    sync.Mutex
+	roots map[string]*txRoot
+}
+
+func (r *txRootRegistry) register(txHash string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.roots[txHash] = &txRoot{}
+}
+
+func (r *txRootRegistry) remove(txHash string) *txRoot {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	root := r.roots[txHash]
+	delete(r.roots, txHash)
+	return root
+}
+
+// start starts the tx root span when the tx was registered and returns the context with the span set.
+// The context is returned unchanged when the tx is not delivered via TraceDeliverTx.
+func (r *txRootRegistry) start(ctx sdk.Context, txHash string, simulate bool) (sdk.Context, bool) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	root, ok := r.roots[txHash]
+	if !ok {
+		return ctx, false
+	}
+	if root.span == nil {
+		// continue the block trace when active
+		ctx = startBlockSpan(withBlockSpan(ctx))
+		var now time.Time
+		ctx, now = WithBlockTimeClock(ctx)
+		span, _ := opentracing.StartSpanFromContext(ctx.Context(), "tx", opentracing.StartTime(now))
+		root.span = newBlockClockSpan(span, blockClock(ctx))
+		root.span.SetTag(tagTXHash, txHash).
+			SetTag(tagBlockHeight, ctx.BlockHeight()).
+			SetTag(tagSimulation, strconv.FormatBool(simulate))
+		root.ctx = ctx
+	}
+	return ctx.WithContext(opentracing.ContextWithSpan(ctx.Context(), root.span)), true
+}
+
+// TraceDeliverTx decorates the ABCI deliver tx method with a tx root span that the ante handler, message and
+// post handler spans are children of. The root span is tagged with the tx result.
+func TraceDeliverTx(other DeliverTxFn) DeliverTxFn {
+	if !tracerEnabled {
+		return other
+	}
+	return func(req abci.RequestDeliverTx) abci.ResponseDeliverTx {
+		txHash := cmttypes.HexBytes(tmhash.Sum(req.Tx)).String()
+		txRoots.register(txHash)
+		var exec *txExecution
+		if activeSimulations != nil {
+			exec = txExecutions.register(txHash, false)
+			defer txExecutions.remove(txHash, exec)
+		}
+
+		rsp := other(req)
+		sim := activeSimulations.takeFor(exec)
+		if root := txRoots.remove(txHash); root != nil && root.span != nil {
+			tagTxResult(root.span, rsp)
+			if sim != nil {
+				addSimComparison(root.span, compareSimulation(sim, exec, rsp))
+			}
+			_, now := WithBlockTimeClock(root.ctx)
+			root.span.FinishWithOptions(opentracing.FinishOptions{FinishTime: now})
+		}
+		return rsp
+	}
+}
+
+func tagTxResult(span opentracing.Span, rsp abci.ResponseDeliverTx) {
+	span.SetTag(tagTxCode, rsp.Code).
+		SetTag(tagTxCodespace, rsp.Codespace).
+		SetTag(tagGasWanted, rsp.GasWanted).
+		SetTag(tagGasUsed, rsp.GasUsed)
+	if rsp.Code != 0 {
+		span.SetTag(tagErrored, "true")
+	}
+	span.LogFields(safeLogField(logTxResultLog, rsp.Log))
+}
+
+// NewTracePostHandler decorates the post handler with tracing functionality
+func NewTracePostHandler(other sdk.PostHandler) sdk.PostHandler {
+	if !tracerEnabled {
+		return other
+	}
+	return func(rootCtx sdk.Context, tx sdk.Tx, simulate, success bool) (newCtx sdk.Context, err error) {
+		if !isTraceable(rootCtx, simulate) {
+			return other(rootCtx, tx, simulate, success)
+		}
+		ctx, sampled := sampleCtxWithOrigin(WithSimulation(withTouchedKeys(rootCtx), simulate), msgSamplingParams("post_handler", tx.GetMsgs()...))
+		if !sampled {
+			return other(ctx, tx, simulate, success)
+		}
+		DoWithTracing(ctx, "post_handler", StoreLogWritesOnly, func(workCtx sdk.Context, span opentracing.Span) error {
+			span.SetTag(tagSimulation, strconv.FormatBool(simulate))
+			newCtx, err = other(workCtx, tx, simulate, success)
+			return err
+		})
+		return
+	}
+}
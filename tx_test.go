@@ -0,0 +1,79 @@
+package tracing
+
+import (
+	"testing"
+
+	abci "github.com/cometbft/cometbft/abci/types"
+	"github.com/cometbft/cometbft/libs/rand"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/address"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceDeliverTx(t *testing.T) {
+	tracerEnabled = true
+	t.Cleanup(func() { tracerEnabled = false })
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+
+	ctx, enc, _ := createMinTestInput(t)
+	sender := sdk.AccAddress(rand.Bytes(address.Len))
+	tx := mockTx{msgs: []sdk.Msg{&banktypes.MsgSend{FromAddress: sender.String(), ToAddress: sender.String()}}}
+	ante := NewTraceAnteHandler(func(ctx sdk.Context, tx sdk.Tx, simulate bool) (sdk.Context, error) {
+		return ctx, nil
+	}, enc)
+	post := NewTracePostHandler(func(ctx sdk.Context, tx sdk.Tx, simulate, success bool) (sdk.Context, error) {
+		return ctx, nil
+	})
+	deliverTx := TraceDeliverTx(func(req abci.RequestDeliverTx) abci.ResponseDeliverTx {
+		nextCtx, err := ante(ctx.WithTxBytes(req.Tx), tx, false)
+		require.NoError(t, err)
+		DoWithTracing(nextCtx, "service", StoreLogNothing, func(workCtx sdk.Context, span opentracing.Span) error {
+			return nil
+		})
+		_, err = post(nextCtx, tx, false, true)
+		require.NoError(t, err)
+		return abci.ResponseDeliverTx{Code: 5, Codespace: "wasm", GasWanted: 200, GasUsed: 100, Log: "my-log"}
+	})
+
+	// when
+	deliverTx(abci.RequestDeliverTx{Tx: []byte("my-tx")})
+
+	// then
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 4)
+	var gotOps []string
+	for _, s := range spans {
+		gotOps = append(gotOps, s.OperationName)
+	}
+	assert.Equal(t, []string{"ante_handler", "service", "post_handler", "tx"}, gotOps)
+	root := spans[3]
+	for _, s := range spans[:3] {
+		assert.Equal(t, root.SpanContext.SpanID, s.ParentID, s.OperationName)
+	}
+	assert.Equal(t, spans[0].Tag(tagTXHash), root.Tag(tagTXHash))
+	assert.Equal(t, uint32(5), root.Tag(tagTxCode))
+	assert.Equal(t, "wasm", root.Tag(tagTxCodespace))
+	assert.Equal(t, int64(200), root.Tag(tagGasWanted))
+	assert.Equal(t, int64(100), root.Tag(tagGasUsed))
+	assert.Equal(t, "true", root.Tag(tagErrored))
+	require.Len(t, root.Logs(), 1)
+	assert.Equal(t, "my-log", root.Logs()[0].Fields[0].ValueString)
+	assert.Empty(t, txRoots.roots)
+}
+
+type mockTx struct {
+	msgs []sdk.Msg
+}
+
+func (m mockTx) GetMsgs() []sdk.Msg {
+	return m.msgs
+}
+
+func (m mockTx) ValidateBasic() error {
+	return nil
+}
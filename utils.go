@@ -17,3 +17,11 @@ func cutLength(storeData string, max int) string {
 	}
 	return strings.TrimSpace(storeData)
 }
+
+// firstOf returns the first element or an empty string
+func firstOf(s []string) string {
+	if len(s) == 0 {
+		return ""
+	}
+	return s[0]
+}
@@ -79,8 +79,12 @@ func (h TraceMessageHandler) DispatchMsg(rootCtx sdk.Context, contractAddr sdk.A
 	if !IsTraceable(rootCtx) {
 		return h.other.DispatchMsg(rootCtx, contractAddr, contractIBCPortID, msg)
 	}
-
-	DoWithTracing(rootCtx, "messenger", all, func(workCtx sdk.Context, span opentracing.Span) error {
+	p := SamplingParams{Operation: "messenger", Contracts: []string{contractAddr.String()}}
+	ctx, sampled := sampleCtxWithOrigin(rootCtx, p)
+	if !sampled {
+		return h.other.DispatchMsg(ctx, contractAddr, contractIBCPortID, msg)
+	}
+	DoWithTracingParams(ctx, p, StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
 		span.SetTag(tagSenderContract, contractAddr.String())
 		addTagsFromWasmContractMsg(span, msg)
 		events, data, err = h.other.DispatchMsg(workCtx, contractAddr, contractIBCPortID, msg)
@@ -109,7 +113,12 @@ func (t TraceQueryPlugin) HandleQuery(rootCtx sdk.Context, caller sdk.AccAddress
 	if !IsTraceable(rootCtx) { // track only internal queries
 		return t.other.HandleQuery(rootCtx, caller, request)
 	}
-	DoWithTracing(rootCtx, "wasm_query", all, func(workCtx sdk.Context, span opentracing.Span) error {
+	p := SamplingParams{Operation: "wasm_query", Contracts: []string{caller.String()}}
+	ctx, sampled := sampleCtxWithOrigin(rootCtx, p)
+	if !sampled {
+		return t.other.HandleQuery(ctx, caller, request)
+	}
+	DoWithTracingParams(ctx, p, StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
 		span.SetTag(tagSenderContract, caller.String())
 		addTagsFromWasmQuery(span, request)
 		result, err = t.other.HandleQuery(workCtx, caller, request)
@@ -37,6 +37,7 @@ func (t TraceWasmVm) AnalyzeCode(checksum cosmwasm.Checksum) (*wasmvmtypes.Analy
 func (t TraceWasmVm) Instantiate(checksum cosmwasm.Checksum, env wasmvmtypes.Env, info wasmvmtypes.MessageInfo, initMsg []byte, store cosmwasm.KVStore, goapi cosmwasm.GoAPI, querier cosmwasm.Querier, gasMeter cosmwasm.GasMeter, gasLimit uint64, deserCost wasmvmtypes.UFraction) (resp *wasmvmtypes.Response, gasUsed uint64, err error) {
 	return wasmvmDoWithTracing(
 		"wasmvm_instantiate",
+		env,
 		querier,
 		ContractJsonInputMsgRecorder(initMsg),
 		ContractVmResponseRecorder(),
@@ -49,6 +50,7 @@ func (t TraceWasmVm) Instantiate(checksum cosmwasm.Checksum, env wasmvmtypes.Env
 func (t TraceWasmVm) Execute(checksum cosmwasm.Checksum, env wasmvmtypes.Env, info wasmvmtypes.MessageInfo, executeMsg []byte, store cosmwasm.KVStore, goapi cosmwasm.GoAPI, querier cosmwasm.Querier, gasMeter cosmwasm.GasMeter, gasLimit uint64, deserCost wasmvmtypes.UFraction) (resp *wasmvmtypes.Response, gasUsed uint64, err error) {
 	return wasmvmDoWithTracing(
 		"wasmvm_execute",
+		env,
 		querier,
 		ContractJsonInputMsgRecorder(executeMsg),
 		ContractVmResponseRecorder(),
@@ -60,7 +62,8 @@ func (t TraceWasmVm) Execute(checksum cosmwasm.Checksum, env wasmvmtypes.Env, in
 
 func (t TraceWasmVm) Query(checksum cosmwasm.Checksum, env wasmvmtypes.Env, queryMsg []byte, store cosmwasm.KVStore, goapi cosmwasm.GoAPI, querier cosmwasm.Querier, gasMeter cosmwasm.GasMeter, gasLimit uint64, deserCost wasmvmtypes.UFraction) (resp []byte, gasUsed uint64, err error) {
 	rootCtx := fetchCtx(querier)
-	DoWithTracing(rootCtx, "wasmvm_query", all, func(workCtx sdk.Context, span opentracing.Span) error {
+	p := SamplingParams{Operation: "wasmvm_query", Contracts: []string{env.Contract.Address}}
+	DoWithTracingParams(rootCtx, p, StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
 		span.LogFields(safeLogField(logRawQueryData, string(queryMsg)))
 		resp, gasUsed, err = t.other.Query(checksum, env, queryMsg, store, goapi, querier, gasMeter, gasLimit, deserCost)
 		if err == nil && resp != nil {
@@ -87,6 +90,7 @@ func fetchCtx(querier cosmwasm.Querier) sdk.Context {
 func (t TraceWasmVm) Migrate(checksum cosmwasm.Checksum, env wasmvmtypes.Env, migrateMsg []byte, store cosmwasm.KVStore, goapi cosmwasm.GoAPI, querier cosmwasm.Querier, gasMeter cosmwasm.GasMeter, gasLimit uint64, deserCost wasmvmtypes.UFraction) (resp *wasmvmtypes.Response, gasUsed uint64, err error) {
 	return wasmvmDoWithTracing(
 		"wasmvm_migrate",
+		env,
 		querier,
 		ContractJsonInputMsgRecorder(migrateMsg),
 		ContractVmResponseRecorder(),
@@ -99,6 +103,7 @@ func (t TraceWasmVm) Migrate(checksum cosmwasm.Checksum, env wasmvmtypes.Env, mi
 func (t TraceWasmVm) Sudo(checksum cosmwasm.Checksum, env wasmvmtypes.Env, sudoMsg []byte, store cosmwasm.KVStore, goapi cosmwasm.GoAPI, querier cosmwasm.Querier, gasMeter cosmwasm.GasMeter, gasLimit uint64, deserCost wasmvmtypes.UFraction) (resp *wasmvmtypes.Response, gasUsed uint64, err error) {
 	return wasmvmDoWithTracing(
 		"wasmvm_sudo",
+		env,
 		querier,
 		ContractJsonInputMsgRecorder(sudoMsg),
 		ContractVmResponseRecorder(),
@@ -111,6 +116,7 @@ func (t TraceWasmVm) Sudo(checksum cosmwasm.Checksum, env wasmvmtypes.Env, sudoM
 func (t TraceWasmVm) Reply(checksum cosmwasm.Checksum, env wasmvmtypes.Env, reply wasmvmtypes.Reply, store cosmwasm.KVStore, goapi cosmwasm.GoAPI, querier cosmwasm.Querier, gasMeter cosmwasm.GasMeter, gasLimit uint64, deserCost wasmvmtypes.UFraction) (resp *wasmvmtypes.Response, gasUsed uint64, err error) {
 	return wasmvmDoWithTracing(
 		"wasmvm_reply",
+		env,
 		querier,
 		ContractGenericInputMsgRecorder(reply),
 		ContractVmResponseRecorder(),
@@ -131,6 +137,7 @@ func (t TraceWasmVm) Cleanup() {
 func (t TraceWasmVm) IBCChannelOpen(checksum cosmwasm.Checksum, env wasmvmtypes.Env, channel wasmvmtypes.IBCChannelOpenMsg, store cosmwasm.KVStore, goapi cosmwasm.GoAPI, querier cosmwasm.Querier, gasMeter cosmwasm.GasMeter, gasLimit uint64, deserCost wasmvmtypes.UFraction) (*wasmvmtypes.IBC3ChannelOpenResponse, uint64, error) {
 	return wasmvmDoWithTracing(
 		"wasmvm_chan_open",
+		env,
 		querier,
 		ContractGenericInputMsgRecorder(channel),
 		ContractIBCChannelOpenResponseRecorder(),
@@ -143,6 +150,7 @@ func (t TraceWasmVm) IBCChannelOpen(checksum cosmwasm.Checksum, env wasmvmtypes.
 func (t TraceWasmVm) IBCChannelConnect(checksum cosmwasm.Checksum, env wasmvmtypes.Env, channel wasmvmtypes.IBCChannelConnectMsg, store cosmwasm.KVStore, goapi cosmwasm.GoAPI, querier cosmwasm.Querier, gasMeter cosmwasm.GasMeter, gasLimit uint64, deserCost wasmvmtypes.UFraction) (*wasmvmtypes.IBCBasicResponse, uint64, error) {
 	return wasmvmDoWithTracing(
 		"wasmvm_chan_connect",
+		env,
 		querier,
 		ContractGenericInputMsgRecorder(channel),
 		ContractGenericResponseRecorder[wasmvmtypes.IBCBasicResponse](),
@@ -155,6 +163,7 @@ func (t TraceWasmVm) IBCChannelConnect(checksum cosmwasm.Checksum, env wasmvmtyp
 func (t TraceWasmVm) IBCChannelClose(checksum cosmwasm.Checksum, env wasmvmtypes.Env, channel wasmvmtypes.IBCChannelCloseMsg, store cosmwasm.KVStore, goapi cosmwasm.GoAPI, querier cosmwasm.Querier, gasMeter cosmwasm.GasMeter, gasLimit uint64, deserCost wasmvmtypes.UFraction) (*wasmvmtypes.IBCBasicResponse, uint64, error) {
 	return wasmvmDoWithTracing(
 		"wasmvm_chan_close",
+		env,
 		querier,
 		ContractGenericInputMsgRecorder(channel),
 		ContractGenericResponseRecorder[wasmvmtypes.IBCBasicResponse](),
@@ -167,6 +176,7 @@ func (t TraceWasmVm) IBCChannelClose(checksum cosmwasm.Checksum, env wasmvmtypes
 func (t TraceWasmVm) IBCPacketReceive(checksum cosmwasm.Checksum, env wasmvmtypes.Env, packet wasmvmtypes.IBCPacketReceiveMsg, store cosmwasm.KVStore, goapi cosmwasm.GoAPI, querier cosmwasm.Querier, gasMeter cosmwasm.GasMeter, gasLimit uint64, deserCost wasmvmtypes.UFraction) (*wasmvmtypes.IBCReceiveResult, uint64, error) {
 	return wasmvmDoWithTracing(
 		"wasmvm_pkg_recv",
+		env,
 		querier,
 		ContractGenericInputMsgRecorder(packet),
 		ContractGenericResponseRecorder[wasmvmtypes.IBCReceiveResult](),
@@ -179,6 +189,7 @@ func (t TraceWasmVm) IBCPacketReceive(checksum cosmwasm.Checksum, env wasmvmtype
 func (t TraceWasmVm) IBCPacketAck(checksum cosmwasm.Checksum, env wasmvmtypes.Env, ack wasmvmtypes.IBCPacketAckMsg, store cosmwasm.KVStore, goapi cosmwasm.GoAPI, querier cosmwasm.Querier, gasMeter cosmwasm.GasMeter, gasLimit uint64, deserCost wasmvmtypes.UFraction) (*wasmvmtypes.IBCBasicResponse, uint64, error) {
 	return wasmvmDoWithTracing(
 		"wasmvm_pkg_ack",
+		env,
 		querier,
 		ContractGenericInputMsgRecorder(ack),
 		ContractGenericResponseRecorder[wasmvmtypes.IBCBasicResponse](),
@@ -191,6 +202,7 @@ func (t TraceWasmVm) IBCPacketAck(checksum cosmwasm.Checksum, env wasmvmtypes.En
 func (t TraceWasmVm) IBCPacketTimeout(checksum cosmwasm.Checksum, env wasmvmtypes.Env, packet wasmvmtypes.IBCPacketTimeoutMsg, store cosmwasm.KVStore, goapi cosmwasm.GoAPI, querier cosmwasm.Querier, gasMeter cosmwasm.GasMeter, gasLimit uint64, deserCost wasmvmtypes.UFraction) (*wasmvmtypes.IBCBasicResponse, uint64, error) {
 	return wasmvmDoWithTracing(
 		"wasmvm_pkg_timeout",
+		env,
 		querier,
 		ContractGenericInputMsgRecorder(packet),
 		ContractGenericResponseRecorder[wasmvmtypes.IBCBasicResponse](),
@@ -260,6 +272,7 @@ func ContractGenericResponseRecorder[T any]() func(opentracing.Span, *T) {
 // customized input/response tracers are used to log type specific data
 func wasmvmDoWithTracing[T wasmvmtypes.Response | wasmvmtypes.IBCBasicResponse | wasmvmtypes.IBC3ChannelOpenResponse | wasmvmtypes.IBCReceiveResult](
 	name string,
+	env wasmvmtypes.Env,
 	querier cosmwasm.Querier,
 	inputTracer func(opentracing.Span),
 	responseTracer func(opentracing.Span, *T),
@@ -270,7 +283,8 @@ func wasmvmDoWithTracing[T wasmvmtypes.Response | wasmvmtypes.IBCBasicResponse |
 		fmt.Println("+++++ not tracing wasmvm call due to missing root context")
 		return cb()
 	}
-	DoWithTracing(rootCtx, name, all, func(workCtx sdk.Context, span opentracing.Span) error {
+	p := SamplingParams{Operation: name, Contracts: []string{env.Contract.Address}}
+	DoWithTracingParams(rootCtx, p, StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
 		inputTracer(span)
 		resp, gasUsed, err = cb()
 		if err == nil && resp != nil {
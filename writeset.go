@@ -0,0 +1,500 @@
+package tracing
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	storetypes "github.com/cosmos/cosmos-sdk/store/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/opentracing/opentracing-go"
+)
+
+const writeSetFilePrefix = "writeset-"
+
+// WriteRecord is a committed write to a persistent store with the traced span that wrote it
+type WriteRecord struct {
+	Height    int64  `json:"height"`
+	Store     string `json:"store"`
+	Key       string `json:"key"`
+	ValueHash string `json:"value_hash,omitempty"`
+	Delete    bool   `json:"delete,omitempty"`
+	// TxIndex is the position of the tx in the block or -1 for begin and end block or when unknown
+	TxIndex  int    `json:"tx_index"`
+	TxHash   string `json:"tx_hash,omitempty"`
+	Span     string `json:"span,omitempty"`
+	Module   string `json:"module,omitempty"`
+	MsgType  string `json:"msg_type,omitempty"`
+	Contract string `json:"contract,omitempty"`
+}
+
+// activeWriteSet records the block write sets when set
+var activeWriteSet *writeSetRecorder
+
+// spanOrigin identifies the traced span that writes to a store
+type spanOrigin struct {
+	parent    *spanOrigin
+	operation string
+	module    string
+	msgType   string
+	contract  string
+	codeID    string
+}
+
+// path returns the operation names from the root span
+func (o *spanOrigin) path() string {
+	var ops []string
+	for c := o; c != nil; c = c.parent {
+		ops = append([]string{c.operation}, ops...)
+	}
+	return strings.Join(ops, "/")
+}
+
+// frame returns the operation name with the most specific attribute of the span: msg type, contract or module
+func (o *spanOrigin) frame() string {
+	for _, v := range []string{o.msgType, o.contract, o.module} {
+		if v != "" {
+			return o.operation + " " + v
+		}
+	}
+	return o.operation
+}
+
+// attributes returns the innermost module, msg type and contract that are known
+func (o *spanOrigin) attributes() (module, msgType, contract string) {
+	for c := o; c != nil; c = c.parent {
+		if module == "" {
+			module = c.module
+		}
+		if msgType == "" {
+			msgType = c.msgType
+		}
+		if contract == "" {
+			contract = c.contract
+		}
+	}
+	return
+}
+
+// innermostCodeID returns the innermost code id that is known
+func (o *spanOrigin) innermostCodeID() string {
+	for c := o; c != nil; c = c.parent {
+		if c.codeID != "" {
+			return c.codeID
+		}
+	}
+	return ""
+}
+
+var _ opentracing.Span = &originSpan{}
+
+// originSpan is a decorator to the span that captures the origin attributes from the tags set
+type originSpan struct {
+	opentracing.Span
+	origin *spanOrigin
+}
+
+func (s *originSpan) SetTag(key string, value interface{}) opentracing.Span {
+	switch key {
+	case tagModule:
+		s.origin.module = tagValueString(value)
+	case tagSDKMsgType, tagSDKGRPCService:
+		s.origin.msgType = tagValueString(value)
+	case tagContract, tagSenderContract:
+		s.origin.contract = tagValueString(value)
+	case tagCodeID:
+		s.origin.codeID = tagValueString(value)
+	}
+	s.Span.SetTag(key, value)
+	return s
+}
+
+func tagValueString(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case []string:
+		return strings.Join(x, ",")
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// withWriteSetOrigin returns the context with the multistore that records the writes for the block write set.
+// The tx and sequence of the writes are recorded by the first multistore in the chain, the span origin by the ones
+// above. The context is returned unchanged when the origin is nil or no write set is recorded.
+func withWriteSetOrigin(ctx sdk.Context, origin *spanOrigin) sdk.Context {
+	if origin == nil || activeWriteSet == nil {
+		return ctx
+	}
+	ctx = withStoreWrapper(ctx, activeWriteSet)
+	return withStoreWrapper(ctx, &writeSetOrigin{origin: origin, recorder: activeWriteSet})
+}
+
+var _ kvStoreWrapper = &writeSetOrigin{}
+
+// writeSetOrigin wraps the stores to record the span origin of the writes
+type writeSetOrigin struct {
+	origin   *spanOrigin
+	recorder *writeSetRecorder
+}
+
+func (o *writeSetOrigin) wrap(store storetypes.KVStore, storeName string) storetypes.KVStore {
+	return &writeSetKVStore{KVStore: store, storeName: storeName, origin: o.origin, recorder: o.recorder}
+}
+
+var _ storetypes.KVStore = &writeSetKVStore{}
+
+// writeSetKVStore is a decorator to the store that records the writes with the tx and sequence or, when the origin
+// is set, the span origin of the write
+type writeSetKVStore struct {
+	storetypes.KVStore
+	storeName string
+	origin    *spanOrigin
+	recorder  *writeSetRecorder
+}
+
+func (s *writeSetKVStore) Set(key, value []byte) {
+	s.record(key)
+	s.KVStore.Set(key, value)
+}
+
+func (s *writeSetKVStore) Delete(key []byte) {
+	s.record(key)
+	s.KVStore.Delete(key)
+}
+
+func (s *writeSetKVStore) record(key []byte) {
+	if s.origin != nil {
+		s.recorder.recordSpanWrite(s.storeName, key, s.origin)
+		return
+	}
+	s.recorder.recordWrite(s.storeName, key)
+}
+
+type writeKey struct {
+	store, key, valueHash string
+	delete                bool
+}
+
+// id returns the store and key
+func (k writeKey) id() string {
+	return k.store + "/" + k.key
+}
+
+type writeOrigin struct {
+	seq     uint64
+	txIndex int
+	txHash  string
+	span    *spanOrigin
+}
+
+// writeSetRecorder collects the writes of the delivered txs and the committed writes of a block.
+// The committed writes are attributed to the last write to the same store and key.
+type writeSetRecorder struct {
+	dir string
+
+	mx      sync.Mutex
+	height  int64
+	txCount int
+	txIndex int
+	txHash  string
+	seq     uint64
+	// pendingKey and pendingSpan are the innermost span origin of the write in progress
+	pendingKey  string
+	pendingSpan *spanOrigin
+	// origins and committed are by store and key
+	origins   map[string]writeOrigin
+	committed map[string]writeKey
+}
+
+func newWriteSetRecorder(dir string) *writeSetRecorder {
+	return &writeSetRecorder{
+		dir:       dir,
+		txIndex:   -1,
+		origins:   make(map[string]writeOrigin),
+		committed: make(map[string]writeKey),
+	}
+}
+
+func newWriteKey(store string, key, value []byte, delete bool) writeKey {
+	wk := writeKey{store: store, key: hex.EncodeToString(key), delete: delete}
+	if !delete {
+		h := sha256.Sum256(value)
+		wk.valueHash = hex.EncodeToString(h[:])
+	}
+	return wk
+}
+
+func (r *writeSetRecorder) startBlock(height int64) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.height, r.txCount, r.txIndex, r.txHash = height, 0, -1, ""
+}
+
+func (r *writeSetRecorder) startTx(txHash string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.txIndex, r.txHash = r.txCount, txHash
+	r.txCount++
+}
+
+func (r *writeSetRecorder) endTx() {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.txIndex, r.txHash = -1, ""
+}
+
+// recordSpanWrite keeps the span origin of the write in progress until it is recorded. The same write seen by the
+// stores of enclosing spans is skipped so that the innermost span is recorded.
+func (r *writeSetRecorder) recordSpanWrite(store string, key []byte, origin *spanOrigin) {
+	id := store + "/" + hex.EncodeToString(key)
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if r.pendingSpan != nil && r.pendingKey == id {
+		return
+	}
+	r.pendingKey, r.pendingSpan = id, origin
+}
+
+// recordWrite records the tx and sequence of a write with the span origin, when known. A later write to the same
+// store and key replaces it.
+func (r *writeSetRecorder) recordWrite(store string, key []byte) {
+	id := store + "/" + hex.EncodeToString(key)
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	var span *spanOrigin
+	if r.pendingKey == id {
+		span = r.pendingSpan
+	}
+	r.pendingKey, r.pendingSpan = "", nil
+	r.seq++
+	r.origins[id] = writeOrigin{seq: r.seq, txIndex: r.txIndex, txHash: r.txHash, span: span}
+}
+
+var _ kvStoreWrapper = &writeSetRecorder{}
+
+// wrap the store to record the tx and sequence of the writes
+func (r *writeSetRecorder) wrap(store storetypes.KVStore, storeName string) storetypes.KVStore {
+	return &writeSetKVStore{KVStore: store, storeName: storeName, recorder: r}
+}
+
+var _ storetypes.WriteListener = &writeSetRecorder{}
+
+// OnWrite records a write to the persistent stores on commit
+func (r *writeSetRecorder) OnWrite(storeKey storetypes.StoreKey, key, value []byte, delete bool) error {
+	if _, ok := storeKey.(*storetypes.KVStoreKey); !ok { // not part of the app hash
+		return nil
+	}
+	wk := newWriteKey(storeKey.Name(), key, value, delete)
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.committed[wk.id()] = wk
+	return nil
+}
+
+// flush writes the committed write set of the block in execution order to a file and resets the recorder
+func (r *writeSetRecorder) flush() error {
+	r.mx.Lock()
+	records := make([]WriteRecord, 0, len(r.committed))
+	seqs := make(map[int]uint64, len(r.committed))
+	for _, wk := range r.committed {
+		rec := WriteRecord{Height: r.height, Store: wk.store, Key: wk.key, ValueHash: wk.valueHash, Delete: wk.delete, TxIndex: -1}
+		seq := ^uint64(0) // unknown origins last
+		if o, ok := r.origins[wk.id()]; ok {
+			seq = o.seq
+			rec.TxIndex, rec.TxHash = o.txIndex, o.txHash
+			if o.span != nil {
+				rec.Span = o.span.path()
+				rec.Module, rec.MsgType, rec.Contract = o.span.attributes()
+			}
+		}
+		seqs[len(records)] = seq
+		records = append(records, rec)
+	}
+	height := r.height
+	r.origins = make(map[string]writeOrigin)
+	r.committed = make(map[string]writeKey)
+	r.seq = 0
+	r.mx.Unlock()
+
+	idx := make([]int, len(records))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool {
+		a, b := idx[i], idx[j]
+		if seqs[a] != seqs[b] {
+			return seqs[a] < seqs[b]
+		}
+		if records[a].Store != records[b].Store {
+			return records[a].Store < records[b].Store
+		}
+		return records[a].Key < records[b].Key
+	})
+	sorted := make([]WriteRecord, len(records))
+	for i, v := range idx {
+		sorted[i] = records[v]
+	}
+	return writeWriteSetFile(filepath.Join(r.dir, writeSetFileName(height)), sorted)
+}
+
+func writeSetFileName(height int64) string {
+	return fmt.Sprintf("%s%012d.jsonl", writeSetFilePrefix, height)
+}
+
+func writeWriteSetFile(path string, records []WriteRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadWriteSetFile reads the records of a write set file
+func ReadWriteSetFile(path string) ([]WriteRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []WriteRecord
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for dec.More() {
+		var r WriteRecord
+		if err := dec.Decode(&r); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// WriteSetDiff is the first difference between two write sets. A record is nil when the write is missing.
+type WriteSetDiff struct {
+	Height     int64
+	Store, Key string
+	A, B       *WriteRecord
+}
+
+// DiffWriteSets returns the first write in execution order that differs or nil when both are equal
+func DiffWriteSets(a, b []WriteRecord) *WriteSetDiff {
+	index := func(records []WriteRecord) map[string]int {
+		r := make(map[string]int, len(records))
+		for i, v := range records {
+			r[v.Store+"/"+v.Key] = i
+		}
+		return r
+	}
+	aIdx, bIdx := index(a), index(b)
+	posA, posB := -1, -1
+	for i, v := range a {
+		j, ok := bIdx[v.Store+"/"+v.Key]
+		if !ok || b[j].ValueHash != v.ValueHash || b[j].Delete != v.Delete {
+			posA = i
+			break
+		}
+	}
+	for j, v := range b {
+		if _, ok := aIdx[v.Store+"/"+v.Key]; !ok {
+			posB = j
+			break
+		}
+	}
+	switch {
+	case posA == -1 && posB == -1:
+		return nil
+	case posA != -1 && (posB == -1 || posA <= posB):
+		d := &WriteSetDiff{Height: a[posA].Height, Store: a[posA].Store, Key: a[posA].Key, A: &a[posA]}
+		if j, ok := bIdx[d.Store+"/"+d.Key]; ok {
+			d.B = &b[j]
+		}
+		return d
+	default:
+		return &WriteSetDiff{Height: b[posB].Height, Store: b[posB].Store, Key: b[posB].Key, B: &b[posB]}
+	}
+}
+
+// String returns a human readable description of the write
+func (r *WriteRecord) String() string {
+	if r == nil {
+		return "missing"
+	}
+	var sb strings.Builder
+	if r.Delete {
+		sb.WriteString("deleted")
+	} else {
+		sb.WriteString("value hash " + r.ValueHash)
+	}
+	if r.TxIndex >= 0 {
+		fmt.Fprintf(&sb, " tx %d (%s)", r.TxIndex, r.TxHash)
+	}
+	for _, v := range []struct{ k, v string }{{"span", r.Span}, {"module", r.Module}, {"msg", r.MsgType}, {"contract", r.Contract}} {
+		if v.v != "" {
+			fmt.Fprintf(&sb, " %s %s", v.k, v.v)
+		}
+	}
+	return sb.String()
+}
+
+// writeSetFilePairs returns the write set files of the same heights in height order for two dirs or the two files
+func writeSetFilePairs(a, b string) ([][2]string, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return nil, err
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case !infoA.IsDir() && !infoB.IsDir():
+		return [][2]string{{a, b}}, nil
+	case infoA.IsDir() != infoB.IsDir():
+		return nil, errors.New("can not compare a file with a dir")
+	}
+	matches, err := filepath.Glob(filepath.Join(a, writeSetFilePrefix+"*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	var pairs [][2]string
+	for _, m := range matches {
+		other := filepath.Join(b, filepath.Base(m))
+		if _, err := os.Stat(other); err != nil {
+			continue
+		}
+		pairs = append(pairs, [2]string{m, other})
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("no write sets of the same heights in %s and %s", a, b)
+	}
+	return pairs, nil
+}
@@ -0,0 +1,185 @@
+package tracing
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	dbm "github.com/cometbft/cometbft-db"
+	abci "github.com/cometbft/cometbft/abci/types"
+	"github.com/cometbft/cometbft/libs/log"
+	tmproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	"github.com/cosmos/cosmos-sdk/baseapp"
+	storetypes "github.com/cosmos/cosmos-sdk/store/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordWriteSet(t *testing.T) {
+	tracerEnabled = true
+	dir := t.TempDir()
+	tracerConfig.WriteSetDir = dir
+	t.Cleanup(func() {
+		tracerEnabled = false
+		tracerConfig.WriteSetDir = ""
+		activeWriteSet = nil
+	})
+	opentracing.SetGlobalTracer(mocktracer.New())
+
+	bankKey, wasmKey, transientKey := sdk.NewKVStoreKey("bank"), sdk.NewKVStoreKey("wasm"), sdk.NewTransientStoreKey("transient")
+	bApp := baseapp.NewBaseApp("test", log.NewNopLogger(), dbm.NewMemDB(), nil)
+	app := NewTraceBlockApp(bApp, map[string]*storetypes.KVStoreKey{"bank": bankKey, "wasm": wasmKey})
+	bApp.MountStores(bankKey, wasmKey, transientKey)
+	bApp.SetBeginBlocker(func(ctx sdk.Context, _ abci.RequestBeginBlock) abci.ResponseBeginBlock {
+		ctx.KVStore(bankKey).Set([]byte("untraced"), []byte("value"))
+		DoWithTracing(ctx, "my_op", StoreLogAll, func(workCtx sdk.Context, span opentracing.Span) error {
+			span.SetTag(tagModule, "wasm")
+			DoWithTracing(workCtx, "my_inner_op", StoreLogWritesOnly, func(workCtx sdk.Context, span opentracing.Span) error {
+				span.SetTag(tagContract, "wasm1abc")
+				workCtx.KVStore(wasmKey).Set([]byte("foo"), []byte("bar"))
+				return nil
+			})
+			workCtx.KVStore(wasmKey).Delete([]byte("other"))
+			workCtx.KVStore(transientKey).Set([]byte("foo"), []byte("bar"))
+			return nil
+		})
+		return abci.ResponseBeginBlock{}
+	})
+	require.NoError(t, bApp.LoadLatestVersion())
+
+	// when
+	app.BeginBlock(abci.RequestBeginBlock{Header: tmproto.Header{Height: 1, Time: time.Now()}})
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	app.Commit()
+
+	// then
+	got, err := ReadWriteSetFile(filepath.Join(dir, writeSetFileName(1)))
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	assert.Equal(t, "wasm", got[0].Store)
+	assert.Equal(t, "666f6f", got[0].Key)
+	assert.Equal(t, "my_op/my_inner_op", got[0].Span)
+	assert.Equal(t, "wasm", got[0].Module)
+	assert.Equal(t, "wasm1abc", got[0].Contract)
+	assert.Equal(t, -1, got[0].TxIndex)
+	assert.NotEmpty(t, got[0].ValueHash)
+
+	assert.Equal(t, "wasm", got[1].Store)
+	assert.True(t, got[1].Delete)
+	assert.Equal(t, "my_op", got[1].Span)
+	assert.Empty(t, got[1].Contract)
+
+	// writes without a span are last
+	assert.Equal(t, "bank", got[2].Store)
+	assert.Empty(t, got[2].Span)
+}
+
+func TestDiffWriteSets(t *testing.T) {
+	a := []WriteRecord{
+		{Height: 1, Store: "bank", Key: "01", ValueHash: "aa", TxIndex: 0},
+		{Height: 1, Store: "wasm", Key: "02", ValueHash: "bb", TxIndex: 1, Contract: "wasm1abc"},
+	}
+	specs := map[string]struct {
+		b   []WriteRecord
+		exp *WriteSetDiff
+	}{
+		"equal": {
+			b: a,
+		},
+		"different value": {
+			b: []WriteRecord{a[0], {Height: 1, Store: "wasm", Key: "02", ValueHash: "cc", TxIndex: 1}},
+			exp: &WriteSetDiff{Height: 1, Store: "wasm", Key: "02", A: &a[1],
+				B: &WriteRecord{Height: 1, Store: "wasm", Key: "02", ValueHash: "cc", TxIndex: 1}},
+		},
+		"deleted instead": {
+			b: []WriteRecord{{Height: 1, Store: "bank", Key: "01", Delete: true, TxIndex: 0}, a[1]},
+			exp: &WriteSetDiff{Height: 1, Store: "bank", Key: "01", A: &a[0],
+				B: &WriteRecord{Height: 1, Store: "bank", Key: "01", Delete: true, TxIndex: 0}},
+		},
+		"missing in b": {
+			b:   a[:1],
+			exp: &WriteSetDiff{Height: 1, Store: "wasm", Key: "02", A: &a[1]},
+		},
+		"additional in b": {
+			b: []WriteRecord{{Height: 1, Store: "gov", Key: "03", ValueHash: "dd", TxIndex: 0}, a[0], a[1]},
+			exp: &WriteSetDiff{Height: 1, Store: "gov", Key: "03",
+				B: &WriteRecord{Height: 1, Store: "gov", Key: "03", ValueHash: "dd", TxIndex: 0}},
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			got := DiffWriteSets(a, spec.b)
+			assert.Equal(t, spec.exp, got)
+		})
+	}
+}
+
+func TestRecordWriteSetOrigins(t *testing.T) {
+	t.Cleanup(func() {
+		SetSampler(nil)
+		activeStoreFilter, activeWriteSet = nil, nil
+	})
+	specs := map[string]struct {
+		sampler       *Sampler
+		filterExclude []string
+	}{
+		"sampled": {},
+		"not sampled": {
+			sampler: NewSampler(SamplingAction{Type: SamplingActionDrop}),
+		},
+		"store not captured": {
+			filterExclude: []string{"wasm"},
+		},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			opentracing.SetGlobalTracer(mocktracer.New())
+			SetSampler(spec.sampler)
+			filter, err := newStoreCaptureFilter(nil, spec.filterExclude)
+			require.NoError(t, err)
+			activeStoreFilter = filter
+			ctx, _, storeKey := createMinTestInput(t)
+			dir := t.TempDir()
+			recorder := newWriteSetRecorder(dir)
+			activeWriteSet = recorder
+			recorder.startBlock(1)
+
+			// when
+			recorder.startTx("AA")
+			p := SamplingParams{Operation: "my_msg", Contracts: []string{"wasm1abc"}}
+			DoWithTracingParams(ctx, p, StoreLogWritesOnly, func(workCtx sdk.Context, span opentracing.Span) error {
+				workCtx.KVStore(storeKey).Set([]byte("foo"), []byte("bar"))
+				workCtx.KVStore(storeKey).Set([]byte("other"), []byte("value"))
+				return nil
+			})
+			recorder.endTx()
+			recorder.startTx("BB")
+			DoWithTracing(ctx, "my_other_msg", StoreLogNothing, func(workCtx sdk.Context, span opentracing.Span) error {
+				workCtx.KVStore(storeKey).Set([]byte("foo"), []byte("bar"))
+				return nil
+			})
+			recorder.endTx()
+			require.NoError(t, recorder.OnWrite(storeKey, []byte("foo"), []byte("bar"), false))
+			require.NoError(t, recorder.OnWrite(storeKey, []byte("other"), []byte("value"), false))
+			require.NoError(t, recorder.flush())
+
+			// then
+			got, err := ReadWriteSetFile(filepath.Join(dir, writeSetFileName(1)))
+			require.NoError(t, err)
+			exp := []WriteRecord{
+				{
+					Height: 1, Store: storeKey.Name(), Key: "6f74686572", ValueHash: newWriteKey("", nil, []byte("value"), false).valueHash,
+					TxIndex: 0, TxHash: "AA", Span: "my_msg", Contract: "wasm1abc",
+				},
+				{
+					Height: 1, Store: storeKey.Name(), Key: "666f6f", ValueHash: newWriteKey("", nil, []byte("bar"), false).valueHash,
+					TxIndex: 1, TxHash: "BB", Span: "my_other_msg",
+				},
+			}
+			assert.Equal(t, exp, got)
+		})
+	}
+}